@@ -190,12 +190,31 @@
 //   - LogitBias: Token bias modifications
 //   - User: User identifier for tracking
 //   - Seed: Random seed for deterministic outputs
+//   - Truncation: Opt-in history truncation to fit the model's context window
+//   - DataSources: Azure AI Search or Cosmos DB sources for "On Your Data" grounding
+//   - NoCache: Bypass the response cache configured with AzureOpenAI.Cache
+//   - Responses: Chaining, background mode, reasoning summaries and built-in tools
+//     for models routed to the Responses API with AzureOpenAI.Responses
+//   - Completions: Suffix, echo, log probabilities and best_of for instruct models,
+//     and models listed in AzureOpenAI.CompletionsModels, which are served by the
+//     legacy completions endpoint
+//   - ToolChoice: "auto", "none", "required" or the name of a tool the model must call
+//   - ParallelToolCalls: Whether the model may request several tool calls in one turn
+//   - StrictTools: Enforce tool input schemas with strict mode, after inlining $ref
+//     definitions and normalizing the schemas to the supported subset
+//   - LogProbs and TopLogProbs: Per-token log probabilities, reported in ResponseMetadata
+//     and, for streamed chunks, in ChunkMetadata
+//   - Prediction: Expected output, static or taken from a request message, to speed up
+//     rewrites; accepted and rejected prediction tokens are reported in Usage.Custom
+//   - PromptCache: Stable message and tool ordering for prompt cache hits, and a cache
+//     key for Responses API models; cached prompt tokens are reported in Usage
 //
 // # Environment Variables
 //
 //   - AZURE_OPEN_AI_API_KEY: Your Azure OpenAI API key (required)
 //   - AZURE_OPEN_AI_ENDPOINT: Your Azure OpenAI endpoint (required)
 //   - AZURE_OPENAI_DEPLOYMENT_NAME: Default deployment name (optional)
+//   - AZURE_SEARCH_API_KEY: Azure AI Search key for retrievers and indexers (optional)
 //
 // # Plugin Interface
 //
@@ -205,7 +224,23 @@
 //   - ModelRef() function: Create model references for flows
 //   - Embedder() function: Get references to embedding models
 //   - DefineModel() function: Define custom model configurations
+//   - DefineRetriever() and DefineIndexer() functions: Azure AI Search backed retrieval
 //   - AzureOpenAI struct: Main plugin implementation
+//   - Client interface and ClientMiddleware: Replace or wrap the Azure SDK client
+//   - Middleware: Wrap chat and embedding handlers, e.g. for redaction or auditing
+//   - RunBatch() and DefineBatchFlows(): Submit many chat requests through the Batch API
+//   - Pricing, CostTracker and WithCostKey(): Estimated costs per response, aggregated by flow or tenant
+//   - Budget: Token and spend limits per request, user and time window, returning
+//     BudgetExceededError or downgrading to a cheaper fallback model
+//   - FallbackModels: Ordered models that retry requests failing with configured error classes
+//   - Hedge: Duplicate slow non-streaming chat requests to a second deployment or endpoint
+//   - Concurrency and WithPriority(): Per-deployment concurrency limits with a bounded priority queue
+//
+// # Observability
+//
+// Model and embedder calls are traced and measured with OpenTelemetry using the
+// GenAI semantic conventions. Set AzureOpenAI.Telemetry to supply tracer and meter
+// providers or to opt in to capturing prompt and completion content.
 //
 // For more information and examples, visit:
 // https://github.com/herosizy/genkit-go-plugins
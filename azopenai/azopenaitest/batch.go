@@ -0,0 +1,255 @@
+// Copyright 2025 herosizy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package azopenaitest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// batch is an emulated batch job. Jobs are processed when created, report
+// in_progress on the first poll and completed afterwards.
+type batch struct {
+	ID           string
+	InputFileID  string
+	OutputFileID string
+	ErrorFileID  string
+	Status       string
+	Metadata     map[string]string
+	Total        int
+	Completed    int
+	Failed       int
+	polls        int
+}
+
+func (b *batch) json() map[string]any {
+	out := map[string]any{
+		"id":                b.ID,
+		"object":            "batch",
+		"endpoint":          "/chat/completions",
+		"input_file_id":     b.InputFileID,
+		"completion_window": "24h",
+		"status":            b.Status,
+		"created_at":        created,
+		"request_counts":    map[string]any{"total": b.Total, "completed": 0, "failed": 0},
+	}
+	if b.Metadata != nil {
+		out["metadata"] = b.Metadata
+	}
+	if b.Status == "completed" {
+		out["request_counts"] = map[string]any{"total": b.Total, "completed": b.Completed, "failed": b.Failed}
+		out["completed_at"] = created + 60
+		if b.OutputFileID != "" {
+			out["output_file_id"] = b.OutputFileID
+		}
+		if b.ErrorFileID != "" {
+			out["error_file_id"] = b.ErrorFileID
+		}
+	}
+	return out
+}
+
+// File returns the contents of an uploaded or generated file.
+func (s *Server) File(id string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.files[id]
+	return data, ok
+}
+
+// serveBatchAPI emulates the Files and Batches APIs
+func (s *Server) serveBatchAPI(w http.ResponseWriter, r *http.Request, body []byte) {
+	path := strings.TrimPrefix(r.URL.Path, "/openai/")
+	parts := strings.Split(path, "/")
+
+	switch {
+	case r.Method == http.MethodPost && path == "files":
+		s.uploadFile(w, r, body)
+	case r.Method == http.MethodGet && len(parts) == 3 && parts[0] == "files" && parts[2] == "content":
+		data, ok := s.File(parts[1])
+		if !ok {
+			writeError(w, Error{Status: http.StatusNotFound, Code: "NotFound", Message: "File not found."})
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		_, _ = w.Write(data)
+	case r.Method == http.MethodPost && path == "batches":
+		s.createBatch(w, body)
+	case len(parts) >= 2 && parts[0] == "batches":
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		b, ok := s.batches[parts[1]]
+		if !ok {
+			writeError(w, Error{Status: http.StatusNotFound, Code: "NotFound", Message: "Batch not found."})
+			return
+		}
+		switch {
+		case r.Method == http.MethodGet && len(parts) == 2:
+			if b.Status == "validating" || b.Status == "in_progress" {
+				b.polls++
+				b.Status = "in_progress"
+				if b.polls > 1 {
+					b.Status = "completed"
+				}
+			}
+		case r.Method == http.MethodPost && len(parts) == 3 && parts[2] == "cancel":
+			b.Status = "cancelled"
+		default:
+			writeError(w, Error{Status: http.StatusNotFound, Code: "NotFound", Message: "Unknown batch operation."})
+			return
+		}
+		writeJSON(w, http.StatusOK, b.json())
+	default:
+		writeError(w, Error{Status: http.StatusNotFound, Code: "NotFound", Message: "Unknown operation."})
+	}
+}
+
+func (s *Server) uploadFile(w http.ResponseWriter, r *http.Request, body []byte) {
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		writeError(w, Error{Status: http.StatusBadRequest, Code: "invalid_request_error", Message: err.Error()})
+		return
+	}
+	f, header, err := r.FormFile("file")
+	if err != nil {
+		writeError(w, Error{Status: http.StatusBadRequest, Code: "invalid_request_error", Message: err.Error()})
+		return
+	}
+	defer f.Close()
+	data, _ := io.ReadAll(f)
+
+	s.mu.Lock()
+	id := fmt.Sprintf("file-%d", len(s.files)+1)
+	s.files[id] = data
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"id":         id,
+		"object":     "file",
+		"bytes":      len(data),
+		"created_at": created,
+		"filename":   header.Filename,
+		"purpose":    r.FormValue("purpose"),
+		"status":     "processed",
+	})
+}
+
+// createBatch runs every line of the input file through the chat reply queue
+func (s *Server) createBatch(w http.ResponseWriter, body []byte) {
+	var create struct {
+		InputFileID string            `json:"input_file_id"`
+		Metadata    map[string]string `json:"metadata"`
+	}
+	if err := json.Unmarshal(body, &create); err != nil {
+		writeError(w, Error{Status: http.StatusBadRequest, Code: "invalid_request_error", Message: err.Error()})
+		return
+	}
+	input, ok := s.File(create.InputFileID)
+	if !ok {
+		writeError(w, Error{Status: http.StatusBadRequest, Code: "invalid_request_error", Message: "Input file not found."})
+		return
+	}
+
+	var output, errorsOut bytes.Buffer
+	b := &batch{InputFileID: create.InputFileID, Status: "validating", Metadata: create.Metadata}
+	scanner := bufio.NewScanner(bytes.NewReader(input))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var line struct {
+			CustomID string          `json:"custom_id"`
+			Body     json.RawMessage `json:"body"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			writeError(w, Error{Status: http.StatusBadRequest, Code: "invalid_request_error", Message: err.Error()})
+			return
+		}
+		b.Total++
+		if out, ok := s.batchLine(line.CustomID, line.Body); ok {
+			b.Completed++
+			output.Write(out)
+		} else {
+			b.Failed++
+			errorsOut.Write(out)
+		}
+	}
+
+	s.mu.Lock()
+	b.ID = fmt.Sprintf("batch_%d", len(s.batches)+1)
+	if output.Len() > 0 {
+		b.OutputFileID = fmt.Sprintf("file-%d", len(s.files)+1)
+		s.files[b.OutputFileID] = output.Bytes()
+	}
+	if errorsOut.Len() > 0 {
+		b.ErrorFileID = fmt.Sprintf("file-%d", len(s.files)+1)
+		s.files[b.ErrorFileID] = errorsOut.Bytes()
+	}
+	s.batches[b.ID] = b
+	resp := b.json()
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+// batchLine answers one batch request, logged as a chat request, and reports
+// whether it succeeded
+func (s *Server) batchLine(customID string, body []byte) ([]byte, bool) {
+	var payload struct {
+		Model string `json:"model"`
+	}
+	_ = json.Unmarshal(body, &payload)
+	req := Request{Endpoint: EndpointChat, Deployment: payload.Model, Body: body}
+	s.mu.Lock()
+	s.requests = append(s.requests, req)
+	s.mu.Unlock()
+
+	status := http.StatusOK
+	var respBody any
+	next := s.next(EndpointChat)
+	chat, ok := s.chatReply(req, next)
+	switch {
+	case next.err != nil:
+		status = next.err.Status
+		respBody = map[string]any{"error": map[string]any{"code": next.err.Code, "message": next.err.Message}}
+	case !ok:
+		status = errNoChatReply.Status
+		respBody = map[string]any{"error": map[string]any{"code": errNoChatReply.Code, "message": errNoChatReply.Message}}
+	default:
+		respBody = chatCompletion(req, chat)
+	}
+
+	line, _ := json.Marshal(map[string]any{
+		"id":        fmt.Sprintf("batch_req_%d", time.Now().UnixNano()),
+		"custom_id": customID,
+		"response": map[string]any{
+			"status_code": status,
+			"request_id":  fmt.Sprintf("azopenaitest-%d", time.Now().UnixNano()),
+			"body":        respBody,
+		},
+		"error": nil,
+	})
+	return append(line, '\n'), status == http.StatusOK
+}
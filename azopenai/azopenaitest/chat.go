@@ -0,0 +1,256 @@
+// Copyright 2025 herosizy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package azopenaitest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const created = 1700000000
+
+// serveChat renders a chat reply as JSON or, for streaming requests, as server-sent events.
+// When logprobs are requested each content chunk is reported as one token, as for completions.
+func (s *Server) serveChat(w http.ResponseWriter, req Request, payload map[string]any, reply ChatReply) {
+	topLogProbs := -1
+	if logprobs, _ := payload["logprobs"].(bool); logprobs {
+		n, _ := payload["top_logprobs"].(float64)
+		topLogProbs = int(n)
+	}
+	if stream, _ := payload["stream"].(bool); stream {
+		id, model, finish, usage := chatDefaults(req, reply)
+		includeUsage := false
+		if opts, ok := payload["stream_options"].(map[string]any); ok {
+			includeUsage, _ = opts["include_usage"].(bool)
+		}
+		if !includeUsage {
+			usage = nil
+		}
+		writeChatStream(w, id, model, finish, reply, usage, topLogProbs)
+		return
+	}
+	resp := chatCompletion(req, reply)
+	if topLogProbs >= 0 {
+		chunks := reply.Chunks
+		if chunks == nil {
+			chunks = []string{reply.Content}
+		}
+		resp["choices"].([]any)[0].(map[string]any)["logprobs"] = chatLogProbs(chunks, 0, topLogProbs)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// chatDefaults fills in the response ID, model, finish reason and usage of a reply
+func chatDefaults(req Request, reply ChatReply) (id, model, finish string, usage *Usage) {
+	id = fmt.Sprintf("chatcmpl-azopenaitest-%d", time.Now().UnixNano())
+	model = reply.Model
+	if model == "" {
+		model = req.Deployment
+	}
+	finish = reply.FinishReason
+	if finish == "" {
+		finish = "stop"
+		if len(reply.ToolCalls) > 0 {
+			finish = "tool_calls"
+		}
+	}
+	usage = reply.Usage
+	if usage == nil {
+		usage = &Usage{
+			PromptTokens:     estimateTokens(string(req.Body)),
+			CompletionTokens: estimateTokens(reply.Content),
+		}
+	}
+	return id, model, finish, usage
+}
+
+// chatCompletion renders a reply as a non-streaming chat completion body
+func chatCompletion(req Request, reply ChatReply) map[string]any {
+	id, model, finish, usage := chatDefaults(req, reply)
+	message := map[string]any{"role": "assistant", "content": reply.Content}
+	if len(reply.ToolCalls) > 0 {
+		message["content"] = nil
+		message["tool_calls"] = toolCalls(reply.ToolCalls, false)
+	}
+	choice := map[string]any{"index": 0, "finish_reason": finish, "message": message}
+	if reply.ContentFilter != nil {
+		choice["content_filter_results"] = reply.ContentFilter
+	}
+	resp := map[string]any{
+		"id":      id,
+		"object":  "chat.completion",
+		"created": created,
+		"model":   model,
+		"choices": []any{choice},
+		"usage":   usageJSON(usage),
+	}
+	if reply.PromptFilter != nil {
+		resp["prompt_filter_results"] = promptFilterResults(reply.PromptFilter)
+	}
+	return resp
+}
+
+// writeChatStream emits the reply in the chunk sequence Azure uses: prompt filter
+// results, content deltas, tool call deltas, the finish reason and finally usage.
+// Content deltas carry log probabilities unless topLogProbs is negative.
+func writeChatStream(w http.ResponseWriter, id, model, finish string, reply ChatReply, usage *Usage, topLogProbs int) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+
+	send := func(choices []any, extra map[string]any) {
+		chunk := map[string]any{
+			"id":      id,
+			"object":  "chat.completion.chunk",
+			"created": created,
+			"model":   model,
+			"choices": choices,
+		}
+		for k, v := range extra {
+			chunk[k] = v
+		}
+		data, _ := json.Marshal(chunk)
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	delta := func(d map[string]any) []any {
+		return []any{map[string]any{"index": 0, "delta": d, "finish_reason": nil}}
+	}
+
+	if reply.PromptFilter != nil {
+		send([]any{}, map[string]any{"prompt_filter_results": promptFilterResults(reply.PromptFilter)})
+	}
+
+	chunks := reply.Chunks
+	if chunks == nil && reply.Content != "" {
+		chunks = []string{reply.Content}
+	}
+	for i, c := range chunks {
+		d := map[string]any{"content": c}
+		if i == 0 {
+			d["role"] = "assistant"
+		}
+		choices := delta(d)
+		if topLogProbs >= 0 {
+			choices[0].(map[string]any)["logprobs"] = chatLogProbs([]string{c}, i, topLogProbs)
+		}
+		send(choices, nil)
+	}
+
+	for i, tc := range toolCalls(reply.ToolCalls, true) {
+		args := reply.ToolCalls[i].Arguments
+		tc["function"] = map[string]any{"name": reply.ToolCalls[i].Name, "arguments": ""}
+		send(delta(map[string]any{"role": "assistant", "tool_calls": []any{tc}}), nil)
+		send(delta(map[string]any{"tool_calls": []any{map[string]any{"index": i, "function": map[string]any{"arguments": args}}}}), nil)
+	}
+
+	last := map[string]any{"index": 0, "delta": map[string]any{}, "finish_reason": finish}
+	if reply.ContentFilter != nil {
+		last["content_filter_results"] = reply.ContentFilter
+	}
+	send([]any{last}, nil)
+
+	if usage != nil {
+		send([]any{}, map[string]any{"usage": usageJSON(usage)})
+	}
+	fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+func toolCalls(calls []ToolCall, streaming bool) []map[string]any {
+	out := make([]map[string]any, len(calls))
+	for i, c := range calls {
+		id := c.ID
+		if id == "" {
+			id = fmt.Sprintf("call_%d", i+1)
+		}
+		tc := map[string]any{
+			"id":       id,
+			"type":     "function",
+			"function": map[string]any{"name": c.Name, "arguments": c.Arguments},
+		}
+		if streaming {
+			tc["index"] = i
+		}
+		out[i] = tc
+	}
+	return out
+}
+
+// chatLogProbs renders deterministic chat log probabilities for tokens starting at
+// position offset, with up to top alternatives per token
+func chatLogProbs(tokens []string, offset, top int) map[string]any {
+	content := make([]any, len(tokens))
+	for i, tok := range tokens {
+		p := -0.1 * float64(offset+i+1)
+		alternatives := []any{
+			map[string]any{"token": tok, "logprob": p, "bytes": tokenBytes(tok)},
+			map[string]any{"token": "<alt>", "logprob": p - 1, "bytes": tokenBytes("<alt>")},
+		}
+		content[i] = map[string]any{
+			"token":        tok,
+			"logprob":      p,
+			"bytes":        tokenBytes(tok),
+			"top_logprobs": alternatives[:min(top, len(alternatives))],
+		}
+	}
+	return map[string]any{"content": content, "refusal": nil}
+}
+
+// tokenBytes returns the UTF-8 bytes of a token as the integer array Azure sends
+func tokenBytes(tok string) []int {
+	b := make([]int, len(tok))
+	for i := range len(tok) {
+		b[i] = int(tok[i])
+	}
+	return b
+}
+
+func promptFilterResults(categories map[string]Filter) []any {
+	return []any{map[string]any{"prompt_index": 0, "content_filter_results": categories}}
+}
+
+func usageJSON(u *Usage) map[string]any {
+	usage := map[string]any{
+		"prompt_tokens":     u.PromptTokens,
+		"completion_tokens": u.CompletionTokens,
+		"total_tokens":      u.PromptTokens + u.CompletionTokens,
+	}
+	if u.CachedTokens > 0 {
+		usage["prompt_tokens_details"] = map[string]any{"cached_tokens": u.CachedTokens}
+	}
+	if u.AcceptedPredictionTokens > 0 || u.RejectedPredictionTokens > 0 {
+		usage["completion_tokens_details"] = map[string]any{
+			"accepted_prediction_tokens": u.AcceptedPredictionTokens,
+			"rejected_prediction_tokens": u.RejectedPredictionTokens,
+		}
+	}
+	return usage
+}
+
+// estimateTokens approximates token counts at four characters per token
+func estimateTokens(s string) int {
+	return (len(strings.TrimSpace(s)) + 3) / 4
+}
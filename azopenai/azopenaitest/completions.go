@@ -0,0 +1,147 @@
+// Copyright 2025 herosizy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package azopenaitest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// QueueCompletion appends replies for the legacy completions endpoint,
+// consumed one per request. Only Content, Chunks, FinishReason, the filters,
+// Usage and Model apply.
+func (s *Server) QueueCompletion(replies ...ChatReply) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range replies {
+		s.queues[EndpointCompletions] = append(s.queues[EndpointCompletions], reply{chat: &replies[i]})
+	}
+}
+
+// serveCompletions renders a reply as a text completion. With echo the prompt
+// is prepended to the text, and when logprobs are requested each chunk is
+// reported as one token with a log probability of -0.1 times its position.
+func (s *Server) serveCompletions(w http.ResponseWriter, req Request, payload map[string]any, reply ChatReply) {
+	id := fmt.Sprintf("cmpl-azopenaitest-%d", time.Now().UnixNano())
+	_, model, finish, usage := chatDefaults(req, reply)
+	chunks := reply.Chunks
+	if chunks == nil {
+		chunks = []string{reply.Content}
+	}
+	logprobs, _ := payload["logprobs"].(float64)
+
+	var prefix string
+	if echo, _ := payload["echo"].(bool); echo {
+		if prompt, ok := payload["prompt"].([]any); ok && len(prompt) > 0 {
+			prefix, _ = prompt[0].(string)
+		}
+	}
+
+	choice := func(text string, tokens []string, offset int, finish any) map[string]any {
+		c := map[string]any{"index": 0, "text": text, "finish_reason": finish, "logprobs": nil}
+		if logprobs > 0 {
+			c["logprobs"] = tokenLogProbs(tokens, offset)
+		}
+		return c
+	}
+	completion := func(choices []any) map[string]any {
+		return map[string]any{
+			"id":      id,
+			"object":  "text_completion",
+			"created": created,
+			"model":   model,
+			"choices": choices,
+		}
+	}
+
+	if stream, _ := payload["stream"].(bool); !stream {
+		c := choice(prefix+strings.Join(chunks, ""), chunks, 0, finish)
+		if reply.ContentFilter != nil {
+			c["content_filter_results"] = reply.ContentFilter
+		}
+		resp := completion([]any{c})
+		resp["usage"] = usageJSON(usage)
+		if reply.PromptFilter != nil {
+			resp["prompt_filter_results"] = promptFilterResults(reply.PromptFilter)
+		}
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	send := func(chunk map[string]any) {
+		data, _ := json.Marshal(chunk)
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	if reply.PromptFilter != nil {
+		first := completion([]any{})
+		first["prompt_filter_results"] = promptFilterResults(reply.PromptFilter)
+		send(first)
+	}
+	if prefix != "" {
+		send(completion([]any{choice(prefix, nil, 0, nil)}))
+	}
+	for i, c := range chunks {
+		send(completion([]any{choice(c, []string{c}, i, nil)}))
+	}
+	last := choice("", nil, 0, finish)
+	if reply.ContentFilter != nil {
+		last["content_filter_results"] = reply.ContentFilter
+	}
+	send(completion([]any{last}))
+	if opts, ok := payload["stream_options"].(map[string]any); ok && opts["include_usage"] == true {
+		final := completion([]any{})
+		final["usage"] = usageJSON(usage)
+		send(final)
+	}
+	fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+// tokenLogProbs renders deterministic log probabilities for tokens starting at position offset
+func tokenLogProbs(tokens []string, offset int) map[string]any {
+	lp := map[string]any{
+		"tokens":         tokens,
+		"token_logprobs": []float64{},
+		"top_logprobs":   []map[string]float64{},
+		"text_offset":    []int{},
+	}
+	textOffset := 0
+	for i, tok := range tokens {
+		p := -0.1 * float64(offset+i+1)
+		lp["token_logprobs"] = append(lp["token_logprobs"].([]float64), p)
+		lp["top_logprobs"] = append(lp["top_logprobs"].([]map[string]float64), map[string]float64{tok: p, "<alt>": p - 1})
+		lp["text_offset"] = append(lp["text_offset"].([]int), textOffset)
+		textOffset += len(tok)
+	}
+	if tokens == nil {
+		lp["tokens"] = []string{}
+	}
+	return lp
+}
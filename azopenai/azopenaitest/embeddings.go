@@ -0,0 +1,95 @@
+// Copyright 2025 herosizy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package azopenaitest
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"time"
+)
+
+// tinyPNG is a 1x1 transparent PNG returned for b64_json image requests
+const tinyPNG = "iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAQAAAC1HAwCAAAAC0lEQVR42mNkYAAAAAYAAjCB0C8AAAAASUVORK5CYII="
+
+func serveEmbeddings(w http.ResponseWriter, req Request, payload map[string]any, embed func(string) []float32) {
+	if embed == nil {
+		embed = hashEmbedding
+	}
+
+	var inputs []string
+	switch in := payload["input"].(type) {
+	case string:
+		inputs = []string{in}
+	case []any:
+		for _, v := range in {
+			s, _ := v.(string)
+			inputs = append(inputs, s)
+		}
+	}
+
+	data := make([]any, len(inputs))
+	tokens := 0
+	for i, in := range inputs {
+		data[i] = map[string]any{"object": "embedding", "index": i, "embedding": embed(in)}
+		tokens += estimateTokens(in)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"object": "list",
+		"model":  req.Deployment,
+		"data":   data,
+		"usage":  map[string]any{"prompt_tokens": tokens, "total_tokens": tokens},
+	})
+}
+
+// hashEmbedding derives a deterministic unit-range vector from the input text
+func hashEmbedding(input string) []float32 {
+	v := make([]float32, DefaultEmbeddingDimensions)
+	for i := range v {
+		h := fnv.New32a()
+		fmt.Fprintf(h, "%d:%s", i, input)
+		v[i] = float32(h.Sum32())/float32(1<<31) - 1
+	}
+	return v
+}
+
+func serveImages(w http.ResponseWriter, payload map[string]any, reply ImageReply) {
+	prompt, _ := payload["prompt"].(string)
+	if reply.RevisedPrompt == "" {
+		reply.RevisedPrompt = prompt
+	}
+	image := map[string]any{"revised_prompt": reply.RevisedPrompt}
+	if format, _ := payload["response_format"].(string); format == "b64_json" {
+		if reply.B64JSON == "" {
+			reply.B64JSON = tinyPNG
+		}
+		image["b64_json"] = reply.B64JSON
+	} else {
+		if reply.URL == "" {
+			reply.URL = "https://azopenaitest.invalid/images/generated.png"
+		}
+		image["url"] = reply.URL
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"created": time.Now().Unix(),
+		"data":    []any{image},
+	})
+}
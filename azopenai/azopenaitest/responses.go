@@ -0,0 +1,226 @@
+// Copyright 2025 herosizy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package azopenaitest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// QueueResponse appends replies for the Responses API, consumed one per
+// request. The reply's Reasoning is rendered as a reasoning summary.
+func (s *Server) QueueResponse(replies ...ChatReply) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range replies {
+		s.queues[EndpointResponses] = append(s.queues[EndpointResponses], reply{chat: &replies[i]})
+	}
+}
+
+// StoredResponse returns a response kept by the server, as returned by
+// GET /openai/responses/{id}.
+func (s *Server) StoredResponse(id string) (map[string]any, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	resp, ok := s.responses[id]
+	return resp, ok
+}
+
+// serveResponses handles response creation and retrieval. Created responses
+// are stored so they can be fetched, chained with previous_response_id or
+// polled in background mode, where they report queued until the first poll.
+func (s *Server) serveResponses(w http.ResponseWriter, r *http.Request, req Request, next reply) {
+	if id, ok := strings.CutPrefix(r.URL.Path, "/openai/responses/"); ok {
+		s.mu.Lock()
+		resp, found := s.responses[id]
+		if found && resp["status"] == "queued" {
+			resp = s.pending[id]
+			s.responses[id] = resp
+			delete(s.pending, id)
+		}
+		s.mu.Unlock()
+		if !found || r.Method != http.MethodGet {
+			writeError(w, Error{Status: http.StatusNotFound, Code: "NotFound", Message: "Response not found."})
+			return
+		}
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	var payload struct {
+		Model              string `json:"model"`
+		PreviousResponseID string `json:"previous_response_id"`
+		Stream             bool   `json:"stream"`
+		Background         bool   `json:"background"`
+		Store              *bool  `json:"store"`
+	}
+	if err := json.Unmarshal(req.Body, &payload); err != nil {
+		writeError(w, Error{Status: http.StatusBadRequest, Code: "invalid_request_error", Message: err.Error()})
+		return
+	}
+	if payload.PreviousResponseID != "" {
+		if _, ok := s.StoredResponse(payload.PreviousResponseID); !ok {
+			writeError(w, Error{Status: http.StatusNotFound, Code: "previous_response_not_found",
+				Message: fmt.Sprintf("Previous response with id '%s' not found.", payload.PreviousResponseID)})
+			return
+		}
+	}
+	chat, ok := s.chatReply(req, next)
+	if !ok {
+		writeError(w, errNoChatReply)
+		return
+	}
+	if chat.Content == "" {
+		// The completed response carries the full text of streamed chunks
+		chat.Content = strings.Join(chat.Chunks, "")
+	}
+
+	s.mu.Lock()
+	id := fmt.Sprintf("resp_%d", len(s.responses)+len(s.pending)+1)
+	s.mu.Unlock()
+	resp := response(id, req, chat)
+	if payload.Store == nil || *payload.Store || payload.Background {
+		s.mu.Lock()
+		s.responses[id] = resp
+		if payload.Background {
+			queued := map[string]any{"id": id, "object": "response", "model": resp["model"], "status": "queued", "output": []any{}}
+			s.pending[id] = resp
+			s.responses[id] = queued
+			resp = queued
+		}
+		s.mu.Unlock()
+	}
+
+	if payload.Stream && !payload.Background {
+		writeResponseStream(w, resp, chat)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// response renders a reply as a Responses API response object
+func response(id string, req Request, reply ChatReply) map[string]any {
+	_, model, finish, usage := chatDefaults(req, reply)
+	var output []any
+	if reply.Reasoning != "" {
+		output = append(output, map[string]any{
+			"type":    "reasoning",
+			"id":      "rs_" + id,
+			"summary": []any{map[string]any{"type": "summary_text", "text": reply.Reasoning}},
+		})
+	}
+	if reply.Content != "" || len(reply.ToolCalls) == 0 {
+		output = append(output, map[string]any{
+			"type":   "message",
+			"id":     "msg_" + id,
+			"role":   "assistant",
+			"status": "completed",
+			"content": []any{map[string]any{
+				"type":        "output_text",
+				"text":        reply.Content,
+				"annotations": []any{},
+			}},
+		})
+	}
+	for _, tc := range toolCalls(reply.ToolCalls, false) {
+		fn := tc["function"].(map[string]any)
+		output = append(output, map[string]any{
+			"type":      "function_call",
+			"id":        "fc_" + tc["id"].(string),
+			"call_id":   tc["id"],
+			"name":      fn["name"],
+			"arguments": fn["arguments"],
+			"status":    "completed",
+		})
+	}
+
+	resp := map[string]any{
+		"id":         id,
+		"object":     "response",
+		"created_at": created,
+		"model":      model,
+		"status":     "completed",
+		"output":     output,
+		"usage": map[string]any{
+			"input_tokens":          usage.PromptTokens,
+			"output_tokens":         usage.CompletionTokens + usage.ReasoningTokens,
+			"total_tokens":          usage.PromptTokens + usage.CompletionTokens + usage.ReasoningTokens,
+			"input_tokens_details":  map[string]any{"cached_tokens": usage.CachedTokens},
+			"output_tokens_details": map[string]any{"reasoning_tokens": usage.ReasoningTokens},
+		},
+	}
+	switch finish {
+	case "length":
+		resp["status"] = "incomplete"
+		resp["incomplete_details"] = map[string]any{"reason": "max_output_tokens"}
+	case "content_filter":
+		resp["status"] = "incomplete"
+		resp["incomplete_details"] = map[string]any{"reason": "content_filter"}
+	}
+	return resp
+}
+
+// writeResponseStream emits the semantic events of the Responses API: the
+// created event, reasoning summary and text deltas, completed function calls
+// and finally the completed (or incomplete) response
+func writeResponseStream(w http.ResponseWriter, resp map[string]any, reply ChatReply) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+
+	seq := 0
+	send := func(event string, data map[string]any) {
+		data["type"] = event
+		data["sequence_number"] = seq
+		seq++
+		b, _ := json.Marshal(data)
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, b)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	send("response.created", map[string]any{"response": map[string]any{
+		"id": resp["id"], "object": "response", "model": resp["model"], "status": "in_progress", "output": []any{},
+	}})
+	if reply.Reasoning != "" {
+		send("response.reasoning_summary_text.delta", map[string]any{"output_index": 0, "summary_index": 0, "delta": reply.Reasoning})
+	}
+	chunks := reply.Chunks
+	if chunks == nil && reply.Content != "" {
+		chunks = []string{reply.Content}
+	}
+	for _, c := range chunks {
+		send("response.output_text.delta", map[string]any{"output_index": 0, "content_index": 0, "delta": c})
+	}
+	for i, item := range resp["output"].([]any) {
+		if item.(map[string]any)["type"] == "function_call" {
+			send("response.output_item.done", map[string]any{"output_index": i, "item": item})
+		}
+	}
+	event := "response.completed"
+	if resp["status"] == "incomplete" {
+		event = "response.incomplete"
+	}
+	send(event, map[string]any{"response": resp})
+}
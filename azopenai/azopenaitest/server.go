@@ -0,0 +1,440 @@
+// Copyright 2025 herosizy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package azopenaitest provides an in-process fake of the Azure OpenAI service
+// for integration tests.
+//
+// The server emulates chat completions (including SSE streaming, tool calls and
+// content filtering), legacy completions, embeddings, image generation, the
+// Responses API and the Files and Batches APIs. Replies are scripted per test
+// and consumed in order:
+//
+//	srv := azopenaitest.NewServer(t)
+//	srv.QueueChat(azopenaitest.ChatReply{Content: "Hello!"})
+//	srv.QueueError(azopenaitest.EndpointChat, azopenaitest.RateLimit(10*time.Millisecond))
+//
+//	plugin := &azopenai.AzureOpenAI{
+//		APIKey:    "test-key",
+//		Endpoint:  srv.URL,
+//		Transport: srv.Client(),
+//	}
+//
+// Every request is logged and can be inspected with [Server.Requests]. Lines of
+// batch input files are answered from the chat queue and logged as chat requests.
+package azopenaitest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Endpoint identifies an emulated operation.
+type Endpoint string
+
+const (
+	EndpointChat        Endpoint = "chat/completions"
+	EndpointCompletions Endpoint = "completions"
+	EndpointEmbeddings  Endpoint = "embeddings"
+	EndpointImages      Endpoint = "images/generations"
+	EndpointFiles       Endpoint = "files"
+	EndpointBatches     Endpoint = "batches"
+	EndpointResponses   Endpoint = "responses"
+)
+
+// DefaultEmbeddingDimensions is the length of generated embedding vectors.
+const DefaultEmbeddingDimensions = 8
+
+// Request is a request received by the server.
+type Request struct {
+	Endpoint   Endpoint    // Operation that was called
+	Deployment string      // Deployment name from the URL
+	Header     http.Header // Request headers
+	Body       []byte      // Raw JSON body
+}
+
+// JSON decodes the request body into a generic map.
+func (r Request) JSON() map[string]any {
+	var m map[string]any
+	_ = json.Unmarshal(r.Body, &m)
+	return m
+}
+
+// ChatReply scripts a chat completion. The same reply is rendered as a single
+// JSON response or as an SSE stream depending on the request.
+type ChatReply struct {
+	Content       string            // Assistant message content
+	Chunks        []string          // Streamed content deltas. If nil, Content is sent as a single delta.
+	ToolCalls     []ToolCall        // Tool calls requested by the assistant
+	FinishReason  string            // Defaults to "tool_calls" when ToolCalls is set, otherwise "stop"
+	ContentFilter map[string]Filter // Completion content filter results
+	PromptFilter  map[string]Filter // Prompt content filter results
+	Usage         *Usage            // Token usage. If nil, usage is estimated from the request and reply.
+	Model         string            // Model reported in the response. Defaults to the deployment name.
+	Reasoning     string            // Reasoning summary, rendered by the Responses API only
+	Delay         time.Duration     // Latency before the reply is sent, cut short if the request is cancelled
+}
+
+// ToolCall is a function call requested by the assistant.
+type ToolCall struct {
+	ID        string // Call ID. Defaults to "call_<n>".
+	Name      string // Function name
+	Arguments string // JSON-encoded arguments
+}
+
+// Filter is a content filter result for a single category.
+type Filter struct {
+	Filtered bool   `json:"filtered"`
+	Severity string `json:"severity,omitempty"`
+	Detected bool   `json:"detected,omitempty"`
+}
+
+// Usage reports token counts for a reply.
+type Usage struct {
+	PromptTokens             int
+	CompletionTokens         int
+	ReasoningTokens          int // Reported by the Responses API only
+	CachedTokens             int // Prompt tokens served from the prompt cache
+	AcceptedPredictionTokens int // Predicted output tokens that appeared in the completion
+	RejectedPredictionTokens int // Predicted output tokens that did not
+}
+
+// ImageReply scripts an image generation result.
+type ImageReply struct {
+	URL           string // Image URL, used when the request asks for URLs
+	B64JSON       string // Base64 image data, used when the request asks for b64_json
+	RevisedPrompt string // Revised prompt. Defaults to the request prompt.
+}
+
+// Error scripts an error response.
+type Error struct {
+	Status        int               // HTTP status code
+	Code          string            // Error code in the response body
+	Message       string            // Error message in the response body
+	RetryAfter    time.Duration     // Sets the retry-after-ms and Retry-After headers when non-zero
+	ContentFilter map[string]Filter // Prompt filter results reported in the inner error
+	Times         int               // Number of consecutive requests that receive this error. Defaults to 1.
+}
+
+// RateLimit returns a 429 error carrying a Retry-After hint.
+func RateLimit(retryAfter time.Duration) Error {
+	return Error{
+		Status:     http.StatusTooManyRequests,
+		Code:       "429",
+		Message:    "Requests to the deployment have exceeded the call rate limit.",
+		RetryAfter: retryAfter,
+	}
+}
+
+// ContentFiltered returns the 400 error Azure sends when a prompt is blocked.
+func ContentFiltered(categories map[string]Filter) Error {
+	return Error{
+		Status:        http.StatusBadRequest,
+		Code:          "content_filter",
+		Message:       "The response was filtered due to the prompt triggering Azure OpenAI's content management policy.",
+		ContentFilter: categories,
+	}
+}
+
+// DeploymentNotFound returns the 404 error for an unknown deployment.
+func DeploymentNotFound() Error {
+	return Error{
+		Status:  http.StatusNotFound,
+		Code:    "DeploymentNotFound",
+		Message: "The API deployment for this resource does not exist.",
+	}
+}
+
+type reply struct {
+	chat  *ChatReply
+	image *ImageReply
+	err   *Error
+}
+
+// Server is a fake Azure OpenAI endpoint.
+type Server struct {
+	URL string // Endpoint to configure on the plugin
+
+	srv *httptest.Server
+
+	mu        sync.Mutex
+	queues    map[Endpoint][]reply
+	requests  []Request
+	onChat    func(Request) ChatReply
+	embed     func(input string) []float32
+	files     map[string][]byte
+	batches   map[string]*batch
+	responses map[string]map[string]any
+	pending   map[string]map[string]any // Background responses, revealed on the first poll
+}
+
+// NewServer starts a TLS server that is closed when the test finishes.
+func NewServer(t testing.TB) *Server {
+	s := &Server{
+		queues:    map[Endpoint][]reply{},
+		files:     map[string][]byte{},
+		batches:   map[string]*batch{},
+		responses: map[string]map[string]any{},
+		pending:   map[string]map[string]any{},
+	}
+	s.srv = httptest.NewTLSServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = s.srv.URL
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Client returns an HTTP client that trusts the server's certificate. It can be
+// used as AzureOpenAI.Transport.
+func (s *Server) Client() *http.Client {
+	return s.srv.Client()
+}
+
+// Close shuts down the server.
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// QueueChat appends chat replies, consumed one per chat request.
+func (s *Server) QueueChat(replies ...ChatReply) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range replies {
+		s.queues[EndpointChat] = append(s.queues[EndpointChat], reply{chat: &replies[i]})
+	}
+}
+
+// QueueImages appends image replies, consumed one per image request.
+func (s *Server) QueueImages(replies ...ImageReply) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range replies {
+		s.queues[EndpointImages] = append(s.queues[EndpointImages], reply{image: &replies[i]})
+	}
+}
+
+// QueueError appends error responses for an endpoint, interleaved in order with
+// queued replies.
+func (s *Server) QueueError(endpoint Endpoint, errs ...Error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range errs {
+		for n := 0; n < max(errs[i].Times, 1); n++ {
+			s.queues[endpoint] = append(s.queues[endpoint], reply{err: &errs[i]})
+		}
+	}
+}
+
+// OnChat sets a handler that builds chat replies once the queue is empty.
+// Without a handler or queued reply, chat requests fail with a 400 error.
+func (s *Server) OnChat(fn func(Request) ChatReply) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onChat = fn
+}
+
+// OnEmbed sets the function producing embedding vectors. By default vectors of
+// DefaultEmbeddingDimensions are derived deterministically from the input.
+func (s *Server) OnEmbed(fn func(input string) []float32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.embed = fn
+}
+
+// Requests returns the requests received so far.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	deployment, endpoint, ok := parsePath(r.URL.Path)
+	if !ok {
+		writeError(w, DeploymentNotFound())
+		return
+	}
+	req := Request{Endpoint: endpoint, Deployment: deployment, Header: r.Header.Clone(), Body: body}
+	if endpoint == EndpointResponses {
+		var payload struct {
+			Model string `json:"model"`
+		}
+		_ = json.Unmarshal(body, &payload)
+		req.Deployment = payload.Model
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, req)
+	s.mu.Unlock()
+
+	if r.Header.Get("Api-Key") == "" && r.Header.Get("Authorization") == "" {
+		writeError(w, Error{Status: http.StatusUnauthorized, Code: "401", Message: "Access denied due to missing subscription key."})
+		return
+	}
+
+	next := s.next(endpoint)
+	s.mu.Lock()
+	embed := s.embed
+	s.mu.Unlock()
+
+	if next.err != nil {
+		writeError(w, *next.err)
+		return
+	}
+	if endpoint == EndpointFiles || endpoint == EndpointBatches {
+		s.serveBatchAPI(w, r, body)
+		return
+	}
+	if endpoint == EndpointResponses {
+		s.serveResponses(w, r, req, next)
+		return
+	}
+
+	var payload map[string]any
+	if err := json.Unmarshal(body, &payload); err != nil {
+		writeError(w, Error{Status: http.StatusBadRequest, Code: "invalid_request_error", Message: err.Error()})
+		return
+	}
+
+	switch endpoint {
+	case EndpointChat:
+		chat, ok := s.chatReply(req, next)
+		if !ok {
+			writeError(w, errNoChatReply)
+			return
+		}
+		if !sleep(r.Context(), chat.Delay) {
+			return
+		}
+		s.serveChat(w, req, payload, chat)
+	case EndpointCompletions:
+		completion, ok := s.chatReply(req, next)
+		if !ok {
+			writeError(w, errNoChatReply)
+			return
+		}
+		if !sleep(r.Context(), completion.Delay) {
+			return
+		}
+		s.serveCompletions(w, req, payload, completion)
+	case EndpointEmbeddings:
+		serveEmbeddings(w, req, payload, embed)
+	case EndpointImages:
+		image := ImageReply{}
+		if next.image != nil {
+			image = *next.image
+		}
+		serveImages(w, payload, image)
+	}
+}
+
+// next dequeues the next scripted reply for an endpoint
+func (s *Server) next(endpoint Endpoint) reply {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var next reply
+	if q := s.queues[endpoint]; len(q) > 0 {
+		next, s.queues[endpoint] = q[0], q[1:]
+	}
+	return next
+}
+
+var errNoChatReply = Error{Status: http.StatusBadRequest, Code: "azopenaitest", Message: "no chat reply queued"}
+
+// chatReply returns the queued reply, falling back to the OnChat handler
+func (s *Server) chatReply(req Request, next reply) (ChatReply, bool) {
+	if next.chat != nil {
+		return *next.chat, true
+	}
+	s.mu.Lock()
+	onChat := s.onChat
+	s.mu.Unlock()
+	if onChat == nil {
+		return ChatReply{}, false
+	}
+	return onChat(req), true
+}
+
+// parsePath extracts the deployment and operation from /openai/deployments/{deployment}/{operation},
+// or the resource from /openai/files, /openai/batches and /openai/responses paths
+func parsePath(path string) (string, Endpoint, bool) {
+	for _, endpoint := range []Endpoint{EndpointFiles, EndpointBatches, EndpointResponses} {
+		if path == "/openai/"+string(endpoint) || strings.HasPrefix(path, "/openai/"+string(endpoint)+"/") {
+			return "", endpoint, true
+		}
+	}
+	rest, ok := strings.CutPrefix(path, "/openai/deployments/")
+	if !ok {
+		return "", "", false
+	}
+	deployment, op, ok := strings.Cut(rest, "/")
+	if !ok {
+		return "", "", false
+	}
+	switch endpoint := Endpoint(op); endpoint {
+	case EndpointChat, EndpointCompletions, EndpointEmbeddings, EndpointImages:
+		return deployment, endpoint, true
+	}
+	return "", "", false
+}
+
+// sleep waits for d, reporting false if ctx is done first
+func sleep(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("apim-request-id", fmt.Sprintf("azopenaitest-%d", time.Now().UnixNano()))
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, e Error) {
+	if e.RetryAfter > 0 {
+		w.Header().Set("retry-after-ms", fmt.Sprint(e.RetryAfter.Milliseconds()))
+		w.Header().Set("Retry-After", fmt.Sprint(int((e.RetryAfter+time.Second-1)/time.Second)))
+	}
+	body := map[string]any{"code": e.Code, "message": e.Message}
+	if e.ContentFilter != nil {
+		body["innererror"] = map[string]any{
+			"code":                  "ResponsibleAIPolicyViolation",
+			"content_filter_result": e.ContentFilter,
+		}
+	}
+	writeJSON(w, e.Status, map[string]any{"error": body})
+}
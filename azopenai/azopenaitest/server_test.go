@@ -0,0 +1,292 @@
+// Copyright 2025 herosizy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package azopenaitest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/ai/azopenai"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+)
+
+func newClient(t *testing.T, s *Server) *azopenai.Client {
+	t.Helper()
+	client, err := azopenai.NewClientWithKeyCredential(s.URL, azcore.NewKeyCredential("test-key"), &azopenai.ClientOptions{
+		ClientOptions: azcore.ClientOptions{
+			Transport: s.Client(),
+			Retry:     policy.RetryOptions{MaxRetries: -1},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	return client
+}
+
+func userMessage(text string) []azopenai.ChatRequestMessageClassification {
+	return []azopenai.ChatRequestMessageClassification{
+		&azopenai.ChatRequestUserMessage{Content: azopenai.NewChatRequestUserMessageContent(text)},
+	}
+}
+
+func TestServer_Chat(t *testing.T) {
+	s := NewServer(t)
+	s.QueueChat(ChatReply{
+		Content:       "Hello!",
+		PromptFilter:  map[string]Filter{"hate": {Severity: "safe"}},
+		ContentFilter: map[string]Filter{"violence": {Severity: "low"}},
+		Usage:         &Usage{PromptTokens: 9, CompletionTokens: 2},
+	})
+
+	resp, err := newClient(t, s).GetChatCompletions(context.Background(), azopenai.ChatCompletionsOptions{
+		DeploymentName: to.Ptr("gpt-4o"),
+		Messages:       userMessage("Hi"),
+	}, nil)
+	if err != nil {
+		t.Fatalf("GetChatCompletions() error: %v", err)
+	}
+	choice := resp.Choices[0]
+	if got := *choice.Message.Content; got != "Hello!" {
+		t.Errorf("Content = %q", got)
+	}
+	if *choice.FinishReason != azopenai.CompletionsFinishReasonStopped {
+		t.Errorf("FinishReason = %q", *choice.FinishReason)
+	}
+	if *resp.Usage.TotalTokens != 11 {
+		t.Errorf("TotalTokens = %d, want 11", *resp.Usage.TotalTokens)
+	}
+	if *choice.ContentFilterResults.Violence.Severity != azopenai.ContentFilterSeverityLow {
+		t.Errorf("Unexpected completion filter %+v", choice.ContentFilterResults.Violence)
+	}
+	if len(resp.PromptFilterResults) != 1 {
+		t.Errorf("Expected prompt filter results, got %d", len(resp.PromptFilterResults))
+	}
+
+	reqs := s.Requests()
+	if len(reqs) != 1 || reqs[0].Endpoint != EndpointChat || reqs[0].Deployment != "gpt-4o" {
+		t.Fatalf("Unexpected requests %+v", reqs)
+	}
+	if reqs[0].JSON()["messages"] == nil {
+		t.Error("Request body should be recorded")
+	}
+}
+
+func TestServer_ChatStreamWithToolCalls(t *testing.T) {
+	s := NewServer(t)
+	s.QueueChat(ChatReply{
+		Chunks:    []string{"Let me ", "check."},
+		ToolCalls: []ToolCall{{Name: "get_weather", Arguments: `{"city":"Paris"}`}},
+	})
+
+	resp, err := newClient(t, s).GetChatCompletionsStream(context.Background(), azopenai.ChatCompletionsStreamOptions{
+		DeploymentName: to.Ptr("gpt-4o"),
+		Messages:       userMessage("Weather in Paris?"),
+		StreamOptions:  &azopenai.ChatCompletionStreamOptions{IncludeUsage: to.Ptr(true)},
+	}, nil)
+	if err != nil {
+		t.Fatalf("GetChatCompletionsStream() error: %v", err)
+	}
+	defer resp.ChatCompletionsStream.Close()
+
+	var content, name, args string
+	var finish azopenai.CompletionsFinishReason
+	var usage *azopenai.CompletionsUsage
+	for {
+		chunk, err := resp.ChatCompletionsStream.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Read() error: %v", err)
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+		}
+		for _, c := range chunk.Choices {
+			if c.Delta.Content != nil {
+				content += *c.Delta.Content
+			}
+			for _, tc := range c.Delta.ToolCalls {
+				fn := tc.(*azopenai.ChatCompletionsFunctionToolCall).Function
+				if fn.Name != nil {
+					name += *fn.Name
+				}
+				if fn.Arguments != nil {
+					args += *fn.Arguments
+				}
+			}
+			if c.FinishReason != nil {
+				finish = *c.FinishReason
+			}
+		}
+	}
+
+	if content != "Let me check." {
+		t.Errorf("Content = %q", content)
+	}
+	if name != "get_weather" || args != `{"city":"Paris"}` {
+		t.Errorf("Tool call = %s(%s)", name, args)
+	}
+	if finish != azopenai.CompletionsFinishReasonToolCalls {
+		t.Errorf("FinishReason = %q", finish)
+	}
+	if usage == nil {
+		t.Error("Expected a usage chunk when include_usage is set")
+	}
+}
+
+func TestServer_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    Error
+		status int
+		code   string
+		header string
+	}{
+		{"rate limit", RateLimit(1500 * time.Millisecond), http.StatusTooManyRequests, "429", "2"},
+		{"content filter", ContentFiltered(map[string]Filter{"hate": {Filtered: true, Severity: "high"}}), http.StatusBadRequest, "content_filter", ""},
+		{"deployment not found", DeploymentNotFound(), http.StatusNotFound, "DeploymentNotFound", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewServer(t)
+			s.QueueError(EndpointChat, tt.err)
+			s.QueueChat(ChatReply{Content: "after the error"})
+			client := newClient(t, s)
+
+			_, err := client.GetChatCompletions(context.Background(), azopenai.ChatCompletionsOptions{
+				DeploymentName: to.Ptr("gpt-4o"),
+				Messages:       userMessage("Hi"),
+			}, nil)
+			var respErr *azcore.ResponseError
+			if !errors.As(err, &respErr) {
+				t.Fatalf("Expected *azcore.ResponseError, got %v", err)
+			}
+			if respErr.StatusCode != tt.status || respErr.ErrorCode != tt.code {
+				t.Errorf("Got status %d code %q, want %d %q", respErr.StatusCode, respErr.ErrorCode, tt.status, tt.code)
+			}
+			if got := respErr.RawResponse.Header.Get("Retry-After"); got != tt.header {
+				t.Errorf("Retry-After = %q, want %q", got, tt.header)
+			}
+
+			// The next queued reply is served once the error is consumed
+			resp, err := client.GetChatCompletions(context.Background(), azopenai.ChatCompletionsOptions{
+				DeploymentName: to.Ptr("gpt-4o"),
+				Messages:       userMessage("Hi"),
+			}, nil)
+			if err != nil || *resp.Choices[0].Message.Content != "after the error" {
+				t.Errorf("Expected the queued reply after the error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestServer_NoReplyQueued(t *testing.T) {
+	s := NewServer(t)
+	_, err := newClient(t, s).GetChatCompletions(context.Background(), azopenai.ChatCompletionsOptions{
+		DeploymentName: to.Ptr("gpt-4o"),
+		Messages:       userMessage("Hi"),
+	}, nil)
+	if err == nil {
+		t.Fatal("Expected an error when no reply is queued")
+	}
+
+	s.OnChat(func(r Request) ChatReply { return ChatReply{Content: "from " + r.Deployment} })
+	resp, err := newClient(t, s).GetChatCompletions(context.Background(), azopenai.ChatCompletionsOptions{
+		DeploymentName: to.Ptr("gpt-4o"),
+		Messages:       userMessage("Hi"),
+	}, nil)
+	if err != nil || *resp.Choices[0].Message.Content != "from gpt-4o" {
+		t.Errorf("Expected the OnChat reply, got %v", err)
+	}
+}
+
+func TestServer_Embeddings(t *testing.T) {
+	s := NewServer(t)
+	client := newClient(t, s)
+	embed := func(inputs ...string) [][]float32 {
+		resp, err := client.GetEmbeddings(context.Background(), azopenai.EmbeddingsOptions{
+			DeploymentName: to.Ptr("text-embedding-3-small"),
+			Input:          inputs,
+		}, nil)
+		if err != nil {
+			t.Fatalf("GetEmbeddings() error: %v", err)
+		}
+		out := make([][]float32, len(resp.Data))
+		for i, d := range resp.Data {
+			out[i] = d.Embedding
+		}
+		return out
+	}
+
+	first := embed("hello", "world")
+	if len(first) != 2 || len(first[0]) != DefaultEmbeddingDimensions {
+		t.Fatalf("Unexpected embeddings %v", first)
+	}
+	if again := embed("hello"); again[0][0] != first[0][0] {
+		t.Error("Embeddings should be deterministic")
+	}
+
+	s.OnEmbed(func(string) []float32 { return []float32{1, 2, 3} })
+	if got := embed("custom"); len(got[0]) != 3 {
+		t.Errorf("OnEmbed vectors should be used, got %v", got)
+	}
+}
+
+func TestServer_Images(t *testing.T) {
+	s := NewServer(t)
+	s.QueueImages(ImageReply{URL: "https://example.com/cat.png"})
+	client := newClient(t, s)
+
+	resp, err := client.GetImageGenerations(context.Background(), azopenai.ImageGenerationOptions{
+		DeploymentName: to.Ptr("dall-e-3"),
+		Prompt:         to.Ptr("a cat"),
+	}, nil)
+	if err != nil {
+		t.Fatalf("GetImageGenerations() error: %v", err)
+	}
+	if got := *resp.Data[0].URL; got != "https://example.com/cat.png" {
+		t.Errorf("URL = %q", got)
+	}
+	if got := *resp.Data[0].RevisedPrompt; got != "a cat" {
+		t.Errorf("RevisedPrompt = %q", got)
+	}
+
+	resp, err = client.GetImageGenerations(context.Background(), azopenai.ImageGenerationOptions{
+		DeploymentName: to.Ptr("dall-e-3"),
+		Prompt:         to.Ptr("a dog"),
+		ResponseFormat: to.Ptr(azopenai.ImageGenerationResponseFormatBase64),
+	}, nil)
+	if err != nil {
+		t.Fatalf("GetImageGenerations() error: %v", err)
+	}
+	if resp.Data[0].Base64Data == nil || *resp.Data[0].Base64Data == "" {
+		t.Error("Expected base64 image data")
+	}
+}
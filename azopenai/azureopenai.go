@@ -25,6 +25,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"slices"
 	"sync"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/ai/azopenai"
@@ -47,9 +48,34 @@ type AzureOpenAI struct {
 	APIKey   string // API key to access the service. If empty, the value of the environment variable AZURE_OPEN_AI_API_KEY will be consulted.
 	Endpoint string // Azure OpenAI endpoint. If empty, the value of the environment variable AZURE_OPEN_AI_ENDPOINT will be consulted.
 
-	client  *azopenai.Client // Client for the Azure OpenAI service.
-	mu      sync.Mutex       // Mutex to control access.
-	initted bool             // Whether the plugin has been initialized.
+	Transport policy.Transporter // HTTP transport for the client. If nil, the Azure SDK default is used.
+	Telemetry *TelemetryOptions  // OpenTelemetry configuration. If nil, the global providers are used without content capture.
+
+	Client           Client             // Client used by models and embedders. If nil, an Azure SDK client is built from APIKey, Endpoint and Transport.
+	ClientMiddleware []ClientMiddleware // Wrappers applied around the client, outermost first.
+	Middleware       []Middleware       // Wrappers around every chat and embed handler, outermost first.
+	Cache            *CacheOptions      // Response caching for chat models. If nil, responses are not cached.
+	SemanticCache    *SemanticCache     // Similarity-based response caching for chat models. If nil, it is disabled.
+	Responses        *ResponsesOptions  // Models served by the Responses API instead of chat completions. If nil, none are.
+	Pricing          map[string]Price   // Prices by deployment or model name, overriding DefaultPricing, e.g. for negotiated rates.
+	CostTracker      *CostTracker       // Accumulates the estimated cost of calls. If nil, costs are only attached to responses.
+	Budget           *BudgetOptions     // Token and spend budgets for chat models. If nil, requests are not limited.
+	Hedge            *HedgeOptions      // Hedged non-streaming chat requests to cut tail latency. If nil, requests are not hedged.
+	Concurrency      *ConcurrencyLimits // Per-deployment concurrency limits with a priority wait queue. If nil, requests are not limited.
+
+	FallbackModels    map[string]FallbackChain // Models that retry failed requests, keyed by the name of the model that failed.
+	CompletionsModels []string                 // Models served by the legacy completions endpoint besides the built-in instruct models, e.g. ones added with DefineModel.
+
+	client     Client            // Client for the Azure OpenAI service.
+	batch      BatchClient       // Client for batch jobs, if the configured client supports them.
+	responses  *responsesBackend // Backend for models served by the Responses API.
+	telemetry  *telemetry        // Instrumentation for model and embedder calls.
+	costs      *costEstimator    // Pricing and cost tracking for model and embedder calls.
+	hedge      *hedger           // Sender of hedged chat requests, if hedging is enabled.
+	limits     *limiter          // Per-deployment concurrency limits, if configured.
+	middleware []Middleware      // User middleware followed by built-in middleware such as caching.
+	mu         sync.Mutex        // Mutex to control access.
+	initted    bool              // Whether the plugin has been initialized.
 }
 
 // Name returns the name of the plugin.
@@ -75,55 +101,149 @@ func (az *AzureOpenAI) Init(ctx context.Context, g *genkit.Genkit) (err error) {
 		}
 	}()
 
-	apiKey := az.APIKey
+	client := az.Client
+	if client == nil {
+		if client, err = az.newClient(); err != nil {
+			return err
+		}
+	}
+	az.client = wrapClient(client, az.ClientMiddleware)
+	az.batch, _ = az.client.(BatchClient)
+	if az.Responses != nil {
+		if az.responses, err = az.newResponsesBackend(client); err != nil {
+			return err
+		}
+	}
+	az.telemetry = newTelemetry(az.Telemetry)
+	if az.Concurrency != nil {
+		az.limits = newLimiter(*az.Concurrency, az.telemetry)
+	}
+	if az.Hedge != nil {
+		az.hedge = newHedger(*az.Hedge, az.client, az.ClientMiddleware, az.limits)
+	}
+	az.costs = &costEstimator{pricing: az.Pricing, tracker: az.CostTracker}
+	az.middleware = append([]Middleware(nil), az.Middleware...)
+	if len(az.FallbackModels) > 0 {
+		// Outermost built-in, so each fallback model has its own caching and budgets
+		az.middleware = append(az.middleware, fallbackMiddleware(g, az.FallbackModels))
+	}
+	if az.SemanticCache != nil {
+		az.middleware = append(az.middleware, az.SemanticCache.middleware())
+	}
+	if az.Cache != nil {
+		// After user middleware, so the key reflects the request they produce
+		az.middleware = append(az.middleware, cacheMiddleware(*az.Cache))
+	}
+	if az.Budget != nil {
+		// Innermost, so cache hits are not charged
+		az.middleware = append(az.middleware, budgetMiddleware(g, *az.Budget, az.costs))
+	}
+
+	// Resolve everything that can fail before registering anything
+	models, err := listModels()
+	if err != nil {
+		return err
+	}
+	embeddingModels, err := listEmbedders()
+	if err != nil {
+		return err
+	}
+	if az.SemanticCache != nil && !slices.Contains(embeddingModels, az.SemanticCache.opts.Embedder) {
+		return fmt.Errorf("semantic cache embedder %q is not defined", az.SemanticCache.opts.Embedder)
+	}
+
+	// Register all supported models
+	for name, modelInfo := range models {
+		defineModel(g, az.handlerConfig(), name, modelInfo)
+	}
+
+	// Register embedding models
+	for _, name := range embeddingModels {
+		defineEmbedder(g, az.handlerConfig(), name)
+	}
+
+	if az.SemanticCache != nil {
+		az.SemanticCache.bind(genkit.LookupEmbedder(g, azureOpenAIProvider, az.SemanticCache.opts.Embedder))
+	}
+
+	az.initted = true
+	return nil
+}
+
+// handlerConfig returns the settings shared by the plugin's models and embedders.
+func (az *AzureOpenAI) handlerConfig() handlerConfig {
+	return handlerConfig{
+		client:      az.client,
+		telemetry:   az.telemetry,
+		middleware:  az.middleware,
+		responses:   az.responses,
+		completions: az.CompletionsModels,
+		costs:       az.costs,
+		hedge:       az.hedge,
+		limits:      az.limits,
+	}
+}
+
+// credentials returns the API key and endpoint, falling back to the environment.
+func (az *AzureOpenAI) credentials() (apiKey, endpoint string, err error) {
+	apiKey = az.APIKey
 	if apiKey == "" {
 		apiKey = os.Getenv("AZURE_OPEN_AI_API_KEY")
 		if apiKey == "" {
-			return fmt.Errorf("Azure OpenAI requires setting AZURE_OPEN_AI_API_KEY in the environment")
+			return "", "", fmt.Errorf("Azure OpenAI requires setting AZURE_OPEN_AI_API_KEY in the environment")
 		}
 	}
 
-	endpoint := az.Endpoint
+	endpoint = az.Endpoint
 	if endpoint == "" {
 		endpoint = os.Getenv("AZURE_OPEN_AI_ENDPOINT")
 		if endpoint == "" {
-			return fmt.Errorf("Azure OpenAI requires setting AZURE_OPEN_AI_ENDPOINT in the environment")
+			return "", "", fmt.Errorf("Azure OpenAI requires setting AZURE_OPEN_AI_ENDPOINT in the environment")
 		}
 	}
+	return apiKey, endpoint, nil
+}
+
+// newClient builds an Azure SDK client from the plugin's credentials and transport.
+func (az *AzureOpenAI) newClient() (*azopenai.Client, error) {
+	apiKey, endpoint, err := az.credentials()
+	if err != nil {
+		return nil, err
+	}
 
 	client, err := azopenai.NewClientWithKeyCredential(endpoint, azcore.NewKeyCredential(apiKey), &azopenai.ClientOptions{
 		ClientOptions: azcore.ClientOptions{
 			Telemetry: policy.TelemetryOptions{
 				Disabled: false,
 			},
+			Transport: az.Transport,
 		},
 	})
 	if err != nil {
-		return err
-	}
-	az.client = client
-	az.initted = true
-
-	models, err := listModels()
-	if err != nil {
-		return err
+		return nil, err
 	}
+	return client, nil
+}
 
-	// Register all supported models
-	for name, modelInfo := range models {
-		defineModel(g, az.client, name, modelInfo)
+// newResponsesBackend selects the Responses API client: the configured one,
+// the plugin client if it implements [ResponsesClient], or a client built
+// from the plugin's credentials and transport.
+func (az *AzureOpenAI) newResponsesBackend(client Client) (*responsesBackend, error) {
+	rc := az.Responses.Client
+	if rc == nil {
+		rc, _ = client.(ResponsesClient)
 	}
-
-	// Register embedding models
-	embeddingModels, err := listEmbedders()
-	if err != nil {
-		return err
-	}
-	for _, name := range embeddingModels {
-		defineEmbedder(g, az.client, name)
+	if rc == nil {
+		if az.Client != nil {
+			return nil, errors.New("Responses.Client is required when a custom Client does not implement ResponsesClient")
+		}
+		apiKey, endpoint, err := az.credentials()
+		if err != nil {
+			return nil, err
+		}
+		rc = newResponsesClient(endpoint, apiKey, az.Transport)
 	}
-
-	return nil
+	return newResponsesBackend(*az.Responses, rc), nil
 }
 
 // DefineModel defines an unknown model with the given name.
@@ -152,7 +272,7 @@ func (az *AzureOpenAI) DefineModel(g *genkit.Genkit, name string, info *ai.Model
 		mi = *info
 	}
 
-	return defineModel(g, az.client, name, mi), nil
+	return defineModel(g, az.handlerConfig(), name, mi), nil
 }
 
 // Model returns a reference to the named model.
@@ -166,8 +286,16 @@ func ModelRef(name string, config *OpenAIConfig) ai.ModelRef {
 }
 
 // DefineModel allows users to define a custom model configuration.
+// The model uses the client of the AzureOpenAI plugin registered with
+// [genkit.WithPlugins]; without one, calls to the model return an error.
 func DefineModel(g *genkit.Genkit, name string, info *ai.ModelInfo) ai.Model {
-	return defineModel(g, nil, name, *info)
+	var hc handlerConfig
+	if az, ok := genkit.LookupPlugin(g, azureOpenAIProvider).(*AzureOpenAI); ok {
+		az.mu.Lock()
+		hc = az.handlerConfig()
+		az.mu.Unlock()
+	}
+	return defineModel(g, hc, name, *info)
 }
 
 // IsDefinedModel checks if a model is already defined.
@@ -204,7 +332,7 @@ func (a *AzureOpenAI) DefineEmbedder(g *genkit.Genkit, name string) (ai.Embedder
 	if !IsDefinedEmbedder(name) {
 		return nil, fmt.Errorf("embedder %s is not supported", name)
 	}
-	return defineEmbedder(g, a.client, name), nil
+	return defineEmbedder(g, a.handlerConfig(), name), nil
 }
 
 // IsDefinedEmbedder reports whether the named Embedder is defined by this plugin instance.
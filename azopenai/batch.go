@@ -0,0 +1,533 @@
+// Copyright 2025 herosizy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package azopenai
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/ai/azopenai"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/core"
+	"github.com/firebase/genkit/go/genkit"
+)
+
+// BatchClient is the subset of the Azure OpenAI API used by batch jobs.
+// [*azopenai.Client] implements it; a custom AzureOpenAI.Client and the clients
+// returned by AzureOpenAI.ClientMiddleware must implement it too for the batch
+// methods to be available.
+type BatchClient interface {
+	UploadFile(ctx context.Context, file io.ReadSeekCloser, purpose azopenai.FilePurpose, options *azopenai.UploadFileOptions) (azopenai.UploadFileResponse, error)
+	CreateBatch(ctx context.Context, createBatchRequest azopenai.BatchCreateRequest, options *azopenai.CreateBatchOptions) (azopenai.CreateBatchResponse, error)
+	GetBatch(ctx context.Context, batchID string, options *azopenai.GetBatchOptions) (azopenai.GetBatchResponse, error)
+	CancelBatch(ctx context.Context, batchID string, options *azopenai.CancelBatchOptions) (azopenai.CancelBatchResponse, error)
+	GetFileContent(ctx context.Context, fileID string, options *azopenai.GetFileContentOptions) (azopenai.GetFileContentResponse, error)
+}
+
+var _ BatchClient = (*azopenai.Client)(nil)
+
+const (
+	batchEndpoint                = "/chat/completions"
+	defaultBatchCompletionWindow = "24h"
+	defaultBatchPollInterval     = 30 * time.Second
+)
+
+// BatchRequest is a chat request submitted as part of a batch job.
+type BatchRequest struct {
+	CustomID string           `json:"customId,omitempty"` // Identifies the request in the results. Defaults to "request-<index>".
+	Request  *ai.ModelRequest `json:"request"`            // Chat request; an OpenAIConfig in Request.Config is honored
+}
+
+// BatchOptions configures a batch job.
+type BatchOptions struct {
+	DeploymentName   string            `json:"deploymentName"`             // Global batch deployment that runs every request (required)
+	Model            string            `json:"model,omitempty"`            // Model the deployment serves, such as Gpt4o. Its token limits drive truncation.
+	CompletionWindow string            `json:"completionWindow,omitempty"` // Time frame for processing. Defaults to "24h".
+	Metadata         map[string]string `json:"metadata,omitempty"`         // Key-value pairs attached to the job
+}
+
+// BatchJob is the state of a batch job.
+type BatchJob struct {
+	ID           string   `json:"id"`
+	Status       string   `json:"status"`
+	InputFileID  string   `json:"inputFileId,omitempty"`
+	OutputFileID string   `json:"outputFileId,omitempty"` // File with successful results, once available
+	ErrorFileID  string   `json:"errorFileId,omitempty"`  // File with failed requests, once available
+	Total        int      `json:"total"`
+	Completed    int      `json:"completed"`
+	Failed       int      `json:"failed"`
+	Errors       []string `json:"errors,omitempty"` // Validation errors reported for the job
+}
+
+// Done reports whether the job has reached a terminal status.
+func (j *BatchJob) Done() bool {
+	switch azopenai.BatchStatus(j.Status) {
+	case azopenai.BatchStatusCompleted, azopenai.BatchStatusFailed, azopenai.BatchStatusExpired, azopenai.BatchStatusCancelled:
+		return true
+	}
+	return false
+}
+
+// BatchResult is the outcome of one request in a batch job.
+type BatchResult struct {
+	CustomID string            `json:"customId"`
+	Response *ai.ModelResponse `json:"response,omitempty"` // Converted response for successful requests
+	Error    string            `json:"error,omitempty"`    // Failure reason for unsuccessful requests
+}
+
+// batchInputLine is one line of the JSONL input file
+type batchInputLine struct {
+	CustomID string          `json:"custom_id"`
+	Method   string          `json:"method"`
+	URL      string          `json:"url"`
+	Body     json.RawMessage `json:"body"`
+}
+
+// batchOutputLine is one line of the JSONL output or error file
+type batchOutputLine struct {
+	CustomID string `json:"custom_id"`
+	Response *struct {
+		StatusCode int             `json:"status_code"`
+		Body       json.RawMessage `json:"body"`
+	} `json:"response"`
+	Error *batchLineError `json:"error"`
+}
+
+type batchLineError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *batchLineError) String() string {
+	if e.Code == "" {
+		return e.Message
+	}
+	return e.Code + ": " + e.Message
+}
+
+// batchClient returns the client used for batch jobs
+func (az *AzureOpenAI) batchClient() (BatchClient, error) {
+	az.mu.Lock()
+	defer az.mu.Unlock()
+	if !az.initted {
+		return nil, errors.New("AzureOpenAI plugin not initialized")
+	}
+	if az.batch == nil {
+		return nil, errors.New("azopenai: the configured client does not implement BatchClient")
+	}
+	return az.batch, nil
+}
+
+// SubmitBatch converts reqs to a JSONL file, uploads it and creates a batch job.
+// Batch jobs go through ClientMiddleware but bypass Middleware and caching.
+func (az *AzureOpenAI) SubmitBatch(ctx context.Context, reqs []BatchRequest, opts BatchOptions) (*BatchJob, error) {
+	client, err := az.batchClient()
+	if err != nil {
+		return nil, err
+	}
+	if opts.DeploymentName == "" {
+		return nil, errors.New("azopenai: BatchOptions.DeploymentName is required")
+	}
+	input, err := buildBatchInput(ctx, reqs, opts.Model, opts.DeploymentName)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := client.UploadFile(ctx, nopCloser{bytes.NewReader(input)}, azopenai.FilePurposeBatch, &azopenai.UploadFileOptions{
+		Filename: to.Ptr("batch.jsonl"),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload batch input: %w", mapAzureError(err))
+	}
+
+	window := opts.CompletionWindow
+	if window == "" {
+		window = defaultBatchCompletionWindow
+	}
+	var metadata map[string]*string
+	for k, v := range opts.Metadata {
+		if metadata == nil {
+			metadata = map[string]*string{}
+		}
+		metadata[k] = to.Ptr(v)
+	}
+	resp, err := client.CreateBatch(ctx, azopenai.BatchCreateRequest{
+		CompletionWindow: to.Ptr(window),
+		Endpoint:         to.Ptr(batchEndpoint),
+		InputFileID:      file.ID,
+		Metadata:         metadata,
+	}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create batch: %w", mapAzureError(err))
+	}
+	return convertBatch(resp.Batch), nil
+}
+
+// GetBatch returns the current state of a batch job.
+func (az *AzureOpenAI) GetBatch(ctx context.Context, id string) (*BatchJob, error) {
+	client, err := az.batchClient()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.GetBatch(ctx, id, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get batch: %w", mapAzureError(err))
+	}
+	return convertBatch(resp.Batch), nil
+}
+
+// CancelBatch cancels a batch job.
+func (az *AzureOpenAI) CancelBatch(ctx context.Context, id string) (*BatchJob, error) {
+	client, err := az.batchClient()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.CancelBatch(ctx, id, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to cancel batch: %w", mapAzureError(err))
+	}
+	return convertBatch(resp.Batch), nil
+}
+
+// WaitBatch polls a batch job until it reaches a terminal status or ctx is done.
+// A zero pollInterval polls every 30 seconds.
+func (az *AzureOpenAI) WaitBatch(ctx context.Context, id string, pollInterval time.Duration) (*BatchJob, error) {
+	if pollInterval <= 0 {
+		pollInterval = defaultBatchPollInterval
+	}
+	for {
+		job, err := az.GetBatch(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if job.Done() {
+			return job, nil
+		}
+		select {
+		case <-ctx.Done():
+			return job, ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// BatchResults downloads the output and error files of a finished job and
+// converts each line to a [BatchResult], in file order.
+func (az *AzureOpenAI) BatchResults(ctx context.Context, job *BatchJob) ([]BatchResult, error) {
+	client, err := az.batchClient()
+	if err != nil {
+		return nil, err
+	}
+	var results []BatchResult
+	for _, fileID := range []string{job.OutputFileID, job.ErrorFileID} {
+		if fileID == "" {
+			continue
+		}
+		content, err := fileContent(ctx, client, fileID)
+		if err != nil {
+			return nil, err
+		}
+		lines, err := parseBatchOutput(content)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, lines...)
+	}
+	return results, nil
+}
+
+// RunBatch submits reqs, waits for the job to finish and returns the results
+// in the order of reqs.
+func (az *AzureOpenAI) RunBatch(ctx context.Context, reqs []BatchRequest, opts BatchOptions, pollInterval time.Duration) ([]BatchResult, error) {
+	job, err := az.SubmitBatch(ctx, reqs, opts)
+	if err != nil {
+		return nil, err
+	}
+	if job, err = az.WaitBatch(ctx, job.ID, pollInterval); err != nil {
+		return nil, err
+	}
+	if azopenai.BatchStatus(job.Status) != azopenai.BatchStatusCompleted {
+		return nil, fmt.Errorf("azopenai: batch %s ended with status %s", job.ID, job.Status)
+	}
+	results, err := az.BatchResults(ctx, job)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[string]BatchResult, len(results))
+	for _, r := range results {
+		byID[r.CustomID] = r
+	}
+	ordered := make([]BatchResult, len(reqs))
+	for i, req := range reqs {
+		id := batchCustomID(req, i)
+		r, ok := byID[id]
+		if !ok {
+			r = BatchResult{CustomID: id, Error: "no result returned for request"}
+		}
+		ordered[i] = r
+	}
+	return ordered, nil
+}
+
+// SubmitBatchInput is the input of the submit batch flow.
+type SubmitBatchInput struct {
+	Requests []BatchRequest `json:"requests"`
+	Options  BatchOptions   `json:"options"`
+}
+
+// BatchFlows holds the flows registered by [AzureOpenAI.DefineBatchFlows].
+type BatchFlows struct {
+	Submit  *core.Flow[SubmitBatchInput, *BatchJob, struct{}] // azureopenai/submitBatch
+	Get     *core.Flow[string, *BatchJob, struct{}]           // azureopenai/getBatch
+	Results *core.Flow[string, []BatchResult, struct{}]       // azureopenai/batchResults
+}
+
+// DefineBatchFlows registers flows for submitting batch jobs, checking their
+// status and fetching their results: azureopenai/submitBatch,
+// azureopenai/getBatch and azureopenai/batchResults.
+func (az *AzureOpenAI) DefineBatchFlows(g *genkit.Genkit) *BatchFlows {
+	return &BatchFlows{
+		Submit: genkit.DefineFlow(g, azureOpenAIProvider+"/submitBatch", func(ctx context.Context, in SubmitBatchInput) (*BatchJob, error) {
+			return az.SubmitBatch(ctx, in.Requests, in.Options)
+		}),
+		Get: genkit.DefineFlow(g, azureOpenAIProvider+"/getBatch", func(ctx context.Context, id string) (*BatchJob, error) {
+			return az.GetBatch(ctx, id)
+		}),
+		Results: genkit.DefineFlow(g, azureOpenAIProvider+"/batchResults", func(ctx context.Context, id string) ([]BatchResult, error) {
+			job, err := az.GetBatch(ctx, id)
+			if err != nil {
+				return nil, err
+			}
+			if !job.Done() {
+				return nil, fmt.Errorf("azopenai: batch %s is still %s", job.ID, job.Status)
+			}
+			return az.BatchResults(ctx, job)
+		}),
+	}
+}
+
+// buildBatchInput converts requests for model to the JSONL batch input format
+func buildBatchInput(ctx context.Context, reqs []BatchRequest, model, deployment string) ([]byte, error) {
+	if len(reqs) == 0 {
+		return nil, errors.New("azopenai: batch has no requests")
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	seen := make(map[string]bool, len(reqs))
+	for i, req := range reqs {
+		id := batchCustomID(req, i)
+		if seen[id] {
+			return nil, fmt.Errorf("azopenai: duplicate batch custom ID %q", id)
+		}
+		seen[id] = true
+		if req.Request == nil {
+			return nil, fmt.Errorf("azopenai: batch request %q has no request", id)
+		}
+
+		cfg, err := requestConfig(req.Request)
+		if err != nil {
+			return nil, fmt.Errorf("azopenai: batch request %q: %w", id, err)
+		}
+		cfg.DeploymentName = deployment
+		options, err := convertToAzureOpenAIRequest(ctx, model, req.Request, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("azopenai: batch request %q: %w", id, err)
+		}
+		body, err := marshalChatRequest(&options)
+		if err != nil {
+			return nil, err
+		}
+		if err := enc.Encode(batchInputLine{CustomID: id, Method: http.MethodPost, URL: batchEndpoint, Body: body}); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// marshalChatRequest encodes options in the chat completions wire format.
+// The SDK only implements it for its internal request type, so the fields
+// are mapped here under the same JSON names.
+func marshalChatRequest(options *azopenai.ChatCompletionsOptions) ([]byte, error) {
+	fields := map[string]any{
+		"model":                 options.DeploymentName,
+		"messages":              options.Messages,
+		"data_sources":          options.AzureExtensionsOptions,
+		"frequency_penalty":     options.FrequencyPenalty,
+		"logit_bias":            options.LogitBias,
+		"logprobs":              options.LogProbs,
+		"max_completion_tokens": options.MaxCompletionTokens,
+		"max_tokens":            options.MaxTokens,
+		"metadata":              options.Metadata,
+		"n":                     options.N,
+		"parallel_tool_calls":   options.ParallelToolCalls,
+		"prediction":            options.Prediction,
+		"presence_penalty":      options.PresencePenalty,
+		"reasoning_effort":      options.ReasoningEffort,
+		"response_format":       options.ResponseFormat,
+		"seed":                  options.Seed,
+		"stop":                  options.Stop,
+		"store":                 options.Store,
+		"temperature":           options.Temperature,
+		"tool_choice":           options.ToolChoice,
+		"tools":                 options.Tools,
+		"top_logprobs":          options.TopLogProbs,
+		"top_p":                 options.TopP,
+		"user":                  options.User,
+	}
+	for k, v := range fields {
+		if rv := reflect.ValueOf(v); !rv.IsValid() || rv.IsZero() {
+			delete(fields, k)
+		}
+	}
+	return json.Marshal(fields)
+}
+
+// parseBatchOutput converts JSONL output or error file lines to results
+func parseBatchOutput(content []byte) ([]BatchResult, error) {
+	var results []BatchResult
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var line batchOutputLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			return nil, fmt.Errorf("azopenai: decoding batch output: %w", err)
+		}
+		results = append(results, convertBatchLine(line))
+	}
+	return results, scanner.Err()
+}
+
+func convertBatchLine(line batchOutputLine) BatchResult {
+	result := BatchResult{CustomID: line.CustomID}
+	switch {
+	case line.Error != nil:
+		result.Error = line.Error.String()
+	case line.Response == nil:
+		result.Error = "no response"
+	case line.Response.StatusCode != http.StatusOK:
+		var envelope struct {
+			Error batchLineError `json:"error"`
+		}
+		_ = json.Unmarshal(line.Response.Body, &envelope)
+		result.Error = fmt.Sprintf("status %d", line.Response.StatusCode)
+		if msg := envelope.Error.String(); msg != "" {
+			result.Error += ": " + msg
+		}
+	default:
+		var completions azopenai.ChatCompletions
+		if err := json.Unmarshal(line.Response.Body, &completions); err != nil {
+			result.Error = err.Error()
+			break
+		}
+		resp, err := convertChatCompletions(completions)
+		if err != nil {
+			result.Error = err.Error()
+			break
+		}
+		result.Response = resp
+	}
+	return result
+}
+
+// fileContent downloads a file. The SDK decodes file content as base64, which
+// fails for JSONL files, so the raw payload is read from the captured response.
+func fileContent(ctx context.Context, client BatchClient, fileID string) ([]byte, error) {
+	var raw *http.Response
+	resp, err := client.GetFileContent(policy.WithCaptureResponse(ctx, &raw), fileID, nil)
+	if err == nil {
+		return resp.Value, nil
+	}
+	if raw != nil && raw.StatusCode == http.StatusOK {
+		return runtime.Payload(raw)
+	}
+	return nil, fmt.Errorf("failed to download file %s: %w", fileID, mapAzureError(err))
+}
+
+func convertBatch(b azopenai.Batch) *BatchJob {
+	job := &BatchJob{
+		ID:           deref(b.ID),
+		Status:       string(deref(b.Status)),
+		InputFileID:  deref(b.InputFileID),
+		OutputFileID: deref(b.OutputFileID),
+		ErrorFileID:  deref(b.ErrorFileID),
+	}
+	if c := b.RequestCounts; c != nil {
+		job.Total = int(deref(c.Total))
+		job.Completed = int(deref(c.Completed))
+		job.Failed = int(deref(c.Failed))
+	}
+	if b.Errors != nil {
+		for _, e := range b.Errors.Data {
+			job.Errors = append(job.Errors, deref(e.Message))
+		}
+	}
+	return job
+}
+
+func batchCustomID(req BatchRequest, i int) string {
+	if req.CustomID != "" {
+		return req.CustomID
+	}
+	return fmt.Sprintf("request-%d", i)
+}
+
+// requestConfig returns the OpenAIConfig of mr, decoding it from JSON form if needed
+func requestConfig(mr *ai.ModelRequest) (OpenAIConfig, error) {
+	var cfg OpenAIConfig
+	switch c := mr.Config.(type) {
+	case nil:
+	case *OpenAIConfig:
+		cfg = *c
+	case OpenAIConfig:
+		cfg = c
+	default:
+		b, err := json.Marshal(c)
+		if err != nil {
+			return cfg, err
+		}
+		if err := json.Unmarshal(b, &cfg); err != nil {
+			return cfg, fmt.Errorf("invalid config: %w", err)
+		}
+	}
+	return cfg, nil
+}
+
+// nopCloser adds a no-op Close to a ReadSeeker
+type nopCloser struct {
+	io.ReadSeeker
+}
+
+func (nopCloser) Close() error { return nil }
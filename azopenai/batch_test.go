@@ -0,0 +1,258 @@
+// Copyright 2025 herosizy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package azopenai
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/ai/azopenai"
+	"github.com/HeroSizy/genkit-go-plugins/azopenai/azopenaitest"
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+)
+
+func batchRequests(prompts ...string) []BatchRequest {
+	reqs := make([]BatchRequest, len(prompts))
+	for i, p := range prompts {
+		reqs[i] = BatchRequest{Request: &ai.ModelRequest{Messages: []*ai.Message{ai.NewUserTextMessage(p)}}}
+	}
+	return reqs
+}
+
+func TestBuildBatchInput(t *testing.T) {
+	reqs := batchRequests("one", "two")
+	reqs[1].CustomID = "second"
+	reqs[1].Request.Config = map[string]any{"temperature": 0.5, "deploymentName": "ignored"}
+
+	input, err := buildBatchInput(context.Background(), reqs, Gpt4o, "gpt-4o-batch")
+	if err != nil {
+		t.Fatalf("buildBatchInput() error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(input)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, got %d", len(lines))
+	}
+
+	var line struct {
+		CustomID string         `json:"custom_id"`
+		Method   string         `json:"method"`
+		URL      string         `json:"url"`
+		Body     map[string]any `json:"body"`
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &line); err != nil {
+		t.Fatalf("Invalid line %s: %v", lines[1], err)
+	}
+	if line.CustomID != "second" || line.Method != "POST" || line.URL != "/chat/completions" {
+		t.Errorf("Unexpected line %+v", line)
+	}
+	if line.Body["model"] != "gpt-4o-batch" || line.Body["temperature"] != 0.5 {
+		t.Errorf("Unexpected body %v", line.Body)
+	}
+	if !strings.Contains(lines[0], `"custom_id":"request-0"`) {
+		t.Errorf("Default custom ID missing: %s", lines[0])
+	}
+
+	reqs[1].CustomID = "request-0"
+	if _, err := buildBatchInput(context.Background(), reqs, Gpt4o, "gpt-4o-batch"); err == nil {
+		t.Error("Duplicate custom IDs should be rejected")
+	}
+	if _, err := buildBatchInput(context.Background(), nil, Gpt4o, "gpt-4o-batch"); err == nil {
+		t.Error("Empty batches should be rejected")
+	}
+}
+
+func TestBuildBatchInput_Truncation(t *testing.T) {
+	reqs := batchRequests("hi")
+	reqs[0].Request.Config = &OpenAIConfig{Truncation: &TruncationConfig{Strategy: TruncationDropOldest}}
+
+	if _, err := buildBatchInput(context.Background(), reqs, Gpt4o, "gpt-4o-batch"); err != nil {
+		t.Fatalf("buildBatchInput() error: %v", err)
+	}
+	if _, err := buildBatchInput(context.Background(), reqs, "", "gpt-4o-batch"); err == nil || !strings.Contains(err.Error(), "unknown context window") {
+		t.Errorf("Expected an unknown context window error without a model, got %v", err)
+	}
+}
+
+func TestRunBatch(t *testing.T) {
+	ctx := context.Background()
+	var plugin *AzureOpenAI
+	_, srv := initPlugin(t, func(p *AzureOpenAI) { plugin = p })
+	srv.QueueChat(azopenaitest.ChatReply{Content: "Paris"})
+	srv.QueueError(azopenaitest.EndpointChat, azopenaitest.ContentFiltered(map[string]azopenaitest.Filter{"hate": {Filtered: true}}))
+	srv.QueueChat(azopenaitest.ChatReply{Content: "Berlin", Usage: &azopenaitest.Usage{PromptTokens: 7, CompletionTokens: 1}})
+
+	results, err := plugin.RunBatch(ctx, batchRequests("France?", "Bad prompt", "Germany?"), BatchOptions{
+		DeploymentName: "gpt-4o-batch",
+		Metadata:       map[string]string{"job": "nightly"},
+	}, time.Millisecond)
+	if err != nil {
+		t.Fatalf("RunBatch() error: %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(results))
+	}
+	if results[0].Response == nil || results[0].Response.Text() != "Paris" {
+		t.Errorf("Unexpected first result %+v", results[0])
+	}
+	if results[1].Response != nil || !strings.Contains(results[1].Error, "content_filter") {
+		t.Errorf("Expected a content filter error, got %+v", results[1])
+	}
+	if r := results[2]; r.CustomID != "request-2" || r.Response.Text() != "Berlin" || r.Response.Usage.InputTokens != 7 {
+		t.Errorf("Unexpected third result %+v", r)
+	}
+
+	for _, req := range srv.Requests() {
+		if req.Endpoint == azopenaitest.EndpointChat && req.Deployment != "gpt-4o-batch" {
+			t.Errorf("Batch lines should target the batch deployment, got %q", req.Deployment)
+		}
+	}
+}
+
+func TestBatchJobLifecycle(t *testing.T) {
+	ctx := context.Background()
+	var plugin *AzureOpenAI
+	_, srv := initPlugin(t, func(p *AzureOpenAI) { plugin = p })
+	srv.QueueChat(azopenaitest.ChatReply{Content: "ok"})
+
+	job, err := plugin.SubmitBatch(ctx, batchRequests("hi"), BatchOptions{DeploymentName: "gpt-4o-batch"})
+	if err != nil {
+		t.Fatalf("SubmitBatch() error: %v", err)
+	}
+	if job.ID == "" || job.Done() {
+		t.Fatalf("Unexpected submitted job %+v", job)
+	}
+	if data, ok := srv.File(job.InputFileID); !ok || !strings.Contains(string(data), `"custom_id":"request-0"`) {
+		t.Errorf("Input file not uploaded: %s", data)
+	}
+
+	job, err = plugin.WaitBatch(ctx, job.ID, time.Millisecond)
+	if err != nil {
+		t.Fatalf("WaitBatch() error: %v", err)
+	}
+	if job.Status != "completed" || job.Total != 1 || job.Completed != 1 || job.OutputFileID == "" {
+		t.Errorf("Unexpected finished job %+v", job)
+	}
+
+	cancelled, err := plugin.CancelBatch(ctx, job.ID)
+	if err != nil || cancelled.Status != "cancelled" {
+		t.Errorf("CancelBatch() = %+v, %v", cancelled, err)
+	}
+
+	if _, err := plugin.SubmitBatch(ctx, batchRequests("hi"), BatchOptions{}); err == nil {
+		t.Error("SubmitBatch() should require a deployment")
+	}
+}
+
+func TestBatchFlows(t *testing.T) {
+	ctx := context.Background()
+	var plugin *AzureOpenAI
+	g, srv := initPlugin(t, func(p *AzureOpenAI) { plugin = p })
+	srv.QueueChat(azopenaitest.ChatReply{Content: "flow result"})
+	flows := plugin.DefineBatchFlows(g)
+	submit, status, results := flows.Submit, flows.Get, flows.Results
+	if len(genkit.ListFlows(g)) != 3 {
+		t.Fatalf("Expected 3 registered flows, got %d", len(genkit.ListFlows(g)))
+	}
+
+	job, err := submit.Run(ctx, SubmitBatchInput{Requests: batchRequests("hi"), Options: BatchOptions{DeploymentName: "gpt-4o-batch"}})
+	if err != nil {
+		t.Fatalf("submitBatch error: %v", err)
+	}
+	if _, err := results.Run(ctx, job.ID); err == nil {
+		t.Error("batchResults should fail while the job is running")
+	}
+	for !job.Done() {
+		if job, err = status.Run(ctx, job.ID); err != nil {
+			t.Fatalf("getBatch error: %v", err)
+		}
+	}
+	out, err := results.Run(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("batchResults error: %v", err)
+	}
+	if len(out) != 1 || out[0].Response.Text() != "flow result" {
+		t.Errorf("Unexpected results %+v", out)
+	}
+}
+
+func TestBatch_UnsupportedClient(t *testing.T) {
+	ctx := context.Background()
+	g, err := genkit.Init(ctx)
+	if err != nil {
+		t.Fatalf("Failed to initialize Genkit: %v", err)
+	}
+	plugin := &AzureOpenAI{Client: &mockClient{}}
+	if err := plugin.Init(ctx, g); err != nil {
+		t.Fatalf("Init() error: %v", err)
+	}
+	if _, err := plugin.GetBatch(ctx, "batch_1"); err == nil {
+		t.Error("Batch methods should fail when the client does not implement BatchClient")
+	}
+}
+
+// batchTagClient passes batch calls through, counting the files it uploads
+type batchTagClient struct {
+	Client
+	BatchClient
+	uploads *int
+}
+
+func (c batchTagClient) UploadFile(ctx context.Context, file io.ReadSeekCloser, purpose azopenai.FilePurpose, options *azopenai.UploadFileOptions) (azopenai.UploadFileResponse, error) {
+	*c.uploads++
+	return c.BatchClient.UploadFile(ctx, file, purpose, options)
+}
+
+func TestBatch_ClientMiddleware(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("wrapper implements BatchClient", func(t *testing.T) {
+		var plugin *AzureOpenAI
+		var uploads int
+		initPlugin(t, func(p *AzureOpenAI) {
+			plugin = p
+			p.ClientMiddleware = []ClientMiddleware{func(next Client) Client {
+				return batchTagClient{Client: next, BatchClient: next.(BatchClient), uploads: &uploads}
+			}}
+		})
+		if _, err := plugin.SubmitBatch(ctx, batchRequests("hi"), BatchOptions{DeploymentName: "gpt-4o-batch"}); err != nil {
+			t.Fatalf("SubmitBatch() error: %v", err)
+		}
+		if uploads != 1 {
+			t.Errorf("Expected the upload to go through the middleware, got %d uploads", uploads)
+		}
+	})
+
+	t.Run("wrapper without BatchClient", func(t *testing.T) {
+		var plugin *AzureOpenAI
+		initPlugin(t, func(p *AzureOpenAI) {
+			plugin = p
+			p.ClientMiddleware = []ClientMiddleware{tagMiddleware("[tag] ")}
+		})
+		if _, err := plugin.GetBatch(ctx, "batch_1"); err == nil {
+			t.Error("Batch methods should not bypass a middleware that does not implement BatchClient")
+		}
+	})
+}
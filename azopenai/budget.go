@@ -0,0 +1,297 @@
+// Copyright 2025 herosizy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package azopenai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+)
+
+// BudgetOptions configures token and spend budgets for chat models.
+//
+// Budgets are checked before a request is sent, against an estimate of its
+// prompt tokens plus MaxTokens, so set MaxTokens for output to be accounted for.
+// Windows are then charged with the actual usage. Cost limits apply to models
+// with a known price, see [DefaultPricing].
+type BudgetOptions struct {
+	PerRequest *BudgetLimit    // Limits on a single request. Window is ignored.
+	PerUser    *BudgetLimit    // Limits per OpenAIConfig.User in each window. Requests without a user are not limited.
+	Total      *BudgetLimit    // Limits across all requests in each window.
+	Fallback   *BudgetFallback // Cheaper model used when a request would exceed a budget. If nil, BudgetExceededError is returned.
+}
+
+// BudgetLimit caps tokens and estimated spend. Zero fields are unlimited.
+type BudgetLimit struct {
+	MaxTokens int           // Prompt and completion tokens
+	MaxCost   float64       // Estimated cost in US dollars
+	Window    time.Duration // Length of the accounting window. Zero means it never resets.
+}
+
+// BudgetFallback is the model a request is downgraded to when it would exceed a budget.
+// The fallback request is checked against the budgets again, without further fallback.
+type BudgetFallback struct {
+	Model      string // Name of a model defined by the plugin, e.g. Gpt4oMini
+	Deployment string // Deployment of the fallback model. Defaults to Model.
+}
+
+// BudgetExceededError is returned when a request would exceed a budget.
+type BudgetExceededError struct {
+	Scope      string      // "request", "user" or "total"
+	User       string      // User whose budget was exceeded, for the "user" scope
+	Limit      BudgetLimit // The budget that would be exceeded
+	Tokens     int         // Estimated tokens of the request
+	Cost       float64     // Estimated cost of the request
+	UsedTokens int         // Tokens already charged in the current window
+	UsedCost   float64     // Cost already charged in the current window
+	ResetAt    time.Time   // When the window resets; zero if it never does
+}
+
+// Error implements the error interface.
+func (e *BudgetExceededError) Error() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "azopenai: %s budget exceeded", e.Scope)
+	if e.User != "" {
+		fmt.Fprintf(&sb, " for user %q", e.User)
+	}
+	if e.Limit.MaxTokens > 0 && e.UsedTokens+e.Tokens > e.Limit.MaxTokens {
+		fmt.Fprintf(&sb, ": request needs about %d tokens, %d of %d used", e.Tokens, e.UsedTokens, e.Limit.MaxTokens)
+	} else {
+		fmt.Fprintf(&sb, ": request costs about $%.4f, $%.4f of $%.4f used", e.Cost, e.UsedCost, e.Limit.MaxCost)
+	}
+	if !e.ResetAt.IsZero() {
+		fmt.Fprintf(&sb, ", resets at %s", e.ResetAt.Format(time.RFC3339))
+	}
+	return sb.String()
+}
+
+type budgetFallbackKey struct{}
+
+// budgetMiddleware enforces budgets on chat calls. It runs innermost, after the
+// response caches, so cache hits are not charged.
+func budgetMiddleware(g *genkit.Genkit, opts BudgetOptions, costs *costEstimator) Middleware {
+	b := &budgets{opts: opts, costs: costs, now: time.Now}
+	if opts.PerUser != nil {
+		b.perUser = newBudgetLedger(*opts.PerUser)
+	}
+	if opts.Total != nil {
+		b.total = newBudgetLedger(*opts.Total)
+	}
+	return Middleware{
+		Chat: func(next ChatHandler) ChatHandler {
+			return func(ctx context.Context, call *ChatCall) (*ai.ModelResponse, error) {
+				settle, err := b.reserve(call)
+				if err != nil {
+					return b.fallback(ctx, g, call, err)
+				}
+				resp, err := next(ctx, call)
+				if err != nil {
+					settle(0, 0)
+					return nil, err
+				}
+				tokens, cost := chargedUsage(resp)
+				settle(tokens, cost)
+				return resp, nil
+			}
+		},
+	}
+}
+
+type budgets struct {
+	opts    BudgetOptions
+	costs   *costEstimator
+	perUser *budgetLedger
+	total   *budgetLedger
+	now     func() time.Time
+}
+
+// reserve checks the request against every budget and reserves its estimate in
+// the windows. The returned function replaces the reservation with actual usage.
+func (b *budgets) reserve(call *ChatCall) (func(tokens int, cost float64), error) {
+	cfg, err := requestConfig(call.Request)
+	if err != nil {
+		return nil, err
+	}
+	tokens, cost := b.estimate(call, cfg)
+
+	if l := b.opts.PerRequest; l != nil && l.exceeded(0, 0, tokens, cost) {
+		return nil, &BudgetExceededError{Scope: "request", Limit: *l, Tokens: tokens, Cost: cost}
+	}
+	var settles []func(int, float64)
+	release := func(tokens int, cost float64) {
+		for _, s := range settles {
+			s(tokens, cost)
+		}
+	}
+	now := b.now()
+	if b.perUser != nil && cfg.User != "" {
+		s, err := b.perUser.reserve(cfg.User, tokens, cost, now)
+		if err != nil {
+			err.Scope, err.User = "user", cfg.User
+			return nil, err
+		}
+		settles = append(settles, s)
+	}
+	if b.total != nil {
+		s, err := b.total.reserve("", tokens, cost, now)
+		if err != nil {
+			release(0, 0)
+			err.Scope = "total"
+			return nil, err
+		}
+		settles = append(settles, s)
+	}
+	return release, nil
+}
+
+// estimate returns the expected tokens and cost of a call: its prompt, tools and MaxTokens
+func (b *budgets) estimate(call *ChatCall, cfg OpenAIConfig) (int, float64) {
+	var prompt int
+	for _, msg := range call.Request.Messages {
+		prompt += estimateTokens(msg)
+	}
+	if len(call.Request.Tools) > 0 {
+		tools, _ := json.Marshal(call.Request.Tools)
+		prompt += len(tools) / 4
+	}
+	output := int(deref(cfg.MaxTokens))
+	var cost float64
+	if p, ok := b.costs.price(call.Model, cfg.DeploymentName); ok {
+		cost = p.Estimate(&ai.GenerationUsage{InputTokens: prompt, OutputTokens: output}).Total
+	}
+	return prompt + output, cost
+}
+
+// fallback retries a call that exceeded a budget on the fallback model, if one
+// is configured and the call is not already a fallback
+func (b *budgets) fallback(ctx context.Context, g *genkit.Genkit, call *ChatCall, budgetErr error) (*ai.ModelResponse, error) {
+	fb := b.opts.Fallback
+	if fb == nil || ctx.Value(budgetFallbackKey{}) != nil {
+		return nil, budgetErr
+	}
+	model := genkit.LookupModel(g, azureOpenAIProvider, fb.Model)
+	if model == nil {
+		return nil, fmt.Errorf("budget fallback model %q is not defined: %w", fb.Model, budgetErr)
+	}
+	cfg, err := requestConfig(call.Request)
+	if err != nil {
+		return nil, err
+	}
+	cfg.DeploymentName = fb.Deployment
+	if cfg.DeploymentName == "" {
+		cfg.DeploymentName = fb.Model
+	}
+	req := *call.Request
+	req.Config = &cfg
+	resp, err := model.Generate(context.WithValue(ctx, budgetFallbackKey{}, true), &req, call.Callback)
+	if err != nil {
+		return nil, err
+	}
+	responseMetadata(resp).Fallback = fb.Model
+	return resp, nil
+}
+
+// chargedUsage returns the tokens and estimated cost a response is charged,
+// including the usage of a request that lost a hedge
+func chargedUsage(resp *ai.ModelResponse) (int, float64) {
+	tokens := usageTokens(resp.Usage)
+	var cost float64
+	if md := ResponseMetadataFrom(resp); md != nil {
+		tokens += usageTokens(md.HedgeUsage)
+		if md.Cost != nil {
+			cost = md.Cost.Total
+		}
+	}
+	return tokens, cost
+}
+
+// usageTokens returns the total tokens of u
+func usageTokens(u *ai.GenerationUsage) int {
+	if u == nil {
+		return 0
+	}
+	if u.TotalTokens > 0 {
+		return u.TotalTokens
+	}
+	return u.InputTokens + u.OutputTokens
+}
+
+// exceeded reports whether adding tokens and cost to the used amounts breaks the limit
+func (l *BudgetLimit) exceeded(usedTokens int, usedCost float64, tokens int, cost float64) bool {
+	return (l.MaxTokens > 0 && usedTokens+tokens > l.MaxTokens) ||
+		(l.MaxCost > 0 && usedCost+cost > l.MaxCost)
+}
+
+// budgetLedger tracks usage against a limit in fixed windows, by key
+type budgetLedger struct {
+	limit   BudgetLimit
+	mu      sync.Mutex
+	windows map[string]*budgetWindow
+}
+
+type budgetWindow struct {
+	start  time.Time
+	tokens int
+	cost   float64
+}
+
+func newBudgetLedger(limit BudgetLimit) *budgetLedger {
+	return &budgetLedger{limit: limit, windows: map[string]*budgetWindow{}}
+}
+
+// reserve charges an estimate to the current window of key, failing if it
+// would exceed the limit. settle replaces the estimate with actual usage.
+func (l *budgetLedger) reserve(key string, tokens int, cost float64, now time.Time) (func(int, float64), *BudgetExceededError) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	w := l.windows[key]
+	if w == nil || (l.limit.Window > 0 && now.Sub(w.start) >= l.limit.Window) {
+		w = &budgetWindow{start: now}
+		l.windows[key] = w
+	}
+	if l.limit.exceeded(w.tokens, w.cost, tokens, cost) {
+		e := &BudgetExceededError{Limit: l.limit, Tokens: tokens, Cost: cost, UsedTokens: w.tokens, UsedCost: w.cost}
+		if l.limit.Window > 0 {
+			e.ResetAt = w.start.Add(l.limit.Window)
+		}
+		return nil, e
+	}
+	w.tokens += tokens
+	w.cost += cost
+	return func(actualTokens int, actualCost float64) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		// A new window may have started; the reservation then expired with the old one
+		if l.windows[key] == w {
+			w.tokens -= tokens
+			w.cost -= cost
+		}
+		cur := l.windows[key]
+		cur.tokens += actualTokens
+		cur.cost += actualCost
+	}, nil
+}
@@ -0,0 +1,227 @@
+// Copyright 2025 herosizy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package azopenai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/HeroSizy/genkit-go-plugins/azopenai/azopenaitest"
+	"github.com/firebase/genkit/go/ai"
+)
+
+func TestBudgetLedger(t *testing.T) {
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	l := newBudgetLedger(BudgetLimit{MaxTokens: 100, Window: time.Minute})
+
+	settle, err := l.reserve("alice", 60, 0, start)
+	if err != nil {
+		t.Fatalf("First reservation failed: %v", err)
+	}
+	// The reservation counts until it is settled
+	if _, err := l.reserve("alice", 50, 0, start.Add(time.Second)); err == nil {
+		t.Fatal("Expected the reservation to block a second request")
+	} else if err.UsedTokens != 60 || !err.ResetAt.Equal(start.Add(time.Minute)) {
+		t.Errorf("Unexpected error %+v", err)
+	}
+	settle(30, 0)
+	if _, err := l.reserve("alice", 50, 0, start.Add(2*time.Second)); err != nil {
+		t.Errorf("Expected the settled usage to leave room, got %v", err)
+	}
+	if _, err := l.reserve("bob", 100, 0, start); err != nil {
+		t.Errorf("Expected keys to have separate windows, got %v", err)
+	}
+	if _, err := l.reserve("alice", 100, 0, start.Add(time.Minute)); err != nil {
+		t.Errorf("Expected a new window, got %v", err)
+	}
+}
+
+func userRequest(user, text string) *ai.ModelRequest {
+	return &ai.ModelRequest{
+		Messages: []*ai.Message{ai.NewUserTextMessage(text)},
+		Config:   &OpenAIConfig{DeploymentName: "chat", User: user, MaxTokens: to.Ptr(int32(100))},
+	}
+}
+
+func TestBudget(t *testing.T) {
+	tests := []struct {
+		name      string
+		budget    BudgetOptions
+		requests  []*ai.ModelRequest
+		wantScope string // Scope of the error for the last request, or "" if it succeeds
+	}{
+		{
+			name:     "within request budget",
+			budget:   BudgetOptions{PerRequest: &BudgetLimit{MaxTokens: 200}},
+			requests: []*ai.ModelRequest{userRequest("", "Hello")},
+		},
+		{
+			name:      "request tokens",
+			budget:    BudgetOptions{PerRequest: &BudgetLimit{MaxTokens: 50}},
+			requests:  []*ai.ModelRequest{userRequest("", "Hello")},
+			wantScope: "request",
+		},
+		{
+			name:      "request cost",
+			budget:    BudgetOptions{PerRequest: &BudgetLimit{MaxCost: 0.0001}},
+			requests:  []*ai.ModelRequest{userRequest("", strings.Repeat("long prompt ", 500))},
+			wantScope: "request",
+		},
+		{
+			name:      "user window",
+			budget:    BudgetOptions{PerUser: &BudgetLimit{MaxTokens: 150, Window: time.Hour}},
+			requests:  []*ai.ModelRequest{userRequest("alice", "Hello"), userRequest("alice", "Again")},
+			wantScope: "user",
+		},
+		{
+			name:     "users are separate",
+			budget:   BudgetOptions{PerUser: &BudgetLimit{MaxTokens: 150, Window: time.Hour}},
+			requests: []*ai.ModelRequest{userRequest("alice", "Hello"), userRequest("bob", "Hello")},
+		},
+		{
+			name:      "total",
+			budget:    BudgetOptions{Total: &BudgetLimit{MaxTokens: 150}},
+			requests:  []*ai.ModelRequest{userRequest("alice", "Hello"), userRequest("bob", "Hello")},
+			wantScope: "total",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, srv := initPlugin(t, func(p *AzureOpenAI) { p.Budget = &tt.budget })
+			srv.OnChat(func(azopenaitest.Request) azopenaitest.ChatReply {
+				return azopenaitest.ChatReply{Content: "Hi", Usage: &azopenaitest.Usage{PromptTokens: 10, CompletionTokens: 90}}
+			})
+
+			var err error
+			for _, req := range tt.requests {
+				_, err = Model(g, Gpt4o).Generate(context.Background(), req, nil)
+			}
+			if tt.wantScope == "" {
+				if err != nil {
+					t.Fatalf("Generate() error: %v", err)
+				}
+				return
+			}
+			var budgetErr *BudgetExceededError
+			if !errors.As(err, &budgetErr) || budgetErr.Scope != tt.wantScope {
+				t.Fatalf("Expected a %s budget error, got %v", tt.wantScope, err)
+			}
+			if n := len(srv.Requests()); n != len(tt.requests)-1 {
+				t.Errorf("Expected the rejected request not to be sent, got %d requests", n)
+			}
+		})
+	}
+}
+
+// mapConfig is middleware that replaces typed request configs with their JSON map form
+var mapConfig = Middleware{
+	Chat: func(next ChatHandler) ChatHandler {
+		return func(ctx context.Context, call *ChatCall) (*ai.ModelResponse, error) {
+			if cfg, ok := call.Request.Config.(*OpenAIConfig); ok {
+				var m map[string]any
+				b, _ := json.Marshal(cfg)
+				_ = json.Unmarshal(b, &m)
+				req := *call.Request
+				req.Config = m
+				call.Request = &req
+			}
+			return next(ctx, call)
+		}
+	},
+}
+
+func TestBudget_MapConfig(t *testing.T) {
+	g, srv := initPlugin(t, func(p *AzureOpenAI) {
+		p.Middleware = []Middleware{mapConfig}
+		p.Budget = &BudgetOptions{
+			PerRequest: &BudgetLimit{MaxCost: 0.002},
+			PerUser:    &BudgetLimit{MaxTokens: 50},
+			Fallback:   &BudgetFallback{Model: Gpt4oMini, Deployment: "mini"},
+		}
+	})
+	srv.OnChat(func(azopenaitest.Request) azopenaitest.ChatReply { return azopenaitest.ChatReply{Content: "Hi"} })
+
+	// The fallback request keeps the caller's settings
+	req := userRequest("", strings.Repeat("word ", 1000))
+	req.Config.(*OpenAIConfig).Temperature = to.Ptr[float32](0.5)
+	resp, err := Model(g, Gpt4o).Generate(context.Background(), req, nil)
+	if err != nil {
+		t.Fatalf("Generate() error: %v", err)
+	}
+	if md := ResponseMetadataFrom(resp); md == nil || md.Fallback != Gpt4oMini {
+		t.Errorf("Expected the response to record the fallback, got %+v", md)
+	}
+	sent := srv.Requests()[0]
+	if body := sent.JSON(); sent.Deployment != "mini" || body["temperature"] != 0.5 || body["max_tokens"] != float64(100) {
+		t.Errorf("Fallback request to %q lost the caller's settings: temperature %v, max_tokens %v", sent.Deployment, body["temperature"], body["max_tokens"])
+	}
+
+	// Per-user budgets apply to the user of a map config
+	_, err = Model(g, Gpt4o).Generate(context.Background(), userRequest("alice", "Hello"), nil)
+	var budgetErr *BudgetExceededError
+	if !errors.As(err, &budgetErr) || budgetErr.Scope != "user" || budgetErr.User != "alice" {
+		t.Errorf("Expected alice's budget to be exceeded, got %v", err)
+	}
+}
+
+func TestBudget_Fallback(t *testing.T) {
+	g, srv := initPlugin(t, func(p *AzureOpenAI) {
+		p.Budget = &BudgetOptions{
+			PerRequest: &BudgetLimit{MaxCost: 0.0005},
+			Fallback:   &BudgetFallback{Model: Gpt4oMini, Deployment: "mini"},
+		}
+	})
+	srv.OnChat(func(azopenaitest.Request) azopenaitest.ChatReply { return azopenaitest.ChatReply{Content: "Hi"} })
+
+	// About 100 prompt and 100 output tokens: $0.00125 on gpt-4o, $0.000075 on gpt-4o-mini
+	req := userRequest("", strings.Repeat("word ", 100))
+	var chunks int
+	resp, err := Model(g, Gpt4o).Generate(context.Background(), req, func(context.Context, *ai.ModelResponseChunk) error {
+		chunks++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Generate() error: %v", err)
+	}
+	if md := ResponseMetadataFrom(resp); md == nil || md.Fallback != Gpt4oMini {
+		t.Errorf("Expected the response to record the fallback, got %+v", md)
+	}
+	if got := srv.Requests(); len(got) != 1 || got[0].Deployment != "mini" {
+		t.Errorf("Expected one request to the fallback deployment, got %+v", got)
+	}
+	if chunks == 0 {
+		t.Error("Expected the fallback to stream to the callback")
+	}
+
+	// A request too expensive for the fallback too fails without further fallback
+	req = userRequest("", strings.Repeat("word ", 5000))
+	_, err = Model(g, Gpt4o).Generate(context.Background(), req, nil)
+	var budgetErr *BudgetExceededError
+	if !errors.As(err, &budgetErr) || !strings.Contains(err.Error(), "request budget exceeded") {
+		t.Errorf("Expected a budget error, got %v", err)
+	}
+}
@@ -0,0 +1,239 @@
+// Copyright 2025 herosizy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package azopenai
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/firebase/genkit/go/ai"
+)
+
+// Cache stores serialized model responses. Implementations must be safe for
+// concurrent use.
+type Cache interface {
+	// Get returns the value stored under key and whether it was found and unexpired.
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Set stores value under key. A zero ttl means the value never expires.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+// CacheOptions enables response caching for chat models.
+//
+// Responses are keyed by a hash of the Azure request (deployment, messages,
+// tools and generation settings), so only identical requests share an entry.
+// Cached responses are replayed to streaming callbacks as a single chunk. Set
+// OpenAIConfig.NoCache to bypass the cache for a request. Backend errors are
+// logged and treated as cache misses.
+type CacheOptions struct {
+	Backend Cache         // Storage for cached responses. If nil, an in-memory cache is used.
+	TTL     time.Duration // How long responses stay cached. Zero means they never expire.
+}
+
+// cacheMiddleware serves chat responses from the cache and stores successful ones
+func cacheMiddleware(opts CacheOptions) Middleware {
+	backend := opts.Backend
+	if backend == nil {
+		backend = NewMemoryCache()
+	}
+	return Middleware{
+		Chat: func(next ChatHandler) ChatHandler {
+			return func(ctx context.Context, call *ChatCall) (*ai.ModelResponse, error) {
+				if cfg, ok := call.Request.Config.(*OpenAIConfig); ok && cfg.NoCache {
+					return next(ctx, call)
+				}
+				key, err := chatCacheKey(call)
+				if err != nil {
+					return next(ctx, call)
+				}
+
+				data, ok, err := backend.Get(ctx, key)
+				if err != nil {
+					slog.WarnContext(ctx, "azopenai: reading response cache", "err", err)
+				}
+				if ok {
+					var resp ai.ModelResponse
+					if err := json.Unmarshal(data, &resp); err == nil && resp.Message != nil {
+						return replayCached(ctx, &resp, call.Callback)
+					}
+				}
+
+				resp, err := next(ctx, call)
+				if err != nil {
+					return nil, err
+				}
+				if data, err := json.Marshal(resp); err == nil {
+					if err := backend.Set(ctx, key, data, opts.TTL); err != nil {
+						slog.WarnContext(ctx, "azopenai: writing response cache", "err", err)
+					}
+				}
+				return resp, nil
+			}
+		},
+	}
+}
+
+// replayCached marks resp as cached and streams its content to cb
+func replayCached(ctx context.Context, resp *ai.ModelResponse, cb ai.ModelStreamCallback) (*ai.ModelResponse, error) {
+	md := responseMetadata(resp)
+	md.Cached = true
+	md.Cost = nil // Served without calling the service
+	md.HedgeUsage = nil
+	if cb != nil {
+		chunk := &ai.ModelResponseChunk{Content: resp.Message.Content, Role: ai.RoleModel}
+		if err := cb(ctx, chunk); err != nil {
+			return nil, fmt.Errorf("streaming callback error: %w", err)
+		}
+	}
+	return resp, nil
+}
+
+// chatCacheKey returns a canonical hash of the Azure request of the call's backend
+func chatCacheKey(call *ChatCall) (string, error) {
+	b, err := json.Marshal([]any{call.Options, call.Responses, call.Completions})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// MemoryCache is an in-process [Cache].
+type MemoryCache struct {
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	Value   []byte    `json:"value"`
+	Expires time.Time `json:"expires,omitzero"`
+}
+
+func (e cacheEntry) expired() bool {
+	return !e.Expires.IsZero() && time.Now().After(e.Expires)
+}
+
+func newCacheEntry(value []byte, ttl time.Duration) cacheEntry {
+	e := cacheEntry{Value: value}
+	if ttl > 0 {
+		e.Expires = time.Now().Add(ttl)
+	}
+	return e
+}
+
+// NewMemoryCache returns an empty in-memory cache.
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{entries: map[string]cacheEntry{}}
+}
+
+// Get implements [Cache].
+func (c *MemoryCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	if e.expired() {
+		delete(c.entries, key)
+		return nil, false, nil
+	}
+	return e.Value, true, nil
+}
+
+// Set implements [Cache].
+func (c *MemoryCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = newCacheEntry(value, ttl)
+	return nil
+}
+
+// FileCache is a [Cache] storing one JSON file per entry in a directory, so
+// cached responses survive across processes such as repeated CI runs.
+type FileCache struct {
+	dir string
+}
+
+// NewFileCache returns a cache in dir, creating the directory if needed.
+func NewFileCache(dir string) (*FileCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("azopenai: creating cache directory: %w", err)
+	}
+	return &FileCache{dir: dir}, nil
+}
+
+// Get implements [Cache].
+func (c *FileCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	data, err := os.ReadFile(c.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	var e cacheEntry
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, false, err
+	}
+	if e.expired() {
+		_ = os.Remove(c.path(key))
+		return nil, false, nil
+	}
+	return e.Value, true, nil
+}
+
+// Set implements [Cache].
+func (c *FileCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	data, err := json.Marshal(newCacheEntry(value, ttl))
+	if err != nil {
+		return err
+	}
+	// Write to a temporary file first so readers never see a partial entry
+	tmp, err := os.CreateTemp(c.dir, "tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path(key))
+}
+
+func (c *FileCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".json")
+}
@@ -0,0 +1,127 @@
+// Copyright 2025 herosizy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package azopenai
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/HeroSizy/genkit-go-plugins/azopenai/azopenaitest"
+	"github.com/firebase/genkit/go/ai"
+)
+
+func TestCacheBackends(t *testing.T) {
+	ctx := context.Background()
+	fileCache, err := NewFileCache(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileCache() error: %v", err)
+	}
+
+	for name, c := range map[string]Cache{"memory": NewMemoryCache(), "file": fileCache} {
+		t.Run(name, func(t *testing.T) {
+			if _, ok, err := c.Get(ctx, "missing"); ok || err != nil {
+				t.Errorf("Get(missing) = %v, %v", ok, err)
+			}
+			if err := c.Set(ctx, "k", []byte("v"), 0); err != nil {
+				t.Fatalf("Set() error: %v", err)
+			}
+			if v, ok, err := c.Get(ctx, "k"); !ok || err != nil || string(v) != "v" {
+				t.Errorf("Get(k) = %q, %v, %v", v, ok, err)
+			}
+			if err := c.Set(ctx, "short", []byte("v"), time.Millisecond); err != nil {
+				t.Fatalf("Set() error: %v", err)
+			}
+			time.Sleep(5 * time.Millisecond)
+			if _, ok, _ := c.Get(ctx, "short"); ok {
+				t.Error("Expired entries should not be returned")
+			}
+		})
+	}
+}
+
+func TestFileCache_Persists(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	first, _ := NewFileCache(dir)
+	if err := first.Set(ctx, "key", []byte("value"), time.Hour); err != nil {
+		t.Fatalf("Set() error: %v", err)
+	}
+	second, _ := NewFileCache(dir)
+	if v, ok, err := second.Get(ctx, "key"); !ok || err != nil || string(v) != "value" {
+		t.Errorf("Get() = %q, %v, %v", v, ok, err)
+	}
+}
+
+func TestResponseCache(t *testing.T) {
+	ctx := context.Background()
+	g, srv := initPlugin(t, func(p *AzureOpenAI) { p.Cache = &CacheOptions{} })
+	srv.OnChat(func(azopenaitest.Request) azopenaitest.ChatReply {
+		return azopenaitest.ChatReply{Content: "Paris"}
+	})
+	model := Model(g, Gpt4o)
+	request := func(cfg *OpenAIConfig) *ai.ModelRequest {
+		return &ai.ModelRequest{Messages: []*ai.Message{ai.NewUserTextMessage("Capital of France?")}, Config: cfg}
+	}
+
+	first, err := model.Generate(ctx, request(&OpenAIConfig{}), nil)
+	if err != nil {
+		t.Fatalf("Generate() error: %v", err)
+	}
+	if ResponseMetadataFrom(first).Cached {
+		t.Error("First response should not be cached")
+	}
+
+	// A streaming request with the same options is replayed through the callback
+	var chunks []string
+	second, err := model.Generate(ctx, request(&OpenAIConfig{}), func(ctx context.Context, c *ai.ModelResponseChunk) error {
+		chunks = append(chunks, c.Text())
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Generate() error: %v", err)
+	}
+	if !ResponseMetadataFrom(second).Cached || second.Text() != "Paris" {
+		t.Errorf("Expected a cached response, got %q %+v", second.Text(), ResponseMetadataFrom(second))
+	}
+	if len(chunks) != 1 || chunks[0] != "Paris" {
+		t.Errorf("Cached response should be replayed as one chunk, got %q", chunks)
+	}
+	if n := len(srv.Requests()); n != 1 {
+		t.Errorf("Expected 1 request to the service, got %d", n)
+	}
+
+	// Different settings and explicit bypass both reach the service
+	if _, err := model.Generate(ctx, request(&OpenAIConfig{Temperature: to.Ptr(float32(0))}), nil); err != nil {
+		t.Fatalf("Generate() error: %v", err)
+	}
+	bypass, err := model.Generate(ctx, request(&OpenAIConfig{NoCache: true}), nil)
+	if err != nil {
+		t.Fatalf("Generate() error: %v", err)
+	}
+	if ResponseMetadataFrom(bypass).Cached {
+		t.Error("NoCache should bypass the cache")
+	}
+	if n := len(srv.Requests()); n != 3 {
+		t.Errorf("Expected 3 requests to the service, got %d", n)
+	}
+}
@@ -0,0 +1,348 @@
+// Copyright 2025 herosizy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package cassette records Azure OpenAI HTTP traffic to files and replays it,
+// so that tests can exercise the plugin deterministically without network access.
+//
+// A [Recorder] implements [policy.Transporter] and is plugged into the plugin
+// through the AzureOpenAI.Transport field:
+//
+//	rec := cassette.Start(t, "testdata/cassettes/chat.json", nil)
+//	plugin := &azopenai.AzureOpenAI{
+//		APIKey:    "test-key",
+//		Endpoint:  "https://test.openai.azure.com/",
+//		Transport: rec,
+//	}
+//
+// Cassettes are replayed by default. Set AZURE_OPENAI_RECORD_MODE=record (or
+// [ModeRecord] in [Options]) to call the real service and overwrite the cassette.
+// Credentials are redacted before a cassette is written.
+package cassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+)
+
+// Mode controls whether a recorder talks to the real service.
+type Mode string
+
+const (
+	ModeReplay Mode = "replay" // Serve responses from the cassette; fail on unmatched requests
+	ModeRecord Mode = "record" // Forward requests to the real service and save the cassette on Stop
+	ModeAuto   Mode = "auto"   // Replay if the cassette exists, otherwise record
+)
+
+// ModeEnvVar names the environment variable consulted when Options.Mode is empty.
+const ModeEnvVar = "AZURE_OPENAI_RECORD_MODE"
+
+// Redacted replaces the values of redacted headers in saved cassettes.
+const Redacted = "REDACTED"
+
+// DefaultRedactedHeaders are always removed from recorded requests and responses.
+var DefaultRedactedHeaders = []string{
+	"Api-Key",
+	"Authorization",
+	"Ocp-Apim-Subscription-Key",
+	"Set-Cookie",
+}
+
+// Cassette is the on-disk form of a recording.
+type Cassette struct {
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// Interaction is a single recorded request and its response.
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Request is a recorded HTTP request.
+type Request struct {
+	Method  string      `json:"method"`
+	URL     string      `json:"url"`
+	Headers http.Header `json:"headers,omitempty"`
+	Body    string      `json:"body,omitempty"`
+}
+
+// Response is a recorded HTTP response. Streaming (SSE) bodies are stored verbatim.
+type Response struct {
+	StatusCode int         `json:"status"`
+	Headers    http.Header `json:"headers,omitempty"`
+	Body       string      `json:"body,omitempty"`
+}
+
+// Matcher reports whether a live request matches a recorded one.
+type Matcher func(r *http.Request, body []byte, recorded Request) bool
+
+// Options configures a [Recorder].
+type Options struct {
+	Mode          Mode               // Recording mode. If empty, AZURE_OPENAI_RECORD_MODE is consulted, then ModeReplay.
+	Matcher       Matcher            // Request matching rule. If nil, DefaultMatcher is used.
+	RedactHeaders []string           // Headers redacted in addition to DefaultRedactedHeaders
+	Redact        func(*Interaction) // Optional hook to scrub an interaction before it is saved
+	Transport     policy.Transporter // Transport for ModeRecord. If nil, http.DefaultClient is used.
+}
+
+// Recorder is a [policy.Transporter] that records or replays interactions.
+type Recorder struct {
+	path      string
+	mode      Mode
+	matcher   Matcher
+	redact    []string
+	hook      func(*Interaction)
+	transport policy.Transporter
+
+	mu       sync.Mutex
+	cassette Cassette
+	used     []bool
+}
+
+// New creates a recorder for the cassette at path. In replay mode the cassette
+// must exist.
+func New(path string, opts *Options) (*Recorder, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	mode := opts.Mode
+	if mode == "" {
+		mode = Mode(os.Getenv(ModeEnvVar))
+	}
+	if mode == "" {
+		mode = ModeReplay
+	}
+
+	r := &Recorder{
+		path:      path,
+		mode:      mode,
+		matcher:   opts.Matcher,
+		redact:    append(append([]string{}, DefaultRedactedHeaders...), opts.RedactHeaders...),
+		hook:      opts.Redact,
+		transport: opts.Transport,
+	}
+	if r.matcher == nil {
+		r.matcher = DefaultMatcher
+	}
+	if r.transport == nil {
+		r.transport = http.DefaultClient
+	}
+
+	switch mode {
+	case ModeRecord:
+		return r, nil
+	case ModeReplay, ModeAuto:
+	default:
+		return nil, fmt.Errorf("cassette: unknown mode %q", mode)
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && mode == ModeAuto {
+		r.mode = ModeRecord
+		return r, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cassette: %w", err)
+	}
+	if err := json.Unmarshal(data, &r.cassette); err != nil {
+		return nil, fmt.Errorf("cassette: decoding %s: %w", path, err)
+	}
+	r.mode = ModeReplay
+	r.used = make([]bool, len(r.cassette.Interactions))
+	return r, nil
+}
+
+// Start creates a recorder for a test and saves the cassette when the test
+// finishes. It fails the test if the recorder cannot be created or saved.
+func Start(t testing.TB, path string, opts *Options) *Recorder {
+	t.Helper()
+	r, err := New(path, opts)
+	if err != nil {
+		t.Fatalf("Failed to start recorder: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := r.Stop(); err != nil {
+			t.Errorf("Failed to save cassette: %v", err)
+		}
+	})
+	return r
+}
+
+// Mode returns the mode the recorder is operating in.
+func (r *Recorder) Mode() Mode {
+	return r.mode
+}
+
+// Do implements [policy.Transporter].
+func (r *Recorder) Do(req *http.Request) (*http.Response, error) {
+	body, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+	if r.mode == ModeRecord {
+		return r.record(req, body)
+	}
+	return r.replay(req, body)
+}
+
+// RoundTrip implements [http.RoundTripper] so a recorder can also back an [http.Client].
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	return r.Do(req)
+}
+
+// Stop saves the cassette when recording. It is a no-op in replay mode.
+func (r *Recorder) Stop() error {
+	if r.mode != ModeRecord {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	data, err := json.MarshalIndent(r.cassette, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(r.path, append(data, '\n'), 0o644)
+}
+
+func (r *Recorder) record(req *http.Request, body []byte) (*http.Response, error) {
+	resp, err := r.transport.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	i := &Interaction{
+		Request: Request{
+			Method:  req.Method,
+			URL:     req.URL.String(),
+			Headers: r.redactHeaders(req.Header),
+			Body:    string(body),
+		},
+		Response: Response{
+			StatusCode: resp.StatusCode,
+			Headers:    r.redactHeaders(resp.Header),
+			Body:       string(respBody),
+		},
+	}
+	if r.hook != nil {
+		r.hook(i)
+	}
+
+	r.mu.Lock()
+	r.cassette.Interactions = append(r.cassette.Interactions, i)
+	r.mu.Unlock()
+	return resp, nil
+}
+
+func (r *Recorder) replay(req *http.Request, body []byte) (*http.Response, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for n, i := range r.cassette.Interactions {
+		if r.used[n] || !r.matcher(req, body, i.Request) {
+			continue
+		}
+		r.used[n] = true
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", i.Response.StatusCode, http.StatusText(i.Response.StatusCode)),
+			StatusCode:    i.Response.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        i.Response.Headers.Clone(),
+			Body:          io.NopCloser(strings.NewReader(i.Response.Body)),
+			ContentLength: int64(len(i.Response.Body)),
+			Request:       req,
+		}, nil
+	}
+	return nil, fmt.Errorf("cassette: no unused interaction in %s matches %s %s", r.path, req.Method, req.URL)
+}
+
+func (r *Recorder) redactHeaders(h http.Header) http.Header {
+	h = h.Clone()
+	for _, name := range r.redact {
+		if _, ok := h[http.CanonicalHeaderKey(name)]; ok {
+			h.Set(name, Redacted)
+		}
+	}
+	return h
+}
+
+// readBody reads the request body and restores it so the request can still be sent.
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// DefaultMatcher matches on method, URL path and query, and body. Endpoint hosts
+// are ignored so cassettes can be replayed against any endpoint.
+func DefaultMatcher(r *http.Request, body []byte, recorded Request) bool {
+	return MatchMethodAndPath(r, body, recorded) && MatchBody(r, body, recorded)
+}
+
+// MatchMethodAndPath matches on method, URL path and query only.
+func MatchMethodAndPath(r *http.Request, _ []byte, recorded Request) bool {
+	if r.Method != recorded.Method {
+		return false
+	}
+	req, err := http.NewRequest(recorded.Method, recorded.URL, nil)
+	if err != nil {
+		return false
+	}
+	return r.URL.Path == req.URL.Path && reflect.DeepEqual(r.URL.Query(), req.URL.Query())
+}
+
+// MatchBody matches request bodies, comparing JSON bodies structurally.
+func MatchBody(_ *http.Request, body []byte, recorded Request) bool {
+	var got, want any
+	if json.Unmarshal(body, &got) == nil && json.Unmarshal([]byte(recorded.Body), &want) == nil {
+		return reflect.DeepEqual(got, want)
+	}
+	return string(body) == recorded.Body
+}
@@ -0,0 +1,163 @@
+// Copyright 2025 herosizy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cassette
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecordThenReplay(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Set-Cookie", "session=secret")
+		w.Write([]byte(`{"echo":` + string(body) + `}`))
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "cassettes", "echo.json")
+	rec, err := New(path, &Options{Mode: ModeRecord, Transport: srv.Client()})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	send := func(tr http.RoundTripper, body string) string {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/openai/deployments/gpt-4o/chat/completions?api-version=2025-01-01-preview", strings.NewReader(body))
+		req.Header.Set("Api-Key", "secret-key")
+		resp, err := (&http.Client{Transport: tr}).Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		out, _ := io.ReadAll(resp.Body)
+		return string(out)
+	}
+	if got := send(rec, `{"a":1,"b":2}`); got != `{"echo":{"a":1,"b":2}}` {
+		t.Fatalf("Recorded response = %s", got)
+	}
+	if err := rec.Stop(); err != nil {
+		t.Fatalf("Stop() error: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Cassette not written: %v", err)
+	}
+	if strings.Contains(string(data), "secret") {
+		t.Errorf("Cassette should not contain credentials:\n%s", data)
+	}
+	var c Cassette
+	if err := json.Unmarshal(data, &c); err != nil || len(c.Interactions) != 1 {
+		t.Fatalf("Unexpected cassette %s: %v", data, err)
+	}
+	if got := c.Interactions[0].Request.Headers.Get("Api-Key"); got != Redacted {
+		t.Errorf("Api-Key = %q, want %q", got, Redacted)
+	}
+
+	replay, err := New(path, nil)
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	if replay.Mode() != ModeReplay {
+		t.Errorf("Mode() = %q, want %q", replay.Mode(), ModeReplay)
+	}
+	// Key order differs but the JSON body is equivalent
+	if got := send(replay, `{"b":2,"a":1}`); got != `{"echo":{"a":1,"b":2}}` {
+		t.Errorf("Replayed response = %s", got)
+	}
+	if calls != 1 {
+		t.Errorf("Replay should not reach the server, got %d calls", calls)
+	}
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/openai/deployments/gpt-4o/chat/completions?api-version=2025-01-01-preview", strings.NewReader(`{"a":1,"b":2}`))
+	if _, err := replay.Do(req); err == nil {
+		t.Error("Each interaction should only be replayed once")
+	}
+}
+
+func TestMatchers(t *testing.T) {
+	recorded := Request{
+		Method: http.MethodPost,
+		URL:    "https://real.openai.azure.com/openai/deployments/gpt-4o/embeddings?api-version=2025-01-01-preview",
+		Body:   `{"input":["hello"]}`,
+	}
+
+	tests := []struct {
+		name    string
+		method  string
+		url     string
+		body    string
+		matcher Matcher
+		want    bool
+	}{
+		{"different host", http.MethodPost, "https://test.openai.azure.com/openai/deployments/gpt-4o/embeddings?api-version=2025-01-01-preview", `{"input":["hello"]}`, DefaultMatcher, true},
+		{"different path", http.MethodPost, "https://test.openai.azure.com/openai/deployments/other/embeddings?api-version=2025-01-01-preview", `{"input":["hello"]}`, DefaultMatcher, false},
+		{"different query", http.MethodPost, "https://test.openai.azure.com/openai/deployments/gpt-4o/embeddings?api-version=2024-10-21", `{"input":["hello"]}`, DefaultMatcher, false},
+		{"different method", http.MethodGet, "https://test.openai.azure.com/openai/deployments/gpt-4o/embeddings?api-version=2025-01-01-preview", `{"input":["hello"]}`, DefaultMatcher, false},
+		{"different body", http.MethodPost, "https://test.openai.azure.com/openai/deployments/gpt-4o/embeddings?api-version=2025-01-01-preview", `{"input":["bye"]}`, DefaultMatcher, false},
+		{"body ignored", http.MethodPost, "https://test.openai.azure.com/openai/deployments/gpt-4o/embeddings?api-version=2025-01-01-preview", `{"input":["bye"]}`, MatchMethodAndPath, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, tt.url, nil)
+			if got := tt.matcher(req, []byte(tt.body), recorded); got != tt.want {
+				t.Errorf("matcher() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNew_Modes(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing.json")
+
+	if _, err := New(missing, &Options{Mode: ModeReplay}); err == nil {
+		t.Error("Replay should fail when the cassette is missing")
+	}
+	if _, err := New(missing, &Options{Mode: "bogus"}); err == nil {
+		t.Error("Unknown modes should be rejected")
+	}
+
+	rec, err := New(missing, &Options{Mode: ModeAuto})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	if rec.Mode() != ModeRecord {
+		t.Errorf("Auto mode without a cassette should record, got %q", rec.Mode())
+	}
+
+	t.Setenv(ModeEnvVar, string(ModeRecord))
+	rec, err = New(missing, nil)
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	if rec.Mode() != ModeRecord {
+		t.Errorf("Mode should come from %s, got %q", ModeEnvVar, rec.Mode())
+	}
+}
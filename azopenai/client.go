@@ -0,0 +1,57 @@
+// Copyright 2025 herosizy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package azopenai
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/ai/azopenai"
+)
+
+// Client is the subset of the Azure OpenAI API used by the plugin's models and
+// embedders. [*azopenai.Client] implements it and is the default; custom
+// implementations can be supplied through AzureOpenAI.Client for mocking, or
+// layered on with AzureOpenAI.ClientMiddleware.
+type Client interface {
+	GetChatCompletions(ctx context.Context, body azopenai.ChatCompletionsOptions, options *azopenai.GetChatCompletionsOptions) (azopenai.GetChatCompletionsResponse, error)
+	GetChatCompletionsStream(ctx context.Context, body azopenai.ChatCompletionsStreamOptions, options *azopenai.GetChatCompletionsStreamOptions) (azopenai.GetChatCompletionsStreamResponse, error)
+	GetCompletions(ctx context.Context, body azopenai.CompletionsOptions, options *azopenai.GetCompletionsOptions) (azopenai.GetCompletionsResponse, error)
+	GetCompletionsStream(ctx context.Context, body azopenai.CompletionsStreamOptions, options *azopenai.GetCompletionsStreamOptions) (azopenai.GetCompletionsStreamResponse, error)
+	GetEmbeddings(ctx context.Context, body azopenai.EmbeddingsOptions, options *azopenai.GetEmbeddingsOptions) (azopenai.GetEmbeddingsResponse, error)
+	GetImageGenerations(ctx context.Context, body azopenai.ImageGenerationOptions, options *azopenai.GetImageGenerationsOptions) (azopenai.GetImageGenerationsResponse, error)
+}
+
+var _ Client = (*azopenai.Client)(nil)
+
+// ClientMiddleware wraps a Client, for example to add logging, retries or fault injection.
+type ClientMiddleware func(Client) Client
+
+// errNoClient is returned by models and embedders defined without a client
+var errNoClient = errors.New("azopenai: no client configured; initialize the AzureOpenAI plugin first")
+
+// wrapClient applies middleware so that the first entry is the outermost wrapper
+func wrapClient(c Client, mw []ClientMiddleware) Client {
+	for i := len(mw) - 1; i >= 0; i-- {
+		c = mw[i](c)
+	}
+	return c
+}
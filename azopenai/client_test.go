@@ -0,0 +1,133 @@
+// Copyright 2025 herosizy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package azopenai
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/ai/azopenai"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+)
+
+// mockClient answers chat completions with a fixed reply; other methods panic
+type mockClient struct {
+	Client
+	reply    string
+	requests []azopenai.ChatCompletionsOptions
+}
+
+func (m *mockClient) GetChatCompletions(ctx context.Context, body azopenai.ChatCompletionsOptions, options *azopenai.GetChatCompletionsOptions) (azopenai.GetChatCompletionsResponse, error) {
+	m.requests = append(m.requests, body)
+	var resp azopenai.GetChatCompletionsResponse
+	resp.Choices = []azopenai.ChatChoice{{
+		Index:        to.Ptr[int32](0),
+		FinishReason: to.Ptr(azopenai.CompletionsFinishReasonStopped),
+		Message:      &azopenai.ChatResponseMessage{Content: to.Ptr(m.reply)},
+	}}
+	return resp, nil
+}
+
+// tagClient prefixes chat replies to record the order middleware ran in
+type tagClient struct {
+	Client
+	tag string
+}
+
+func (c tagClient) GetChatCompletions(ctx context.Context, body azopenai.ChatCompletionsOptions, options *azopenai.GetChatCompletionsOptions) (azopenai.GetChatCompletionsResponse, error) {
+	resp, err := c.Client.GetChatCompletions(ctx, body, options)
+	if err == nil {
+		resp.Choices[0].Message.Content = to.Ptr(c.tag + *resp.Choices[0].Message.Content)
+	}
+	return resp, err
+}
+
+func tagMiddleware(tag string) ClientMiddleware {
+	return func(next Client) Client { return tagClient{Client: next, tag: tag} }
+}
+
+func TestInit_CustomClient(t *testing.T) {
+	// A custom client needs no credentials
+	t.Setenv("AZURE_OPEN_AI_API_KEY", "")
+	t.Setenv("AZURE_OPEN_AI_ENDPOINT", "")
+
+	ctx := context.Background()
+	g, err := genkit.Init(ctx)
+	if err != nil {
+		t.Fatalf("Failed to initialize Genkit: %v", err)
+	}
+	mock := &mockClient{reply: "mocked"}
+	plugin := &AzureOpenAI{
+		Client:           mock,
+		ClientMiddleware: []ClientMiddleware{tagMiddleware("outer:"), tagMiddleware("inner:")},
+	}
+	if err := plugin.Init(ctx, g); err != nil {
+		t.Fatalf("Init() error: %v", err)
+	}
+
+	resp, err := Model(g, Gpt4o).Generate(ctx, &ai.ModelRequest{
+		Messages: []*ai.Message{ai.NewUserTextMessage("Hello")},
+	}, nil)
+	if err != nil {
+		t.Fatalf("Generate() error: %v", err)
+	}
+	if got := resp.Text(); got != "outer:inner:mocked" {
+		t.Errorf("Text() = %q, want %q", got, "outer:inner:mocked")
+	}
+	if len(mock.requests) != 1 || *mock.requests[0].DeploymentName != Gpt4o {
+		t.Errorf("Unexpected requests %+v", mock.requests)
+	}
+}
+
+func TestDefineModel_Client(t *testing.T) {
+	ctx := context.Background()
+	req := &ai.ModelRequest{Messages: []*ai.Message{ai.NewUserTextMessage("Hello")}}
+	info := &ai.ModelInfo{Supports: &TextModel}
+
+	t.Run("registered plugin", func(t *testing.T) {
+		plugin := &AzureOpenAI{Client: &mockClient{reply: "from plugin"}}
+		g, err := genkit.Init(ctx, genkit.WithPlugins(plugin))
+		if err != nil {
+			t.Fatalf("Failed to initialize Genkit: %v", err)
+		}
+		resp, err := DefineModel(g, "my-deployment", info).Generate(ctx, req, nil)
+		if err != nil {
+			t.Fatalf("Generate() error: %v", err)
+		}
+		if got := resp.Text(); got != "from plugin" {
+			t.Errorf("Text() = %q", got)
+		}
+	})
+
+	t.Run("no plugin", func(t *testing.T) {
+		g, err := genkit.Init(ctx)
+		if err != nil {
+			t.Fatalf("Failed to initialize Genkit: %v", err)
+		}
+		_, err = DefineModel(g, "my-deployment", info).Generate(ctx, req, nil)
+		if !errors.Is(err, errNoClient) {
+			t.Errorf("Expected errNoClient, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,264 @@
+// Copyright 2025 herosizy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package azopenai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/ai/azopenai"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/firebase/genkit/go/ai"
+)
+
+// CompletionsConfig holds per-request settings for instruct models served by
+// the legacy completions endpoint. It is ignored by chat models.
+type CompletionsConfig struct {
+	Suffix   string `json:"suffix,omitempty"`   // Text that follows the completion, for insertions
+	Echo     bool   `json:"echo,omitempty"`     // Return the prompt followed by the completion
+	LogProbs *int32 `json:"logProbs,omitempty"` // Number of most likely tokens to report per position (0 to 5)
+	BestOf   *int32 `json:"bestOf,omitempty"`   // Completions generated server-side, of which the best is returned
+}
+
+// handleCompletionsRequest sends a request to the legacy completions endpoint
+func handleCompletionsRequest(ctx context.Context, client Client, options azopenai.CompletionsOptions, cb ai.ModelStreamCallback) (*ai.ModelResponse, error) {
+	if cb != nil {
+		return handleCompletionsStream(ctx, client, options, cb)
+	}
+
+	resp, err := client.GetCompletions(ctx, options, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get completions: %w", mapAzureError(err))
+	}
+	if len(resp.Choices) == 0 {
+		return nil, errors.New("no choices returned from Azure OpenAI")
+	}
+
+	choice := resp.Choices[0]
+	finishReason := ai.FinishReasonStop
+	if choice.FinishReason != nil {
+		finishReason = convertFinishReason(*choice.FinishReason)
+	}
+	filters := &ContentFilterAnnotations{}
+	filters.addPrompt(resp.PromptFilterResults)
+	filters.addChoice(choice.ContentFilterResults)
+
+	response := &ai.ModelResponse{
+		Message: &ai.Message{
+			Content: []*ai.Part{ai.NewTextPart(deref(choice.Text))},
+			Role:    ai.RoleModel,
+		},
+		FinishReason: finishReason,
+		Usage:        convertUsage(resp.Usage),
+	}
+	applyResponseInfo(response, deref(resp.ID), "")
+	applyContentFilter(response, filters)
+	applyLogProbs(response, convertCompletionsLogProbs(choice.LogProbs))
+	return response, nil
+}
+
+// handleCompletionsStream streams legacy completions, attaching each chunk's log probabilities
+func handleCompletionsStream(ctx context.Context, client Client, options azopenai.CompletionsOptions, cb ai.ModelStreamCallback) (*ai.ModelResponse, error) {
+	resp, err := client.GetCompletionsStream(ctx, toCompletionsStreamOptions(options), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get completions stream: %w", mapAzureError(err))
+	}
+	defer resp.CompletionsStream.Close()
+
+	var text strings.Builder
+	var logProbs []TokenLogProb
+	finishReason := ai.FinishReasonStop
+	filters := &ContentFilterAnnotations{}
+	var id string
+	var usage *azopenai.CompletionsUsage
+
+	for {
+		completion, err := resp.CompletionsStream.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read completion: %w", mapAzureError(err))
+		}
+		if completion.ID != nil && *completion.ID != "" {
+			id = *completion.ID
+		}
+		if completion.Usage != nil {
+			usage = completion.Usage
+		}
+		filters.addPrompt(completion.PromptFilterResults)
+
+		for _, choice := range completion.Choices {
+			filters.addChoice(choice.ContentFilterResults)
+			if choice.FinishReason != nil {
+				finishReason = convertFinishReason(*choice.FinishReason)
+			}
+			content := deref(choice.Text)
+			if content == "" {
+				continue
+			}
+			text.WriteString(content)
+			chunk := &ai.ModelResponseChunk{
+				Content: []*ai.Part{ai.NewTextPart(content)},
+				Role:    ai.RoleModel,
+			}
+			if lp := convertCompletionsLogProbs(choice.LogProbs); lp != nil {
+				logProbs = append(logProbs, lp...)
+				chunk.Custom = &ChunkMetadata{LogProbs: lp}
+			}
+			if err := cb(ctx, chunk); err != nil {
+				return nil, fmt.Errorf("streaming callback error: %w", err)
+			}
+		}
+	}
+
+	response := &ai.ModelResponse{
+		Message: &ai.Message{
+			Content: []*ai.Part{ai.NewTextPart(text.String())},
+			Role:    ai.RoleModel,
+		},
+		FinishReason: finishReason,
+		Usage:        convertUsage(usage),
+	}
+	applyResponseInfo(response, id, "")
+	applyContentFilter(response, filters)
+	applyLogProbs(response, logProbs)
+	return response, nil
+}
+
+// convertToCompletionsRequest converts a Genkit ModelRequest for model to a legacy completions request
+func convertToCompletionsRequest(ctx context.Context, model string, mr *ai.ModelRequest, cfg OpenAIConfig, deployment string) (azopenai.CompletionsOptions, error) {
+	if deployment == "" {
+		return azopenai.CompletionsOptions{}, errors.New("deployment name is required")
+	}
+	if len(mr.Tools) > 0 {
+		return azopenai.CompletionsOptions{}, errors.New("tools are not supported by completions models")
+	}
+	if len(cfg.DataSources) > 0 {
+		return azopenai.CompletionsOptions{}, errors.New("data sources are not supported by completions models")
+	}
+	if cfg.Prediction != nil {
+		return azopenai.CompletionsOptions{}, errors.New("predicted outputs are not supported by completions models")
+	}
+	if cfg.LogProbs || cfg.TopLogProbs != nil {
+		return azopenai.CompletionsOptions{}, errors.New("completions models take log probabilities from CompletionsConfig.LogProbs")
+	}
+
+	msgs := mr.Messages
+	if cfg.Truncation != nil {
+		var err error
+		if msgs, err = truncateMessages(ctx, model, msgs, cfg); err != nil {
+			return azopenai.CompletionsOptions{}, err
+		}
+	}
+
+	options := azopenai.CompletionsOptions{
+		Prompt:           []string{flattenMessages(msgs)},
+		DeploymentName:   &deployment,
+		MaxTokens:        cfg.MaxTokens,
+		Temperature:      cfg.Temperature,
+		TopP:             cfg.TopP,
+		PresencePenalty:  cfg.PresencePenalty,
+		FrequencyPenalty: cfg.FrequencyPenalty,
+	}
+	if len(cfg.LogitBias) > 0 {
+		options.LogitBias = cfg.LogitBias
+	}
+	if cfg.User != "" {
+		options.User = &cfg.User
+	}
+	if cfg.Seed != nil {
+		options.Seed = to.Ptr(int32(*cfg.Seed))
+	}
+	if cc := cfg.Completions; cc != nil {
+		if cc.Suffix != "" {
+			options.Suffix = &cc.Suffix
+		}
+		if cc.Echo {
+			options.Echo = to.Ptr(true)
+		}
+		options.LogProbs = cc.LogProbs
+		options.BestOf = cc.BestOf
+	}
+	return options, nil
+}
+
+// flattenMessages renders a conversation as a single prompt. A single user
+// turn, with any system instructions, is sent as plain text; longer
+// conversations become a labelled transcript ending with an open assistant turn.
+func flattenMessages(msgs []*ai.Message) string {
+	var system []string
+	var turns []*ai.Message
+	for _, msg := range msgs {
+		if msg.Role == ai.RoleSystem {
+			system = append(system, extractTextContent(msg.Content))
+		} else {
+			turns = append(turns, msg)
+		}
+	}
+	if len(turns) == 1 && turns[0].Role == ai.RoleUser {
+		return strings.Join(append(system, extractTextContent(turns[0].Content)), "\n\n")
+	}
+
+	var b strings.Builder
+	for _, s := range system {
+		b.WriteString(s)
+		b.WriteString("\n\n")
+	}
+	for _, msg := range turns {
+		label := "User"
+		switch msg.Role {
+		case ai.RoleModel:
+			label = "Assistant"
+		case ai.RoleTool:
+			label = "Tool"
+		}
+		fmt.Fprintf(&b, "%s: %s\n\n", label, extractTextContent(msg.Content))
+	}
+	b.WriteString("Assistant:")
+	return b.String()
+}
+
+// toCompletionsStreamOptions converts completions options to their streaming equivalent
+func toCompletionsStreamOptions(options azopenai.CompletionsOptions) azopenai.CompletionsStreamOptions {
+	return azopenai.CompletionsStreamOptions{
+		Prompt:           options.Prompt,
+		DeploymentName:   options.DeploymentName,
+		BestOf:           options.BestOf,
+		Echo:             options.Echo,
+		FrequencyPenalty: options.FrequencyPenalty,
+		LogitBias:        options.LogitBias,
+		LogProbs:         options.LogProbs,
+		MaxTokens:        options.MaxTokens,
+		PresencePenalty:  options.PresencePenalty,
+		Seed:             options.Seed,
+		Stop:             options.Stop,
+		Suffix:           options.Suffix,
+		Temperature:      options.Temperature,
+		TopP:             options.TopP,
+		User:             options.User,
+		N:                to.Ptr[int32](1),
+		StreamOptions:    &azopenai.ChatCompletionStreamOptions{IncludeUsage: to.Ptr(true)},
+	}
+}
@@ -0,0 +1,246 @@
+// Copyright 2025 herosizy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package azopenai
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/HeroSizy/genkit-go-plugins/azopenai/azopenaitest"
+	"github.com/firebase/genkit/go/ai"
+)
+
+func TestCompletions_NonStreaming(t *testing.T) {
+	g, srv := initWithFakeServer(t)
+	srv.QueueCompletion(azopenaitest.ChatReply{
+		Chunks: []string{" Paris", "."},
+		Usage:  &azopenaitest.Usage{PromptTokens: 6, CompletionTokens: 2},
+	})
+
+	req := &ai.ModelRequest{
+		Messages: []*ai.Message{
+			ai.NewSystemTextMessage("Answer briefly."),
+			ai.NewUserTextMessage("Capital of France?"),
+		},
+		Config: &OpenAIConfig{
+			DeploymentName: "instruct",
+			Seed:           to.Ptr[int64](7),
+			Completions: &CompletionsConfig{
+				Suffix:   "END",
+				Echo:     true,
+				LogProbs: to.Ptr[int32](2),
+				BestOf:   to.Ptr[int32](3),
+			},
+		},
+	}
+	resp, err := Model(g, Gpt35TurboInstruct).Generate(context.Background(), req, nil)
+	if err != nil {
+		t.Fatalf("Generate() error: %v", err)
+	}
+
+	const prompt = "Answer briefly.\n\nCapital of France?"
+	if resp.Text() != prompt+" Paris." {
+		t.Errorf("Expected the echoed prompt and completion, got %q", resp.Text())
+	}
+	if resp.Usage == nil || resp.Usage.TotalTokens != 8 {
+		t.Errorf("Unexpected usage %+v", resp.Usage)
+	}
+	md := ResponseMetadataFrom(resp)
+	if md == nil || len(md.LogProbs) != 2 {
+		t.Fatalf("Expected 2 token log probabilities, got %+v", md)
+	}
+	if lp := md.LogProbs[1]; lp.Token != "." || lp.LogProb != -0.2 || len(lp.TopLogProbs) != 2 || lp.TopLogProbs[0].Token != "." {
+		t.Errorf("Unexpected log probability %+v", lp)
+	}
+
+	sent := srv.Requests()[0]
+	if sent.Endpoint != azopenaitest.EndpointCompletions || sent.Deployment != "instruct" {
+		t.Fatalf("Expected a completions request for instruct, got %s %q", sent.Endpoint, sent.Deployment)
+	}
+	body := sent.JSON()
+	if got := body["prompt"].([]any)[0]; got != prompt {
+		t.Errorf("prompt = %q", got)
+	}
+	for key, want := range map[string]any{"suffix": "END", "echo": true, "logprobs": float64(2), "best_of": float64(3), "seed": float64(7)} {
+		if body[key] != want {
+			t.Errorf("%s = %v, want %v", key, body[key], want)
+		}
+	}
+}
+
+func TestCompletions_Streaming(t *testing.T) {
+	g, srv := initWithFakeServer(t)
+	srv.QueueCompletion(azopenaitest.ChatReply{Chunks: []string{"Once", " upon", " a time"}, FinishReason: "length"})
+
+	req := helloRequest()
+	req.Config.(*OpenAIConfig).Completions = &CompletionsConfig{LogProbs: to.Ptr[int32](1)}
+	var chunks []string
+	var chunkLogProbs int
+	resp, err := Model(g, Gpt35TurboInstruct).Generate(context.Background(), req, func(ctx context.Context, c *ai.ModelResponseChunk) error {
+		chunks = append(chunks, c.Text())
+		if md := ChunkMetadataFrom(c); md != nil {
+			chunkLogProbs += len(md.LogProbs)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Generate() error: %v", err)
+	}
+	if strings.Join(chunks, "|") != "Once| upon| a time" || chunkLogProbs != 3 {
+		t.Errorf("Unexpected chunks %q with %d log probabilities", chunks, chunkLogProbs)
+	}
+	if resp.Text() != "Once upon a time" || resp.FinishReason != ai.FinishReasonLength {
+		t.Errorf("Unexpected response %q (%s)", resp.Text(), resp.FinishReason)
+	}
+	if md := ResponseMetadataFrom(resp); md == nil || len(md.LogProbs) != 3 || md.LogProbs[2].Token != " a time" {
+		t.Errorf("Unexpected log probabilities %+v", md)
+	}
+	if resp.Usage == nil || resp.Usage.InputTokens == 0 {
+		t.Errorf("Expected usage from the final chunk, got %+v", resp.Usage)
+	}
+}
+
+func TestFlattenMessages(t *testing.T) {
+	tests := []struct {
+		name string
+		msgs []*ai.Message
+		want string
+	}{
+		{
+			name: "single user turn",
+			msgs: []*ai.Message{ai.NewUserTextMessage("Hi")},
+			want: "Hi",
+		},
+		{
+			name: "system and user",
+			msgs: []*ai.Message{ai.NewSystemTextMessage("Be brief."), ai.NewUserTextMessage("Hi")},
+			want: "Be brief.\n\nHi",
+		},
+		{
+			name: "conversation",
+			msgs: []*ai.Message{
+				ai.NewSystemTextMessage("Be brief."),
+				ai.NewUserTextMessage("Hi"),
+				ai.NewModelTextMessage("Hello!"),
+				ai.NewUserTextMessage("Bye"),
+			},
+			want: "Be brief.\n\nUser: Hi\n\nAssistant: Hello!\n\nUser: Bye\n\nAssistant:",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := flattenMessages(tt.msgs); got != tt.want {
+				t.Errorf("flattenMessages() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompletions_DefinedModel(t *testing.T) {
+	summaries := 0
+	var plugin *AzureOpenAI
+	g, srv := initPlugin(t, func(p *AzureOpenAI) {
+		plugin = p
+		p.CompletionsModels = []string{"davinci-002"}
+		p.Cache = &CacheOptions{}
+		p.Middleware = []Middleware{{
+			Chat: func(next ChatHandler) ChatHandler {
+				return func(ctx context.Context, call *ChatCall) (*ai.ModelResponse, error) {
+					if call.Options != nil || call.Completions == nil {
+						t.Error("Completions models should only carry a completions request")
+					}
+					call.Completions.User = to.Ptr("from-middleware")
+					return next(ctx, call)
+				}
+			},
+		}}
+	})
+	info := ai.ModelInfo{Label: "Davinci", Supports: &ai.ModelSupports{Multiturn: true}}
+	model, err := plugin.DefineModel(g, "davinci-002", &info)
+	if err != nil {
+		t.Fatalf("DefineModel() error: %v", err)
+	}
+	srv.QueueCompletion(azopenaitest.ChatReply{Content: "first"}, azopenaitest.ChatReply{Content: "second"})
+
+	generate := func(suffix string) *ai.ModelResponse {
+		t.Helper()
+		resp, err := model.Generate(context.Background(), &ai.ModelRequest{
+			Messages: []*ai.Message{ai.NewUserTextMessage(strings.Repeat("old ", 200)), ai.NewModelTextMessage("ok"), ai.NewUserTextMessage("Hi")},
+			Config: &OpenAIConfig{
+				Completions: &CompletionsConfig{Suffix: suffix},
+				Truncation: &TruncationConfig{Strategy: TruncationSummarize, MaxInputTokens: 50, Summarizer: func(context.Context, []*ai.Message) (string, error) {
+					summaries++
+					return "earlier chat", nil
+				}},
+			},
+		}, nil)
+		if err != nil {
+			t.Fatalf("Generate() error: %v", err)
+		}
+		return resp
+	}
+
+	if resp := generate("a"); resp.Text() != "first" {
+		t.Errorf("Unexpected response %q", resp.Text())
+	}
+	if summaries != 1 {
+		t.Errorf("History was summarized %d times, want 1", summaries)
+	}
+	sent := srv.Requests()[0]
+	if sent.Endpoint != azopenaitest.EndpointCompletions || sent.Deployment != "davinci-002" {
+		t.Fatalf("Expected a completions request for davinci-002, got %s %q", sent.Endpoint, sent.Deployment)
+	}
+	if user := sent.JSON()["user"]; user != "from-middleware" {
+		t.Errorf("Middleware edits were not sent, user = %v", user)
+	}
+	if resp := generate("b"); resp.Text() != "second" || ResponseMetadataFrom(resp).Cached {
+		t.Error("Requests with other completions settings should not share a cache entry")
+	}
+	if resp := generate("a"); resp.Text() != "first" || !ResponseMetadataFrom(resp).Cached {
+		t.Error("Expected a cache hit for an identical request")
+	}
+}
+
+func TestConvertToCompletionsRequest_Unsupported(t *testing.T) {
+	req := &ai.ModelRequest{
+		Messages: []*ai.Message{ai.NewUserTextMessage("Hi")},
+		Tools:    []*ai.ToolDefinition{{Name: "lookup"}},
+	}
+	if _, err := convertToCompletionsRequest(context.Background(), "", req, OpenAIConfig{}, "instruct"); err == nil {
+		t.Error("Expected tools to be rejected")
+	}
+	req.Tools = nil
+	if _, err := convertToCompletionsRequest(context.Background(), "", req, OpenAIConfig{}, ""); err == nil {
+		t.Error("Expected a missing deployment to be rejected")
+	}
+}
+
+func TestUsesCompletions(t *testing.T) {
+	if !usesCompletions(Gpt35TurboInstruct) || usesCompletions(Gpt35Turbo) {
+		t.Error("Only instruct models should use the completions endpoint")
+	}
+	models, _ := listModels()
+	if models[Gpt35TurboInstruct].Supports.Tools {
+		t.Error("Instruct models should not advertise tool support")
+	}
+}
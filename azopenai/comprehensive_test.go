@@ -364,7 +364,7 @@ func TestConvertToAzureOpenAIRequest_Comprehensive(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result, err := convertToAzureOpenAIRequest(tt.request, tt.config)
+			result, err := convertToAzureOpenAIRequest(context.Background(), "", tt.request, tt.config)
 			if tt.hasError && err == nil {
 				t.Error("Expected error but got none")
 			}
@@ -520,7 +520,7 @@ func TestConvertTools_InvalidJSONSchema(t *testing.T) {
 		},
 	}
 
-	_, err := convertTools(tools)
+	_, err := convertTools(tools, false)
 	if err == nil {
 		t.Error("Expected error for invalid JSON schema")
 	}
@@ -544,7 +544,7 @@ func TestConvertToAzureOpenAIRequest_EmptyDeploymentName(t *testing.T) {
 		// DeploymentName is empty
 	}
 
-	_, err := convertToAzureOpenAIRequest(request, config)
+	_, err := convertToAzureOpenAIRequest(context.Background(), "", request, config)
 	if err == nil {
 		t.Error("Expected error for empty deployment name")
 	}
@@ -748,7 +748,7 @@ func TestRequestHandling_BasicValidation(t *testing.T) {
 				},
 			}
 
-			_, err := convertToAzureOpenAIRequest(request, tt.config)
+			_, err := convertToAzureOpenAIRequest(context.Background(), "", request, tt.config)
 
 			if tt.wantError && err == nil {
 				t.Error("Expected error but got none")
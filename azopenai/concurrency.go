@@ -0,0 +1,206 @@
+// Copyright 2025 herosizy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package azopenai
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// ConcurrencyLimits caps the requests in flight to each deployment. Requests over
+// the limit wait in a bounded queue and are admitted by priority, then in arrival
+// order. Chat and embedding calls are limited; cache hits do not take a slot.
+type ConcurrencyLimits struct {
+	Default     ConcurrencyLimit            // Limit for deployments without their own entry
+	Deployments map[string]ConcurrencyLimit // Limits by deployment name
+}
+
+// ConcurrencyLimit is the concurrency limit of one deployment.
+type ConcurrencyLimit struct {
+	MaxConcurrent int // Requests in flight at once. Zero is unlimited.
+	MaxQueued     int // Requests waiting for a slot. When the queue is full, QueueFullError is returned. Zero means requests do not wait.
+}
+
+// Priority orders requests waiting for a concurrency slot. Set it with [WithPriority].
+type Priority int
+
+const (
+	PriorityLow Priority = iota - 1
+	PriorityNormal
+	PriorityHigh
+)
+
+// String returns the name of the priority.
+func (p Priority) String() string {
+	switch p {
+	case PriorityLow:
+		return "low"
+	case PriorityHigh:
+		return "high"
+	default:
+		return "normal"
+	}
+}
+
+type priorityKey struct{}
+
+// WithPriority returns a context whose model and embedder calls wait for a
+// concurrency slot with priority p. Calls default to PriorityNormal.
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+// priorityFrom returns the priority of ctx, clamped to the known classes
+func priorityFrom(ctx context.Context) Priority {
+	p, _ := ctx.Value(priorityKey{}).(Priority)
+	return min(max(p, PriorityLow), PriorityHigh)
+}
+
+// QueueFullError is returned when a deployment is at its concurrency limit and
+// its wait queue is full.
+type QueueFullError struct {
+	Deployment    string // Deployment that is at its limit
+	MaxConcurrent int    // Requests in flight at once
+	MaxQueued     int    // Requests waiting for a slot
+}
+
+// Error implements the error interface.
+func (e *QueueFullError) Error() string {
+	return fmt.Sprintf("azopenai: deployment %q is at its limit of %d concurrent requests with %d queued", e.Deployment, e.MaxConcurrent, e.MaxQueued)
+}
+
+// limiter enforces ConcurrencyLimits. A nil limiter admits every request.
+type limiter struct {
+	limits ConcurrencyLimits
+	tel    *telemetry
+	mu     sync.Mutex
+	queues map[string]*deploymentQueue
+}
+
+// deploymentQueue tracks the slots and waiters of one deployment
+type deploymentQueue struct {
+	limit   ConcurrencyLimit
+	active  int
+	waiting [PriorityHigh - PriorityLow + 1][]chan struct{} // FIFO queues indexed by priority
+	queued  int
+}
+
+func newLimiter(limits ConcurrencyLimits, tel *telemetry) *limiter {
+	return &limiter{limits: limits, tel: tel, queues: map[string]*deploymentQueue{}}
+}
+
+// acquire waits for a slot on deployment and returns the function that releases it.
+// Waiting ends early with ctx's error when ctx is done.
+func (l *limiter) acquire(ctx context.Context, deployment string) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	l.mu.Lock()
+	q := l.queue(deployment)
+	if q == nil {
+		l.mu.Unlock()
+		return func() {}, nil
+	}
+	if q.active < q.limit.MaxConcurrent && q.queued == 0 {
+		q.active++
+		l.mu.Unlock()
+		return l.admitted(ctx, q, deployment), nil
+	}
+	if q.queued >= q.limit.MaxQueued {
+		l.mu.Unlock()
+		return nil, &QueueFullError{Deployment: deployment, MaxConcurrent: q.limit.MaxConcurrent, MaxQueued: q.limit.MaxQueued}
+	}
+	p := priorityFrom(ctx)
+	ready := make(chan struct{})
+	q.waiting[p-PriorityLow] = append(q.waiting[p-PriorityLow], ready)
+	q.queued++
+	l.mu.Unlock()
+
+	attrs := metric.WithAttributes(attribute.String(attrRequestDeployment, deployment), attribute.String(attrPriority, p.String()))
+	l.tel.queueDepth.Add(ctx, 1, attrs)
+	defer l.tel.queueDepth.Add(ctx, -1, attrs)
+	start := time.Now()
+	defer func() { l.tel.queueWait.Record(ctx, time.Since(start).Seconds(), attrs) }()
+
+	select {
+	case <-ready:
+		return l.admitted(ctx, q, deployment), nil
+	case <-ctx.Done():
+	}
+	l.mu.Lock()
+	w := &q.waiting[p-PriorityLow]
+	if i := slices.Index(*w, ready); i >= 0 {
+		*w = slices.Delete(*w, i, i+1)
+		q.queued--
+		l.mu.Unlock()
+		return nil, ctx.Err()
+	}
+	l.mu.Unlock()
+	// The slot was handed over as ctx was done; pass it on
+	l.admitted(ctx, q, deployment)()
+	return nil, ctx.Err()
+}
+
+// queue returns the queue of deployment, or nil if it is unlimited. l.mu must be held.
+func (l *limiter) queue(deployment string) *deploymentQueue {
+	if q, ok := l.queues[deployment]; ok {
+		return q
+	}
+	limit, ok := l.limits.Deployments[deployment]
+	if !ok {
+		limit = l.limits.Default
+	}
+	var q *deploymentQueue
+	if limit.MaxConcurrent > 0 {
+		q = &deploymentQueue{limit: limit}
+	}
+	l.queues[deployment] = q
+	return q
+}
+
+// admitted counts a request holding a slot and returns the function that
+// releases the slot, handing it to the next waiter if there is one
+func (l *limiter) admitted(ctx context.Context, q *deploymentQueue, deployment string) func() {
+	attrs := metric.WithAttributes(attribute.String(attrRequestDeployment, deployment))
+	l.tel.activeRequests.Add(ctx, 1, attrs)
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.tel.activeRequests.Add(context.WithoutCancel(ctx), -1, attrs)
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			for i := len(q.waiting) - 1; i >= 0; i-- {
+				if len(q.waiting[i]) > 0 {
+					close(q.waiting[i][0])
+					q.waiting[i] = q.waiting[i][1:]
+					q.queued--
+					return
+				}
+			}
+			q.active--
+		})
+	}
+}
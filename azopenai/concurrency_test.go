@@ -0,0 +1,218 @@
+// Copyright 2025 herosizy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package azopenai
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/ai/azopenai"
+	"github.com/HeroSizy/genkit-go-plugins/azopenai/azopenaitest"
+)
+
+// waitQueued blocks until n requests are queued for deployment
+func waitQueued(t *testing.T, l *limiter, deployment string, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		l.mu.Lock()
+		queued := l.queues[deployment].queued
+		l.mu.Unlock()
+		if queued == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("Timed out waiting for %d queued requests", n)
+}
+
+func TestLimiter_Priority(t *testing.T) {
+	tel, _, reader := newTestTelemetry(false)
+	l := newLimiter(ConcurrencyLimits{Default: ConcurrencyLimit{MaxConcurrent: 1, MaxQueued: 3}}, tel)
+	ctx := context.Background()
+
+	release, err := l.acquire(ctx, "chat")
+	if err != nil {
+		t.Fatalf("acquire failed: %v", err)
+	}
+
+	var (
+		mu    sync.Mutex
+		order []string
+		wg    sync.WaitGroup
+	)
+	enqueue := func(name string, p Priority, queued int) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := l.acquire(WithPriority(ctx, p), "chat")
+			if err != nil {
+				t.Errorf("acquire %s failed: %v", name, err)
+				return
+			}
+			mu.Lock()
+			order = append(order, name)
+			mu.Unlock()
+			release()
+		}()
+		waitQueued(t, l, "chat", queued)
+	}
+	enqueue("low", PriorityLow, 1)
+	enqueue("normal", PriorityNormal, 2)
+	enqueue("high", PriorityHigh, 3)
+
+	var full *QueueFullError
+	if _, err := l.acquire(ctx, "chat"); !errors.As(err, &full) || full.Deployment != "chat" {
+		t.Errorf("Expected *QueueFullError, got %v", err)
+	}
+	if r, err := l.acquire(ctx, "other"); err != nil {
+		t.Errorf("Expected deployments to have separate slots, got %v", err)
+	} else {
+		r()
+	}
+
+	release()
+	wg.Wait()
+	if want := []string{"high", "normal", "low"}; !slices.Equal(order, want) {
+		t.Errorf("Admission order = %v, want %v", order, want)
+	}
+
+	names := collectMetricNames(t, reader)
+	for _, name := range []string{metricQueueDepth, metricQueueWait, metricActiveRequests} {
+		if !names[name] {
+			t.Errorf("Expected metric %s to be recorded", name)
+		}
+	}
+}
+
+func TestLimiter_Cancel(t *testing.T) {
+	tel, _, _ := newTestTelemetry(false)
+	l := newLimiter(ConcurrencyLimits{Deployments: map[string]ConcurrencyLimit{"chat": {MaxConcurrent: 1, MaxQueued: 1}}}, tel)
+
+	release, err := l.acquire(context.Background(), "chat")
+	if err != nil {
+		t.Fatalf("acquire failed: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := l.acquire(ctx, "chat")
+		done <- err
+	}()
+	waitQueued(t, l, "chat", 1)
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+
+	// The cancelled request left the queue, and the slot is still released normally
+	release()
+	release()
+	if r, err := l.acquire(context.Background(), "chat"); err != nil {
+		t.Errorf("Expected a free slot, got %v", err)
+	} else {
+		r()
+	}
+
+	// Deployments without a limit, and a nil limiter, admit everything
+	for range 3 {
+		if _, err := l.acquire(context.Background(), "unlimited"); err != nil {
+			t.Errorf("Expected no limit, got %v", err)
+		}
+	}
+	var nilLimiter *limiter
+	if _, err := nilLimiter.acquire(context.Background(), "chat"); err != nil {
+		t.Errorf("Expected a nil limiter to admit requests, got %v", err)
+	}
+}
+
+// peakClient records the peak number of concurrent chat completion calls
+type peakClient struct {
+	Client
+	active, peak *atomic.Int32
+}
+
+func (c peakClient) GetChatCompletions(ctx context.Context, body azopenai.ChatCompletionsOptions, options *azopenai.GetChatCompletionsOptions) (azopenai.GetChatCompletionsResponse, error) {
+	n := c.active.Add(1)
+	defer c.active.Add(-1)
+	for {
+		peak := c.peak.Load()
+		if n <= peak || c.peak.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+	return c.Client.GetChatCompletions(ctx, body, options)
+}
+
+func TestConcurrency(t *testing.T) {
+	tests := []struct {
+		name     string
+		limit    ConcurrencyLimit
+		wantPeak int32
+		wantFull int // Requests rejected with QueueFullError
+	}{
+		{name: "queued", limit: ConcurrencyLimit{MaxConcurrent: 2, MaxQueued: 10}, wantPeak: 2},
+		{name: "queue full", limit: ConcurrencyLimit{MaxConcurrent: 1, MaxQueued: 1}, wantPeak: 1, wantFull: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			var active, peak atomic.Int32
+			g, srv := initPlugin(t, func(p *AzureOpenAI) {
+				p.ClientMiddleware = []ClientMiddleware{func(c Client) Client { return peakClient{Client: c, active: &active, peak: &peak} }}
+				p.Concurrency = &ConcurrencyLimits{Deployments: map[string]ConcurrencyLimit{"chat": tt.limit}}
+			})
+			srv.OnChat(func(azopenaitest.Request) azopenaitest.ChatReply {
+				return azopenaitest.ChatReply{Content: "ok", Delay: 50 * time.Millisecond}
+			})
+
+			var (
+				wg   sync.WaitGroup
+				full atomic.Int32
+			)
+			for range 6 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					_, err := Model(g, Gpt4o).Generate(ctx, helloRequest(), nil)
+					var qf *QueueFullError
+					if errors.As(err, &qf) {
+						full.Add(1)
+					} else if err != nil {
+						t.Errorf("Generate failed: %v", err)
+					}
+				}()
+			}
+			wg.Wait()
+
+			if got := peak.Load(); got != tt.wantPeak {
+				t.Errorf("Peak concurrency = %d, want %d", got, tt.wantPeak)
+			}
+			if got := int(full.Load()); got != tt.wantFull {
+				t.Errorf("Rejected requests = %d, want %d", got, tt.wantFull)
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+// Copyright 2025 herosizy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package azopenai
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/ai/azopenai"
+)
+
+// ContentFilterAnnotations holds the content filter results Azure returned for a request.
+// Categories are keyed by their Azure names, e.g. "hate", "sexual", "violence", "self_harm",
+// "jailbreak", "protected_material_text" or "protected_material_code".
+type ContentFilterAnnotations struct {
+	Prompt     map[string]ContentFilterCategory `json:"prompt,omitempty"`     // Results for the prompt
+	Completion map[string]ContentFilterCategory `json:"completion,omitempty"` // Results for the generated completion
+}
+
+// severityRank orders content filter severities from least to most severe.
+var severityRank = map[string]int{
+	string(azopenai.ContentFilterSeveritySafe):   1,
+	string(azopenai.ContentFilterSeverityLow):    2,
+	string(azopenai.ContentFilterSeverityMedium): 3,
+	string(azopenai.ContentFilterSeverityHigh):   4,
+}
+
+// isEmpty reports whether no content filter results were collected.
+func (a *ContentFilterAnnotations) isEmpty() bool {
+	return a == nil || (len(a.Prompt) == 0 && len(a.Completion) == 0)
+}
+
+// addPrompt merges the prompt filter results into the annotations.
+func (a *ContentFilterAnnotations) addPrompt(results []azopenai.ContentFilterResultsForPrompt) {
+	for _, r := range results {
+		a.Prompt = mergeFilterCategories(a.Prompt, promptFilterCategories(r.ContentFilterResults))
+	}
+}
+
+// addChoice merges the choice filter results into the annotations.
+func (a *ContentFilterAnnotations) addChoice(r *azopenai.ContentFilterResultsForChoice) {
+	a.Completion = mergeFilterCategories(a.Completion, choiceFilterCategories(r))
+}
+
+// blockedMessage describes the categories that caused content to be filtered.
+func (a *ContentFilterAnnotations) blockedMessage() string {
+	var reasons []string
+	for _, m := range []map[string]ContentFilterCategory{a.Prompt, a.Completion} {
+		names := make([]string, 0, len(m))
+		for name := range m {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			c := m[name]
+			if !c.Filtered {
+				continue
+			}
+			if c.Severity != "" {
+				reasons = append(reasons, fmt.Sprintf("%s (%s)", name, c.Severity))
+			} else {
+				reasons = append(reasons, name)
+			}
+		}
+	}
+	if len(reasons) == 0 {
+		return "content filtered by Azure OpenAI"
+	}
+	return "content filtered by Azure OpenAI: " + strings.Join(reasons, ", ")
+}
+
+// promptFilterCategories converts prompt filter results to categories.
+func promptFilterCategories(r *azopenai.ContentFilterResultDetailsForPrompt) map[string]ContentFilterCategory {
+	if r == nil {
+		return nil
+	}
+	m := map[string]ContentFilterCategory{}
+	addSeverityResult(m, "hate", r.Hate)
+	addSeverityResult(m, "sexual", r.Sexual)
+	addSeverityResult(m, "violence", r.Violence)
+	addSeverityResult(m, "self_harm", r.SelfHarm)
+	addDetectionResult(m, "jailbreak", r.Jailbreak)
+	addDetectionResult(m, "indirect_attack", r.IndirectAttack)
+	addDetectionResult(m, "profanity", r.Profanity)
+	addBlocklistResult(m, r.CustomBlockLists)
+	return m
+}
+
+// choiceFilterCategories converts choice filter results to categories.
+func choiceFilterCategories(r *azopenai.ContentFilterResultsForChoice) map[string]ContentFilterCategory {
+	if r == nil {
+		return nil
+	}
+	m := map[string]ContentFilterCategory{}
+	addSeverityResult(m, "hate", r.Hate)
+	addSeverityResult(m, "sexual", r.Sexual)
+	addSeverityResult(m, "violence", r.Violence)
+	addSeverityResult(m, "self_harm", r.SelfHarm)
+	addDetectionResult(m, "profanity", r.Profanity)
+	addDetectionResult(m, "protected_material_text", r.ProtectedMaterialText)
+	if r.ProtectedMaterialCode != nil {
+		m["protected_material_code"] = ContentFilterCategory{
+			Filtered: deref(r.ProtectedMaterialCode.Filtered),
+			Detected: deref(r.ProtectedMaterialCode.Detected),
+		}
+	}
+	if r.UngroundedMaterial != nil {
+		m["ungrounded_material"] = ContentFilterCategory{
+			Filtered: deref(r.UngroundedMaterial.Filtered),
+			Detected: deref(r.UngroundedMaterial.Detected),
+		}
+	}
+	addBlocklistResult(m, r.CustomBlockLists)
+	return m
+}
+
+func addSeverityResult(m map[string]ContentFilterCategory, name string, r *azopenai.ContentFilterResult) {
+	if r == nil {
+		return
+	}
+	c := ContentFilterCategory{Filtered: deref(r.Filtered)}
+	if r.Severity != nil {
+		c.Severity = string(*r.Severity)
+	}
+	m[name] = c
+}
+
+func addDetectionResult(m map[string]ContentFilterCategory, name string, r *azopenai.ContentFilterDetectionResult) {
+	if r == nil {
+		return
+	}
+	m[name] = ContentFilterCategory{Filtered: deref(r.Filtered), Detected: deref(r.Detected)}
+}
+
+func addBlocklistResult(m map[string]ContentFilterCategory, r *azopenai.ContentFilterDetailedResults) {
+	if r == nil {
+		return
+	}
+	m["custom_blocklists"] = ContentFilterCategory{Filtered: deref(r.Filtered)}
+}
+
+// mergeFilterCategories merges src into dst, keeping the most severe result per category.
+func mergeFilterCategories(dst, src map[string]ContentFilterCategory) map[string]ContentFilterCategory {
+	if len(src) == 0 {
+		return dst
+	}
+	if dst == nil {
+		dst = make(map[string]ContentFilterCategory, len(src))
+	}
+	for name, c := range src {
+		prev, ok := dst[name]
+		if !ok {
+			dst[name] = c
+			continue
+		}
+		prev.Filtered = prev.Filtered || c.Filtered
+		prev.Detected = prev.Detected || c.Detected
+		if severityRank[c.Severity] > severityRank[prev.Severity] {
+			prev.Severity = c.Severity
+		}
+		dst[name] = prev
+	}
+	return dst
+}
+
+// deref returns the value of p, or the zero value if p is nil.
+func deref[T any](p *T) T {
+	var zero T
+	if p == nil {
+		return zero
+	}
+	return *p
+}
@@ -0,0 +1,241 @@
+// Copyright 2025 herosizy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package azopenai
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/ai/azopenai"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/firebase/genkit/go/ai"
+)
+
+const filteredChatCompletion = `{
+	"id": "chatcmpl-1",
+	"object": "chat.completion",
+	"created": 1700000000,
+	"model": "gpt-4o",
+	"prompt_filter_results": [{
+		"prompt_index": 0,
+		"content_filter_results": {
+			"hate": {"filtered": false, "severity": "safe"},
+			"jailbreak": {"filtered": false, "detected": false}
+		}
+	}],
+	"choices": [{
+		"index": 0,
+		"finish_reason": "content_filter",
+		"message": {"role": "assistant", "content": ""},
+		"content_filter_results": {
+			"violence": {"filtered": true, "severity": "high"},
+			"protected_material_text": {"filtered": false, "detected": true}
+		}
+	}]
+}`
+
+// newTestClient returns an Azure OpenAI client that talks to handler over TLS
+func newTestClient(t *testing.T, handler http.HandlerFunc) *azopenai.Client {
+	t.Helper()
+	srv := httptest.NewTLSServer(handler)
+	t.Cleanup(srv.Close)
+
+	client, err := azopenai.NewClientWithKeyCredential(srv.URL, azcore.NewKeyCredential("test-key"), &azopenai.ClientOptions{
+		ClientOptions: azcore.ClientOptions{
+			Transport: srv.Client(),
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	return client
+}
+
+func TestChoiceFilterCategories(t *testing.T) {
+	high := azopenai.ContentFilterSeverityHigh
+	r := &azopenai.ContentFilterResultsForChoice{
+		Violence:              &azopenai.ContentFilterResult{Filtered: to.Ptr(true), Severity: &high},
+		ProtectedMaterialText: &azopenai.ContentFilterDetectionResult{Filtered: to.Ptr(false), Detected: to.Ptr(true)},
+		ProtectedMaterialCode: &azopenai.ContentFilterCitedDetectionResult{Filtered: to.Ptr(true), Detected: to.Ptr(true)},
+	}
+
+	got := choiceFilterCategories(r)
+	if c := got["violence"]; !c.Filtered || c.Severity != "high" {
+		t.Errorf("violence = %+v, want filtered high", c)
+	}
+	if c := got["protected_material_text"]; c.Filtered || !c.Detected {
+		t.Errorf("protected_material_text = %+v, want detected only", c)
+	}
+	if c := got["protected_material_code"]; !c.Filtered {
+		t.Errorf("protected_material_code = %+v, want filtered", c)
+	}
+	if _, ok := got["hate"]; ok {
+		t.Error("Missing categories should not be reported")
+	}
+	if choiceFilterCategories(nil) != nil {
+		t.Error("choiceFilterCategories(nil) should return nil")
+	}
+}
+
+func TestMergeFilterCategories(t *testing.T) {
+	dst := map[string]ContentFilterCategory{
+		"hate": {Filtered: false, Severity: "low"},
+	}
+	src := map[string]ContentFilterCategory{
+		"hate":      {Filtered: true, Severity: "medium"},
+		"jailbreak": {Detected: true},
+	}
+
+	got := mergeFilterCategories(dst, src)
+	if c := got["hate"]; !c.Filtered || c.Severity != "medium" {
+		t.Errorf("hate = %+v, want filtered medium", c)
+	}
+	if !got["jailbreak"].Detected {
+		t.Error("jailbreak should be merged in")
+	}
+
+	got = mergeFilterCategories(got, map[string]ContentFilterCategory{"hate": {Severity: "safe"}})
+	if c := got["hate"]; !c.Filtered || c.Severity != "medium" {
+		t.Errorf("Merging a less severe result should not downgrade, got %+v", c)
+	}
+}
+
+func TestBlockedMessage(t *testing.T) {
+	a := &ContentFilterAnnotations{
+		Prompt: map[string]ContentFilterCategory{"jailbreak": {Filtered: true, Detected: true}},
+		Completion: map[string]ContentFilterCategory{
+			"violence": {Filtered: true, Severity: "high"},
+			"hate":     {Filtered: false, Severity: "safe"},
+		},
+	}
+	expected := "content filtered by Azure OpenAI: jailbreak, violence (high)"
+	if got := a.blockedMessage(); got != expected {
+		t.Errorf("blockedMessage() = %q, want %q", got, expected)
+	}
+}
+
+func TestResponseMetadataFrom(t *testing.T) {
+	if ResponseMetadataFrom(nil) != nil {
+		t.Error("ResponseMetadataFrom(nil) should return nil")
+	}
+	if ResponseMetadataFrom(&ai.ModelResponse{}) != nil {
+		t.Error("ResponseMetadataFrom() should return nil without custom metadata")
+	}
+
+	// JSON-decoded form, as seen after a round trip through traces or caches
+	resp := &ai.ModelResponse{
+		Custom: map[string]any{
+			"contentFilter": map[string]any{
+				"completion": map[string]any{
+					"violence": map[string]any{"filtered": true, "severity": "high"},
+				},
+			},
+		},
+	}
+	md := ResponseMetadataFrom(resp)
+	if md == nil || md.ContentFilter == nil || !md.ContentFilter.Completion["violence"].Filtered {
+		t.Errorf("ResponseMetadataFrom() did not decode map metadata: %+v", md)
+	}
+}
+
+func TestHandleNonStreamingRequest_ContentFilter(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, filteredChatCompletion)
+	})
+
+	options := azopenai.ChatCompletionsOptions{
+		DeploymentName: to.Ptr("gpt-4o"),
+		Messages: []azopenai.ChatRequestMessageClassification{
+			&azopenai.ChatRequestUserMessage{Content: azopenai.NewChatRequestUserMessageContent("hi")},
+		},
+	}
+	resp, err := handleNonStreamingRequest(context.Background(), client, options)
+	if err != nil {
+		t.Fatalf("handleNonStreamingRequest() error: %v", err)
+	}
+
+	if resp.FinishReason != ai.FinishReasonBlocked {
+		t.Errorf("FinishReason = %v, want blocked", resp.FinishReason)
+	}
+	if !strings.Contains(resp.FinishMessage, "violence (high)") {
+		t.Errorf("FinishMessage = %q, want violence (high)", resp.FinishMessage)
+	}
+	md := ResponseMetadataFrom(resp)
+	if md == nil || md.ContentFilter == nil {
+		t.Fatal("Expected content filter metadata")
+	}
+	if md.ContentFilter.Prompt["hate"].Severity != "safe" {
+		t.Errorf("Prompt hate = %+v, want safe", md.ContentFilter.Prompt["hate"])
+	}
+	if !md.ContentFilter.Completion["protected_material_text"].Detected {
+		t.Error("protected_material_text should be detected")
+	}
+}
+
+func TestHandleStreamingRequest_ContentFilter(t *testing.T) {
+	events := []string{
+		`{"id":"","choices":[],"created":0,"model":"","prompt_filter_results":[{"prompt_index":0,"content_filter_results":{"sexual":{"filtered":false,"severity":"safe"}}}]}`,
+		`{"id":"chatcmpl-1","created":1700000000,"model":"gpt-4o","choices":[{"index":0,"delta":{"role":"assistant","content":"Hello"},"content_filter_results":{"violence":{"filtered":false,"severity":"low"}}}]}`,
+		`{"id":"chatcmpl-1","created":1700000000,"model":"gpt-4o","choices":[{"index":0,"delta":{},"finish_reason":"content_filter","content_filter_results":{"violence":{"filtered":true,"severity":"medium"}}}]}`,
+	}
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, e := range events {
+			fmt.Fprintf(w, "data: %s\n\n", e)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	})
+
+	options := azopenai.ChatCompletionsOptions{
+		DeploymentName: to.Ptr("gpt-4o"),
+		Messages: []azopenai.ChatRequestMessageClassification{
+			&azopenai.ChatRequestUserMessage{Content: azopenai.NewChatRequestUserMessageContent("hi")},
+		},
+	}
+	var chunks int
+	resp, err := handleStreamingRequest(context.Background(), client, options, func(ctx context.Context, chunk *ai.ModelResponseChunk) error {
+		chunks++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("handleStreamingRequest() error: %v", err)
+	}
+
+	if chunks != 1 {
+		t.Errorf("Expected 1 streamed chunk, got %d", chunks)
+	}
+	if resp.FinishReason != ai.FinishReasonBlocked {
+		t.Errorf("FinishReason = %v, want blocked", resp.FinishReason)
+	}
+	if resp.FinishMessage != "content filtered by Azure OpenAI: violence (medium)" {
+		t.Errorf("FinishMessage = %q", resp.FinishMessage)
+	}
+	md := ResponseMetadataFrom(resp)
+	if md == nil || md.ContentFilter.Prompt["sexual"].Severity != "safe" {
+		t.Errorf("Expected prompt filter results from the first stream event, got %+v", md)
+	}
+}
@@ -21,6 +21,7 @@
 package azopenai
 
 import (
+	"context"
 	"testing"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/ai/azopenai"
@@ -169,7 +170,7 @@ func TestConvertTools(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result, err := convertTools(tt.tools)
+			result, err := convertTools(tt.tools, false)
 			if tt.hasError && err == nil {
 				t.Error("Expected error but got none")
 			}
@@ -195,7 +196,7 @@ func TestConvertToAzureOpenAIRequest(t *testing.T) {
 		},
 	}
 
-	result, err := convertToAzureOpenAIRequest(request, config)
+	result, err := convertToAzureOpenAIRequest(context.Background(), "", request, config)
 	if err != nil {
 		t.Errorf("Unexpected error: %v", err)
 	}
@@ -0,0 +1,264 @@
+// Copyright 2025 herosizy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package azopenai
+
+import (
+	"cmp"
+	"context"
+	"maps"
+	"sync"
+
+	"github.com/firebase/genkit/go/ai"
+)
+
+// Price lists the rates of a model in US dollars per million tokens, and per
+// image for generated images. Zero CachedInput and Reasoning rates fall back
+// to the Input and Output rates.
+type Price struct {
+	Input       float64 `json:"input,omitempty"`       // Text input tokens
+	CachedInput float64 `json:"cachedInput,omitempty"` // Input tokens served from the prompt cache
+	Output      float64 `json:"output,omitempty"`      // Text output tokens
+	Reasoning   float64 `json:"reasoning,omitempty"`   // Reasoning tokens, which are billed as output
+	AudioInput  float64 `json:"audioInput,omitempty"`  // Audio input tokens
+	AudioOutput float64 `json:"audioOutput,omitempty"` // Audio output tokens
+	Image       float64 `json:"image,omitempty"`       // Generated images, per image
+}
+
+// DefaultPricing holds Azure OpenAI global standard list prices by model name.
+// Prices change over time; use AzureOpenAI.Pricing for current or negotiated rates.
+var DefaultPricing = map[string]Price{
+	gpt41:               {Input: 2, CachedInput: 0.5, Output: 8},
+	gpt41Mini:           {Input: 0.4, CachedInput: 0.1, Output: 1.6},
+	gpt41Nano:           {Input: 0.1, CachedInput: 0.025, Output: 0.4},
+	gpt4o:               {Input: 2.5, CachedInput: 1.25, Output: 10},
+	gpt4oMini:           {Input: 0.15, CachedInput: 0.075, Output: 0.6},
+	gpt4oAudio:          {Input: 2.5, Output: 10, AudioInput: 40, AudioOutput: 80},
+	gpt4oMiniAudio:      {Input: 0.15, Output: 0.6, AudioInput: 10, AudioOutput: 20},
+	chatgpt4o:           {Input: 5, Output: 15},
+	o4Mini:              {Input: 1.1, CachedInput: 0.275, Output: 4.4},
+	o3:                  {Input: 2, CachedInput: 0.5, Output: 8},
+	o3Mini:              {Input: 1.1, CachedInput: 0.55, Output: 4.4},
+	o1:                  {Input: 15, CachedInput: 7.5, Output: 60},
+	o1Mini:              {Input: 1.1, CachedInput: 0.55, Output: 4.4},
+	o1Pro:               {Input: 150, Output: 600},
+	gpt4:                {Input: 30, Output: 60},
+	gpt4Turbo:           {Input: 10, Output: 30},
+	gpt4TurboPreview:    {Input: 10, Output: 30},
+	gpt35Turbo:          {Input: 0.5, Output: 1.5},
+	gpt35TurboInstruct:  {Input: 1.5, Output: 2},
+	gptImage1:           {Input: 5, CachedInput: 1.25, Output: 40},
+	dalle3:              {Image: 0.04},
+	dalle2:              {Image: 0.02},
+	textEmbedding3Large: {Input: 0.13},
+	textEmbedding3Small: {Input: 0.02},
+}
+
+// Usage.Custom keys for audio token counts, which are included in the input and output totals
+const (
+	UsageInputAudioTokens  = "inputAudioTokens"
+	UsageOutputAudioTokens = "outputAudioTokens"
+)
+
+// Cost is the estimated cost of a request in US dollars, itemized by rate.
+type Cost struct {
+	Input       float64 `json:"input,omitempty"`
+	CachedInput float64 `json:"cachedInput,omitempty"`
+	Output      float64 `json:"output,omitempty"`
+	Reasoning   float64 `json:"reasoning,omitempty"`
+	Audio       float64 `json:"audio,omitempty"`
+	Image       float64 `json:"image,omitempty"`
+	Total       float64 `json:"total"`
+}
+
+// add adds o to c
+func (c *Cost) add(o Cost) {
+	c.Input += o.Input
+	c.CachedInput += o.CachedInput
+	c.Output += o.Output
+	c.Reasoning += o.Reasoning
+	c.Audio += o.Audio
+	c.Image += o.Image
+	c.Total += o.Total
+}
+
+// Estimate returns the cost of usage at these rates. Cached, audio and reasoning
+// tokens are counted in the usage totals, so they are charged at their own rates
+// instead of the text rates.
+func (p Price) Estimate(usage *ai.GenerationUsage) Cost {
+	if usage == nil {
+		return Cost{}
+	}
+	const perToken = 1e-6
+	audioIn, audioOut := int(usage.Custom[UsageInputAudioTokens]), int(usage.Custom[UsageOutputAudioTokens])
+	textIn := max(usage.InputTokens-usage.CachedContentTokens-audioIn, 0)
+	textOut := max(usage.OutputTokens-usage.ThoughtsTokens-audioOut, 0)
+
+	c := Cost{
+		Input:       float64(textIn) * p.Input * perToken,
+		CachedInput: float64(usage.CachedContentTokens) * cmp.Or(p.CachedInput, p.Input) * perToken,
+		Output:      float64(textOut) * p.Output * perToken,
+		Reasoning:   float64(usage.ThoughtsTokens) * cmp.Or(p.Reasoning, p.Output) * perToken,
+		Audio:       (float64(audioIn)*p.AudioInput + float64(audioOut)*p.AudioOutput) * perToken,
+		Image:       float64(usage.OutputImages) * p.Image,
+	}
+	c.Total = c.Input + c.CachedInput + c.Output + c.Reasoning + c.Audio + c.Image
+	return c
+}
+
+type costKey struct{}
+
+// WithCostKey returns a context whose model and embedder calls are attributed to
+// key in the [CostTracker], for example the name of a flow or tenant.
+func WithCostKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, costKey{}, key)
+}
+
+// CostSummary is the usage and estimated cost accumulated for a key.
+type CostSummary struct {
+	Requests     int     `json:"requests"`
+	InputTokens  int     `json:"inputTokens"`
+	OutputTokens int     `json:"outputTokens"`
+	Cost         float64 `json:"cost"` // Estimated cost in US dollars
+}
+
+// CostTracker accumulates estimated costs of model and embedder calls by the key
+// set with [WithCostKey]. Calls without a key are recorded under "".
+// A CostTracker is safe for concurrent use.
+type CostTracker struct {
+	mu        sync.Mutex
+	summaries map[string]CostSummary
+}
+
+// NewCostTracker returns an empty cost tracker.
+func NewCostTracker() *CostTracker {
+	return &CostTracker{summaries: map[string]CostSummary{}}
+}
+
+// Summary returns the totals recorded for key.
+func (t *CostTracker) Summary(key string) CostSummary {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.summaries[key]
+}
+
+// Summaries returns the totals recorded for every key.
+func (t *CostTracker) Summaries() map[string]CostSummary {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return maps.Clone(t.summaries)
+}
+
+// Reset clears all recorded totals.
+func (t *CostTracker) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	clear(t.summaries)
+}
+
+func (t *CostTracker) record(ctx context.Context, usage *ai.GenerationUsage, cost float64) {
+	key, _ := ctx.Value(costKey{}).(string)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := t.summaries[key]
+	s.Requests++
+	s.InputTokens += usage.InputTokens
+	s.OutputTokens += usage.OutputTokens
+	s.Cost += cost
+	t.summaries[key] = s
+}
+
+// costEstimator prices calls with the plugin's pricing overrides and records them.
+type costEstimator struct {
+	pricing map[string]Price // Overrides by deployment or model name
+	tracker *CostTracker     // Optional
+}
+
+// price returns the rates for a deployment of model: an override for the
+// deployment, then for the model, then the default price of the model
+func (e *costEstimator) price(model, deployment string) (Price, bool) {
+	if e != nil {
+		if p, ok := e.pricing[deployment]; ok {
+			return p, true
+		}
+		if p, ok := e.pricing[model]; ok {
+			return p, true
+		}
+	}
+	p, ok := DefaultPricing[model]
+	return p, ok
+}
+
+// estimate returns the cost of usage, recording it in the tracker. It returns
+// nil when the model has no known price or there is no usage.
+func (e *costEstimator) estimate(ctx context.Context, model, deployment string, usage *ai.GenerationUsage) *Cost {
+	p, ok := e.price(model, deployment)
+	if !ok || usage == nil {
+		return nil
+	}
+	cost := p.Estimate(usage)
+	if e != nil && e.tracker != nil {
+		e.tracker.record(ctx, usage, cost.Total)
+	}
+	return &cost
+}
+
+// applyCost attaches the estimated cost of a chat response to its metadata,
+// including the usage of a request that lost a hedge.
+func (e *costEstimator) applyCost(ctx context.Context, model, deployment string, resp *ai.ModelResponse) {
+	if resp == nil {
+		return
+	}
+	cost := e.estimate(ctx, model, deployment, resp.Usage)
+	if md := ResponseMetadataFrom(resp); md != nil && md.HedgeUsage != nil {
+		if loser := e.estimate(ctx, model, deployment, md.HedgeUsage); loser != nil {
+			if cost == nil {
+				cost = &Cost{}
+			}
+			cost.add(*loser)
+		}
+	}
+	if cost != nil {
+		responseMetadata(resp).Cost = cost
+	}
+}
+
+// applyEmbedCost stores each embedding's share of the request cost, apportioned
+// by input length, in its metadata under "cost".
+func (e *costEstimator) applyEmbedCost(ctx context.Context, model, deployment string, inputs []string, inputTokens int, resp *ai.EmbedResponse) {
+	cost := e.estimate(ctx, model, deployment, &ai.GenerationUsage{InputTokens: inputTokens, TotalTokens: inputTokens})
+	if cost == nil || len(inputs) != len(resp.Embeddings) {
+		return
+	}
+	var total int
+	for _, input := range inputs {
+		total += len(input)
+	}
+	for i, emb := range resp.Embeddings {
+		share := 1 / float64(len(inputs))
+		if total > 0 {
+			share = float64(len(inputs[i])) / float64(total)
+		}
+		if emb.Metadata == nil {
+			emb.Metadata = map[string]any{}
+		}
+		emb.Metadata["cost"] = cost.Total * share
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright 2025 herosizy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package azopenai
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/HeroSizy/genkit-go-plugins/azopenai/azopenaitest"
+	"github.com/firebase/genkit/go/ai"
+)
+
+func TestPriceEstimate(t *testing.T) {
+	tests := []struct {
+		name  string
+		price Price
+		usage *ai.GenerationUsage
+		want  Cost
+	}{
+		{
+			name:  "no usage",
+			price: Price{Input: 1},
+		},
+		{
+			name:  "text",
+			price: Price{Input: 2, Output: 8},
+			usage: &ai.GenerationUsage{InputTokens: 1_000_000, OutputTokens: 500_000},
+			want:  Cost{Input: 2, Output: 4, Total: 6},
+		},
+		{
+			name:  "cached input",
+			price: Price{Input: 2, CachedInput: 0.5, Output: 8},
+			usage: &ai.GenerationUsage{InputTokens: 1_000_000, CachedContentTokens: 400_000},
+			want:  Cost{Input: 1.2, CachedInput: 0.2, Total: 1.4},
+		},
+		{
+			name:  "cached input without a cached rate",
+			price: Price{Input: 2},
+			usage: &ai.GenerationUsage{InputTokens: 1_000_000, CachedContentTokens: 500_000},
+			want:  Cost{Input: 1, CachedInput: 1, Total: 2},
+		},
+		{
+			name:  "reasoning billed as output",
+			price: Price{Output: 4},
+			usage: &ai.GenerationUsage{OutputTokens: 1_000_000, ThoughtsTokens: 750_000},
+			want:  Cost{Output: 1, Reasoning: 3, Total: 4},
+		},
+		{
+			name:  "audio",
+			price: Price{Input: 2, Output: 10, AudioInput: 40, AudioOutput: 80},
+			usage: &ai.GenerationUsage{InputTokens: 200_000, OutputTokens: 100_000, Custom: map[string]float64{
+				UsageInputAudioTokens: 100_000, UsageOutputAudioTokens: 50_000,
+			}},
+			want: Cost{Input: 0.2, Output: 0.5, Audio: 8, Total: 8.7},
+		},
+		{
+			name:  "images",
+			price: Price{Image: 0.04},
+			usage: &ai.GenerationUsage{OutputImages: 3},
+			want:  Cost{Image: 0.12, Total: 0.12},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.price.Estimate(tt.usage)
+			for _, c := range []struct {
+				field     string
+				got, want float64
+			}{
+				{"Input", got.Input, tt.want.Input},
+				{"CachedInput", got.CachedInput, tt.want.CachedInput},
+				{"Output", got.Output, tt.want.Output},
+				{"Reasoning", got.Reasoning, tt.want.Reasoning},
+				{"Audio", got.Audio, tt.want.Audio},
+				{"Image", got.Image, tt.want.Image},
+				{"Total", got.Total, tt.want.Total},
+			} {
+				if math.Abs(c.got-c.want) > 1e-9 {
+					t.Errorf("%s = %v, want %v", c.field, c.got, c.want)
+				}
+			}
+		})
+	}
+}
+
+func TestCostTracker(t *testing.T) {
+	tracker := NewCostTracker()
+	g, srv := initPlugin(t, func(p *AzureOpenAI) {
+		p.Pricing = map[string]Price{"negotiated": {Input: 1, Output: 4}}
+		p.CostTracker = tracker
+		p.Cache = &CacheOptions{}
+	})
+	usage := &azopenaitest.Usage{PromptTokens: 1000, CompletionTokens: 500}
+	srv.QueueChat(azopenaitest.ChatReply{Content: "a", Usage: usage}, azopenaitest.ChatReply{Content: "b", Usage: usage})
+
+	generate := func(ctx context.Context, deployment string) *ai.ModelResponse {
+		t.Helper()
+		req := helloRequest()
+		req.Config = &OpenAIConfig{DeploymentName: deployment}
+		resp, err := Model(g, Gpt4o).Generate(ctx, req, nil)
+		if err != nil {
+			t.Fatalf("Generate() error: %v", err)
+		}
+		return resp
+	}
+
+	tenant := WithCostKey(context.Background(), "tenant-a")
+	md := ResponseMetadataFrom(generate(tenant, "chat"))
+	if want := 0.0025 + 0.005; md == nil || md.Cost == nil || math.Abs(md.Cost.Total-want) > 1e-12 {
+		t.Fatalf("Expected a default-priced cost of %v, got %+v", want, md)
+	}
+	md = ResponseMetadataFrom(generate(context.Background(), "negotiated"))
+	if want := 0.001 + 0.002; md == nil || md.Cost == nil || math.Abs(md.Cost.Total-want) > 1e-12 {
+		t.Fatalf("Expected a deployment-priced cost of %v, got %+v", want, md)
+	}
+
+	// Cache hits cost nothing and are not recorded
+	md = ResponseMetadataFrom(generate(tenant, "chat"))
+	if md == nil || !md.Cached || md.Cost != nil {
+		t.Errorf("Expected an uncosted cache hit, got %+v", md)
+	}
+
+	if s := tracker.Summary("tenant-a"); s.Requests != 1 || s.InputTokens != 1000 || s.OutputTokens != 500 || math.Abs(s.Cost-0.0075) > 1e-12 {
+		t.Errorf("Unexpected tenant summary %+v", s)
+	}
+	if s := tracker.Summary(""); s.Requests != 1 || math.Abs(s.Cost-0.003) > 1e-12 {
+		t.Errorf("Unexpected default summary %+v", s)
+	}
+	if n := len(tracker.Summaries()); n != 2 {
+		t.Errorf("Expected 2 keys, got %d", n)
+	}
+	tracker.Reset()
+	if n := len(tracker.Summaries()); n != 0 {
+		t.Errorf("Expected no keys after Reset, got %d", n)
+	}
+}
+
+func TestEmbedCost(t *testing.T) {
+	tracker := NewCostTracker()
+	g, _ := initPlugin(t, func(p *AzureOpenAI) { p.CostTracker = tracker })
+
+	resp, err := Embedder(g, TextEmbedding3Small).Embed(context.Background(), &ai.EmbedRequest{
+		Input: []*ai.Document{ai.DocumentFromText("one", nil), ai.DocumentFromText("three", nil)},
+	})
+	if err != nil {
+		t.Fatalf("Embed() error: %v", err)
+	}
+	s := tracker.Summary("")
+	if s.Requests != 1 || s.InputTokens == 0 {
+		t.Fatalf("Unexpected summary %+v", s)
+	}
+	want := float64(s.InputTokens) * DefaultPricing[TextEmbedding3Small].Input / 1e6
+	first, _ := resp.Embeddings[0].Metadata["cost"].(float64)
+	second, _ := resp.Embeddings[1].Metadata["cost"].(float64)
+	if math.Abs(first+second-want) > 1e-15 || math.Abs(s.Cost-want) > 1e-15 {
+		t.Errorf("Embedding costs %v + %v, tracked %v, want %v", first, second, s.Cost, want)
+	}
+	if second <= first {
+		t.Errorf("Expected the longer input to carry more of the cost, got %v and %v", first, second)
+	}
+}
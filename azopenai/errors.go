@@ -0,0 +1,195 @@
+// Copyright 2025 herosizy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package azopenai
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+)
+
+// AzureError carries the details shared by all typed Azure OpenAI errors.
+// The underlying *azcore.ResponseError remains reachable through errors.As.
+type AzureError struct {
+	StatusCode int    // HTTP status code
+	ErrorCode  string // Error code reported by the service
+	Message    string // Error message reported by the service
+	RequestID  string // Request ID assigned by the service, useful for support cases
+
+	err *azcore.ResponseError
+}
+
+// Error implements the error interface.
+func (e *AzureError) Error() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "azure openai: status %d", e.StatusCode)
+	if e.ErrorCode != "" {
+		fmt.Fprintf(&sb, ", code %s", e.ErrorCode)
+	}
+	if e.RequestID != "" {
+		fmt.Fprintf(&sb, ", request ID %s", e.RequestID)
+	}
+	if e.Message != "" {
+		fmt.Fprintf(&sb, ": %s", e.Message)
+	}
+	return sb.String()
+}
+
+// Unwrap returns the underlying *azcore.ResponseError.
+func (e *AzureError) Unwrap() error {
+	if e.err == nil {
+		return nil
+	}
+	return e.err
+}
+
+// RateLimitError is returned when the deployment's rate limit or quota is exceeded.
+type RateLimitError struct {
+	AzureError
+	RetryAfter time.Duration // How long the service asked to wait before retrying, if provided
+}
+
+// ContentFilterError is returned when the prompt is rejected by the content filter.
+type ContentFilterError struct {
+	AzureError
+	Categories map[string]ContentFilterCategory // Filter results keyed by category, e.g. "hate" or "jailbreak"
+}
+
+// DeploymentNotFoundError is returned when the requested deployment does not exist.
+type DeploymentNotFoundError struct {
+	AzureError
+}
+
+// ContextLengthError is returned when the prompt exceeds the model's context window.
+type ContextLengthError struct {
+	AzureError
+}
+
+// AuthError is returned when the API key or credential is rejected.
+type AuthError struct {
+	AzureError
+}
+
+// ContentFilterCategory is the content filter result for a single category.
+type ContentFilterCategory struct {
+	Filtered bool   `json:"filtered"`           // Whether the content was filtered
+	Severity string `json:"severity,omitempty"` // Severity level, e.g. "safe", "low", "medium" or "high"
+	Detected bool   `json:"detected,omitempty"` // Whether the category was detected, for detection-only categories
+}
+
+// azureErrorEnvelope is the JSON body of an Azure OpenAI error response.
+type azureErrorEnvelope struct {
+	Error struct {
+		Code       string `json:"code"`
+		Message    string `json:"message"`
+		InnerError struct {
+			Code                string                           `json:"code"`
+			ContentFilterResult map[string]ContentFilterCategory `json:"content_filter_result"`
+		} `json:"innererror"`
+	} `json:"error"`
+}
+
+// mapAzureError converts an *azcore.ResponseError in err into one of the typed errors.
+// Errors that do not match a known class are returned unchanged.
+func mapAzureError(err error) error {
+	var respErr *azcore.ResponseError
+	if !errors.As(err, &respErr) {
+		return err
+	}
+
+	base := AzureError{
+		StatusCode: respErr.StatusCode,
+		ErrorCode:  respErr.ErrorCode,
+		err:        respErr,
+	}
+
+	var envelope azureErrorEnvelope
+	if resp := respErr.RawResponse; resp != nil {
+		base.RequestID = requestID(resp.Header)
+		if body, perr := runtime.Payload(resp); perr == nil && len(body) > 0 {
+			_ = json.Unmarshal(body, &envelope)
+		}
+	}
+	base.Message = envelope.Error.Message
+	if base.ErrorCode == "" {
+		base.ErrorCode = envelope.Error.Code
+	}
+
+	switch {
+	case base.ErrorCode == "content_filter" || envelope.Error.InnerError.Code == "ResponsibleAIPolicyViolation":
+		return &ContentFilterError{AzureError: base, Categories: envelope.Error.InnerError.ContentFilterResult}
+	case base.StatusCode == http.StatusTooManyRequests:
+		rl := &RateLimitError{AzureError: base}
+		if respErr.RawResponse != nil {
+			rl.RetryAfter = retryAfter(respErr.RawResponse.Header)
+		}
+		return rl
+	case base.ErrorCode == "context_length_exceeded":
+		return &ContextLengthError{AzureError: base}
+	case base.StatusCode == http.StatusNotFound || base.ErrorCode == "DeploymentNotFound":
+		return &DeploymentNotFoundError{AzureError: base}
+	case base.StatusCode == http.StatusUnauthorized || base.StatusCode == http.StatusForbidden:
+		return &AuthError{AzureError: base}
+	default:
+		return err
+	}
+}
+
+// requestID returns the service request ID from the response headers.
+func requestID(h http.Header) string {
+	for _, key := range []string{"apim-request-id", "x-request-id", "x-ms-request-id"} {
+		if v := h.Get(key); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// retryAfter parses the retry delay from the response headers.
+func retryAfter(h http.Header) time.Duration {
+	for _, key := range []string{"retry-after-ms", "x-ms-retry-after-ms"} {
+		if v := h.Get(key); v != "" {
+			if ms, err := strconv.Atoi(v); err == nil {
+				return time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+	v := h.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
@@ -0,0 +1,192 @@
+// Copyright 2025 herosizy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package azopenai
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+)
+
+// newTestResponseError builds an *azcore.ResponseError for the given status, headers and body
+func newTestResponseError(status int, header http.Header, body string) error {
+	if header == nil {
+		header = http.Header{}
+	}
+	header.Set("Content-Type", "application/json")
+	resp := &http.Response{
+		StatusCode: status,
+		Header:     header,
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    httptest.NewRequest(http.MethodPost, "https://test.openai.azure.com/openai/deployments/gpt-4o/chat/completions", nil),
+	}
+	return runtime.NewResponseError(resp)
+}
+
+func TestMapAzureError_RateLimit(t *testing.T) {
+	header := http.Header{}
+	header.Set("Retry-After", "7")
+	header.Set("apim-request-id", "req-123")
+	err := newTestResponseError(http.StatusTooManyRequests, header,
+		`{"error":{"code":"429","message":"Requests have exceeded the rate limit"}}`)
+
+	wrapped := fmt.Errorf("failed to get chat completions: %w", mapAzureError(err))
+
+	var rl *RateLimitError
+	if !errors.As(wrapped, &rl) {
+		t.Fatalf("Expected RateLimitError, got %T", mapAzureError(err))
+	}
+	if rl.RetryAfter != 7*time.Second {
+		t.Errorf("RetryAfter = %v, want 7s", rl.RetryAfter)
+	}
+	if rl.RequestID != "req-123" {
+		t.Errorf("RequestID = %q, want req-123", rl.RequestID)
+	}
+	if rl.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("StatusCode = %d, want 429", rl.StatusCode)
+	}
+	if !strings.Contains(rl.Error(), "exceeded the rate limit") {
+		t.Errorf("Error() should include the service message, got %q", rl.Error())
+	}
+
+	var respErr *azcore.ResponseError
+	if !errors.As(wrapped, &respErr) {
+		t.Error("Underlying azcore.ResponseError should remain reachable")
+	}
+}
+
+func TestMapAzureError_ContentFilter(t *testing.T) {
+	err := newTestResponseError(http.StatusBadRequest, nil, `{"error":{
+		"code":"content_filter",
+		"message":"The response was filtered",
+		"innererror":{
+			"code":"ResponsibleAIPolicyViolation",
+			"content_filter_result":{
+				"hate":{"filtered":false,"severity":"safe"},
+				"violence":{"filtered":true,"severity":"high"},
+				"jailbreak":{"filtered":true,"detected":true}
+			}
+		}
+	}}`)
+
+	var cf *ContentFilterError
+	if !errors.As(mapAzureError(err), &cf) {
+		t.Fatalf("Expected ContentFilterError, got %T", mapAzureError(err))
+	}
+	if got := cf.Categories["violence"]; !got.Filtered || got.Severity != "high" {
+		t.Errorf("violence category = %+v, want filtered high", got)
+	}
+	if got := cf.Categories["jailbreak"]; !got.Detected {
+		t.Errorf("jailbreak category = %+v, want detected", got)
+	}
+	if cf.Categories["hate"].Filtered {
+		t.Error("hate category should not be filtered")
+	}
+}
+
+func TestMapAzureError_Classes(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		check  func(error) bool
+	}{
+		{
+			name:   "context length",
+			status: http.StatusBadRequest,
+			body:   `{"error":{"code":"context_length_exceeded","message":"too long"}}`,
+			check:  func(err error) bool { var e *ContextLengthError; return errors.As(err, &e) },
+		},
+		{
+			name:   "deployment not found",
+			status: http.StatusNotFound,
+			body:   `{"error":{"code":"DeploymentNotFound","message":"missing"}}`,
+			check:  func(err error) bool { var e *DeploymentNotFoundError; return errors.As(err, &e) },
+		},
+		{
+			name:   "unauthorized",
+			status: http.StatusUnauthorized,
+			body:   `{"error":{"code":"401","message":"Access denied"}}`,
+			check:  func(err error) bool { var e *AuthError; return errors.As(err, &e) },
+		},
+		{
+			name:   "forbidden",
+			status: http.StatusForbidden,
+			body:   `{"error":{"code":"403","message":"Forbidden"}}`,
+			check:  func(err error) bool { var e *AuthError; return errors.As(err, &e) },
+		},
+		{
+			name:   "unclassified",
+			status: http.StatusInternalServerError,
+			body:   `{"error":{"code":"InternalServerError","message":"oops"}}`,
+			check:  func(err error) bool { var e *azcore.ResponseError; return errors.As(err, &e) },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := mapAzureError(newTestResponseError(tt.status, nil, tt.body))
+			if !tt.check(err) {
+				t.Errorf("mapAzureError() returned unexpected type %T", err)
+			}
+		})
+	}
+}
+
+func TestMapAzureError_NonAzureError(t *testing.T) {
+	err := errors.New("network down")
+	if got := mapAzureError(err); got != err {
+		t.Errorf("mapAzureError() should return non-Azure errors unchanged, got %v", got)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   map[string]string
+		expected time.Duration
+	}{
+		{"milliseconds", map[string]string{"retry-after-ms": "1500"}, 1500 * time.Millisecond},
+		{"seconds", map[string]string{"Retry-After": "3"}, 3 * time.Second},
+		{"missing", map[string]string{}, 0},
+		{"invalid", map[string]string{"Retry-After": "soon"}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			for k, v := range tt.header {
+				h.Set(k, v)
+			}
+			if got := retryAfter(h); got != tt.expected {
+				t.Errorf("retryAfter() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
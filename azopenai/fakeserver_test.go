@@ -0,0 +1,213 @@
+// Copyright 2025 herosizy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package azopenai
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/HeroSizy/genkit-go-plugins/azopenai/azopenaitest"
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+)
+
+// initWithFakeServer initializes the plugin against an in-process fake service
+func initWithFakeServer(t *testing.T) (*genkit.Genkit, *azopenaitest.Server) {
+	return initPlugin(t, nil)
+}
+
+// initPlugin initializes the plugin against a fake service. If configure is not
+// nil, it sets further plugin options before Init.
+func initPlugin(t *testing.T, configure func(p *AzureOpenAI)) (*genkit.Genkit, *azopenaitest.Server) {
+	t.Helper()
+	ctx := context.Background()
+	srv := azopenaitest.NewServer(t)
+	g, err := genkit.Init(ctx)
+	if err != nil {
+		t.Fatalf("Failed to initialize Genkit: %v", err)
+	}
+	plugin := &AzureOpenAI{APIKey: "test-key", Endpoint: srv.URL, Transport: srv.Client()}
+	if configure != nil {
+		configure(plugin)
+	}
+	if err := plugin.Init(ctx, g); err != nil {
+		t.Fatalf("Failed to initialize plugin: %v", err)
+	}
+	return g, srv
+}
+
+func helloRequest() *ai.ModelRequest {
+	return &ai.ModelRequest{
+		Messages: []*ai.Message{ai.NewUserTextMessage("Hello")},
+		Config:   &OpenAIConfig{DeploymentName: "chat"},
+	}
+}
+
+func TestFakeServer_Streaming(t *testing.T) {
+	g, srv := initWithFakeServer(t)
+	srv.QueueChat(azopenaitest.ChatReply{
+		Chunks: []string{"Hel", "lo ", "there"},
+		Usage:  &azopenaitest.Usage{PromptTokens: 8, CompletionTokens: 3},
+	})
+
+	var chunks []string
+	resp, err := Model(g, Gpt4o).Generate(context.Background(), helloRequest(), func(ctx context.Context, c *ai.ModelResponseChunk) error {
+		chunks = append(chunks, c.Text())
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Generate() error: %v", err)
+	}
+	if len(chunks) != 3 || resp.Text() != "Hello there" {
+		t.Errorf("Chunks %q, text %q", chunks, resp.Text())
+	}
+	if resp.Usage == nil || resp.Usage.TotalTokens != 11 {
+		t.Errorf("Unexpected usage %+v", resp.Usage)
+	}
+
+	req := srv.Requests()[0]
+	if req.Deployment != "chat" || req.JSON()["stream"] != true {
+		t.Errorf("Expected a streaming request to the configured deployment, got %s %s", req.Deployment, req.Body)
+	}
+}
+
+func TestFakeServer_StreamingCallbackError(t *testing.T) {
+	g, srv := initWithFakeServer(t)
+	srv.QueueChat(azopenaitest.ChatReply{Chunks: []string{"a", "b"}})
+
+	stop := errors.New("stop")
+	_, err := Model(g, Gpt4o).Generate(context.Background(), helloRequest(), func(context.Context, *ai.ModelResponseChunk) error {
+		return stop
+	})
+	if !errors.Is(err, stop) {
+		t.Errorf("Expected the callback error, got %v", err)
+	}
+}
+
+func TestFakeServer_StreamingContentFilter(t *testing.T) {
+	g, srv := initWithFakeServer(t)
+	srv.QueueChat(azopenaitest.ChatReply{
+		Chunks:        []string{"Partial"},
+		FinishReason:  "content_filter",
+		ContentFilter: map[string]azopenaitest.Filter{"violence": {Filtered: true, Severity: "medium"}},
+	})
+
+	resp, err := Model(g, Gpt4o).Generate(context.Background(), helloRequest(), func(context.Context, *ai.ModelResponseChunk) error { return nil })
+	if err != nil {
+		t.Fatalf("Generate() error: %v", err)
+	}
+	if resp.FinishReason != ai.FinishReasonBlocked {
+		t.Errorf("FinishReason = %q, want %q", resp.FinishReason, ai.FinishReasonBlocked)
+	}
+	if !strings.Contains(resp.FinishMessage, "violence (medium)") {
+		t.Errorf("FinishMessage = %q", resp.FinishMessage)
+	}
+}
+
+func TestFakeServer_Errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		err   azopenaitest.Error
+		check func(t *testing.T, err error)
+	}{
+		{
+			name: "rate limit after retries",
+			// The SDK retries throttled requests three times
+			err: func() azopenaitest.Error {
+				e := azopenaitest.RateLimit(5 * time.Millisecond)
+				e.Times = 4
+				return e
+			}(),
+			check: func(t *testing.T, err error) {
+				var rl *RateLimitError
+				if !errors.As(err, &rl) {
+					t.Fatalf("Expected *RateLimitError, got %v", err)
+				}
+				if rl.RetryAfter != 5*time.Millisecond {
+					t.Errorf("RetryAfter = %v", rl.RetryAfter)
+				}
+			},
+		},
+		{
+			name: "prompt content filter",
+			err:  azopenaitest.ContentFiltered(map[string]azopenaitest.Filter{"jailbreak": {Filtered: true, Detected: true}}),
+			check: func(t *testing.T, err error) {
+				var cf *ContentFilterError
+				if !errors.As(err, &cf) {
+					t.Fatalf("Expected *ContentFilterError, got %v", err)
+				}
+				if !cf.Categories["jailbreak"].Detected {
+					t.Errorf("Unexpected categories %+v", cf.Categories)
+				}
+			},
+		},
+		{
+			name: "deployment not found",
+			err:  azopenaitest.DeploymentNotFound(),
+			check: func(t *testing.T, err error) {
+				var nf *DeploymentNotFoundError
+				if !errors.As(err, &nf) {
+					t.Fatalf("Expected *DeploymentNotFoundError, got %v", err)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		for _, streaming := range []bool{false, true} {
+			name := tt.name
+			if streaming {
+				name += " streaming"
+			}
+			t.Run(name, func(t *testing.T) {
+				g, srv := initWithFakeServer(t)
+				srv.QueueError(azopenaitest.EndpointChat, tt.err)
+
+				var cb ai.ModelStreamCallback
+				if streaming {
+					cb = func(context.Context, *ai.ModelResponseChunk) error { return nil }
+				}
+				_, err := Model(g, Gpt4o).Generate(context.Background(), helloRequest(), cb)
+				tt.check(t, err)
+			})
+		}
+	}
+}
+
+func TestFakeServer_Embeddings(t *testing.T) {
+	g, srv := initWithFakeServer(t)
+
+	resp, err := Embedder(g, TextEmbedding3Small).Embed(context.Background(), &ai.EmbedRequest{
+		Input: []*ai.Document{ai.DocumentFromText("one", nil), ai.DocumentFromText("two", nil)},
+	})
+	if err != nil {
+		t.Fatalf("Embed() error: %v", err)
+	}
+	if len(resp.Embeddings) != 2 || len(resp.Embeddings[0].Embedding) != azopenaitest.DefaultEmbeddingDimensions {
+		t.Errorf("Unexpected embeddings %+v", resp.Embeddings)
+	}
+	if got := srv.Requests()[0].Deployment; got != TextEmbedding3Small {
+		t.Errorf("Deployment = %q, want %q", got, TextEmbedding3Small)
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright 2025 herosizy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package azopenai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+)
+
+// ErrorClass groups the errors that trigger a fallback. The values match the
+// error.type attribute recorded by telemetry.
+type ErrorClass string
+
+const (
+	ErrorRateLimit          ErrorClass = "rate_limit"              // Throttled after the SDK's retries, see [RateLimitError]
+	ErrorContentFilter      ErrorClass = "content_filter"          // Prompt rejected or completion blocked by the content filter
+	ErrorDeploymentNotFound ErrorClass = "deployment_not_found"    // See [DeploymentNotFoundError]
+	ErrorContextLength      ErrorClass = "context_length_exceeded" // See [ContextLengthError]
+	ErrorServer             ErrorClass = "server_error"            // 5xx responses from the service
+	ErrorTimeout            ErrorClass = "timeout"                 // An attempt exceeded FallbackChain.Timeout
+	ErrorBudgetExceeded     ErrorClass = "budget_exceeded"         // See [BudgetExceededError]
+	ErrorQueueFull          ErrorClass = "queue_full"              // See [QueueFullError]
+)
+
+// FallbackChain lists the models that retry a request when its model fails.
+//
+// Set Timeout to give each attempt, the first included, its own deadline so that
+// ErrorTimeout can trigger a fallback. Once the caller's context is done, no
+// further models are tried.
+type FallbackChain struct {
+	Models  []FallbackModel // Models tried in order until one answers
+	On      []ErrorClass    // Errors that trigger a fallback. Defaults to ErrorRateLimit and ErrorServer.
+	Timeout time.Duration   // Deadline of each attempt. If zero, attempts only end with the caller's context.
+}
+
+// FallbackModel is a model in a [FallbackChain].
+type FallbackModel struct {
+	Model      string // Name of a model defined by the plugin, e.g. Gpt4oMini
+	Deployment string // Deployment of the model. Defaults to Model.
+}
+
+// defaultFallbackOn lists the error classes that trigger a fallback when a chain does not set On
+var defaultFallbackOn = []ErrorClass{ErrorRateLimit, ErrorServer}
+
+type fallbackKey struct{}
+
+// fallbackMiddleware retries failed chat calls on the chain configured for their
+// model. Fallback calls do not fall back again, so chains cannot loop. Streaming
+// calls only fall back when no chunk has been delivered.
+func fallbackMiddleware(g *genkit.Genkit, chains map[string]FallbackChain) Middleware {
+	return Middleware{
+		Chat: func(next ChatHandler) ChatHandler {
+			return func(ctx context.Context, call *ChatCall) (*ai.ModelResponse, error) {
+				chain, ok := chains[call.Model]
+				if !ok || len(chain.Models) == 0 || ctx.Value(fallbackKey{}) != nil {
+					return next(ctx, call)
+				}
+				var streamed bool
+				cb := call.Callback
+				if cb != nil {
+					c := *call
+					c.Callback = func(ctx context.Context, chunk *ai.ModelResponseChunk) error {
+						streamed = true
+						return cb(ctx, chunk)
+					}
+					call = &c
+				}
+
+				attempt, cancel := chain.attempt(ctx)
+				resp, err := next(attempt, call)
+				cancel()
+				if streamed || ctx.Err() != nil || !chain.triggers(resp, err) {
+					return resp, err
+				}
+				return chain.fallback(context.WithValue(ctx, fallbackKey{}, true), g, call, resp, err, &streamed)
+			}
+		},
+	}
+}
+
+// fallback tries each model of the chain in turn. If every model fails, the
+// errors are joined; if the original call was answered but blocked, its
+// response is returned.
+func (c FallbackChain) fallback(ctx context.Context, g *genkit.Genkit, call *ChatCall, resp *ai.ModelResponse, err error, streamed *bool) (*ai.ModelResponse, error) {
+	var errs []error
+	if err != nil {
+		errs = append(errs, err)
+	}
+	base, cfgErr := requestConfig(call.Request)
+	if cfgErr != nil {
+		return nil, errors.Join(append(errs, cfgErr)...)
+	}
+	for _, fb := range c.Models {
+		model := genkit.LookupModel(g, azureOpenAIProvider, fb.Model)
+		if model == nil {
+			errs = append(errs, fmt.Errorf("fallback model %q is not defined", fb.Model))
+			continue
+		}
+		cfg := base
+		cfg.DeploymentName = fb.Deployment
+		if cfg.DeploymentName == "" {
+			cfg.DeploymentName = fb.Model
+		}
+		req := *call.Request
+		req.Config = &cfg
+		attempt, cancel := c.attempt(ctx)
+		r, e := model.Generate(attempt, &req, call.Callback)
+		cancel()
+		if *streamed || ctx.Err() != nil || !c.triggers(r, e) {
+			if e != nil {
+				return nil, e
+			}
+			responseMetadata(r).Fallback = fb.Model
+			return r, nil
+		}
+		if e != nil {
+			errs = append(errs, fmt.Errorf("fallback model %q: %w", fb.Model, e))
+		}
+	}
+	if err == nil {
+		return resp, nil
+	}
+	return nil, errors.Join(errs...)
+}
+
+// attempt returns the context for one attempt, bounded by the chain's Timeout
+func (c FallbackChain) attempt(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.Timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, c.Timeout)
+}
+
+// triggers reports whether a call's outcome falls in one of the chain's error classes.
+// A response blocked by the content filter counts as ErrorContentFilter.
+func (c FallbackChain) triggers(resp *ai.ModelResponse, err error) bool {
+	on := c.On
+	if len(on) == 0 {
+		on = defaultFallbackOn
+	}
+	if err != nil {
+		return slices.Contains(on, classifyError(err))
+	}
+	return resp != nil && resp.FinishReason == ai.FinishReasonBlocked && slices.Contains(on, ErrorContentFilter)
+}
+
+// classifyError returns the class of err
+func classifyError(err error) ErrorClass {
+	var (
+		budget  *BudgetExceededError
+		respErr *azcore.ResponseError
+	)
+	switch {
+	case errors.As(err, &budget):
+		return ErrorBudgetExceeded
+	case errorType(err) != "_OTHER":
+		return ErrorClass(errorType(err))
+	case errors.As(err, &respErr) && respErr.StatusCode >= http.StatusInternalServerError:
+		return ErrorServer
+	default:
+		return ""
+	}
+}
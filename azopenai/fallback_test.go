@@ -0,0 +1,277 @@
+// Copyright 2025 herosizy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package azopenai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/HeroSizy/genkit-go-plugins/azopenai/azopenaitest"
+	"github.com/firebase/genkit/go/ai"
+)
+
+// throttled returns a rate limit that outlasts the SDK's retries
+func throttled() azopenaitest.Error {
+	e := azopenaitest.RateLimit(time.Millisecond)
+	e.Times = 4
+	return e
+}
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want ErrorClass
+	}{
+		{"rate limit", &RateLimitError{}, ErrorRateLimit},
+		{"content filter", fmt.Errorf("wrapped: %w", &ContentFilterError{}), ErrorContentFilter},
+		{"context length", &ContextLengthError{}, ErrorContextLength},
+		{"timeout", context.DeadlineExceeded, ErrorTimeout},
+		{"budget", &BudgetExceededError{Scope: "total"}, ErrorBudgetExceeded},
+		{"other", errors.New("boom"), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyError(tt.err); got != tt.want {
+				t.Errorf("classifyError() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFallbackModels(t *testing.T) {
+	mini := FallbackModel{Model: Gpt4oMini, Deployment: "mini"}
+	tests := []struct {
+		name            string
+		chain           FallbackChain
+		queue           func(srv *azopenaitest.Server)
+		wantFallback    string   // Model recorded in the response metadata
+		wantErr         bool     // Whether the call fails
+		wantDeployments []string // Deployments called, with retries collapsed
+	}{
+		{
+			name:  "rate limit",
+			chain: FallbackChain{Models: []FallbackModel{mini}},
+			queue: func(srv *azopenaitest.Server) {
+				srv.QueueError(azopenaitest.EndpointChat, throttled())
+				srv.QueueChat(azopenaitest.ChatReply{Content: "from mini"})
+			},
+			wantFallback:    Gpt4oMini,
+			wantDeployments: []string{"chat", "mini"},
+		},
+		{
+			name:  "server error",
+			chain: FallbackChain{Models: []FallbackModel{mini}},
+			queue: func(srv *azopenaitest.Server) {
+				srv.QueueError(azopenaitest.EndpointChat, azopenaitest.Error{Status: http.StatusInternalServerError, Code: "server_error", RetryAfter: time.Millisecond, Times: 4})
+				srv.QueueChat(azopenaitest.ChatReply{Content: "from mini"})
+			},
+			wantFallback:    Gpt4oMini,
+			wantDeployments: []string{"chat", "mini"},
+		},
+		{
+			name:  "attempt timeout",
+			chain: FallbackChain{Models: []FallbackModel{mini}, On: []ErrorClass{ErrorTimeout}, Timeout: 50 * time.Millisecond},
+			queue: func(srv *azopenaitest.Server) {
+				srv.QueueChat(azopenaitest.ChatReply{Content: "too late", Delay: 5 * time.Second}, azopenaitest.ChatReply{Content: "from mini"})
+			},
+			wantFallback:    Gpt4oMini,
+			wantDeployments: []string{"chat", "mini"},
+		},
+		{
+			name:  "class not configured",
+			chain: FallbackChain{Models: []FallbackModel{mini}},
+			queue: func(srv *azopenaitest.Server) {
+				srv.QueueError(azopenaitest.EndpointChat, azopenaitest.ContentFiltered(nil))
+			},
+			wantErr:         true,
+			wantDeployments: []string{"chat"},
+		},
+		{
+			name:  "prompt filtered",
+			chain: FallbackChain{Models: []FallbackModel{mini}, On: []ErrorClass{ErrorContentFilter}},
+			queue: func(srv *azopenaitest.Server) {
+				srv.QueueError(azopenaitest.EndpointChat, azopenaitest.ContentFiltered(nil))
+				srv.QueueChat(azopenaitest.ChatReply{Content: "from mini"})
+			},
+			wantFallback:    Gpt4oMini,
+			wantDeployments: []string{"chat", "mini"},
+		},
+		{
+			name:  "completion blocked",
+			chain: FallbackChain{Models: []FallbackModel{mini}, On: []ErrorClass{ErrorContentFilter}},
+			queue: func(srv *azopenaitest.Server) {
+				srv.QueueChat(
+					azopenaitest.ChatReply{Content: "", FinishReason: "content_filter"},
+					azopenaitest.ChatReply{Content: "from mini"},
+				)
+			},
+			wantFallback:    Gpt4oMini,
+			wantDeployments: []string{"chat", "mini"},
+		},
+		{
+			name: "chain in order",
+			chain: FallbackChain{Models: []FallbackModel{
+				{Model: Gpt4o, Deployment: "chat-westus"},
+				mini,
+			}},
+			queue: func(srv *azopenaitest.Server) {
+				srv.QueueError(azopenaitest.EndpointChat, throttled(), throttled())
+				srv.QueueChat(azopenaitest.ChatReply{Content: "from mini"})
+			},
+			wantFallback:    Gpt4oMini,
+			wantDeployments: []string{"chat", "chat-westus", "mini"},
+		},
+		{
+			name:  "all fail",
+			chain: FallbackChain{Models: []FallbackModel{mini}},
+			queue: func(srv *azopenaitest.Server) {
+				srv.QueueError(azopenaitest.EndpointChat, throttled(), throttled())
+			},
+			wantErr:         true,
+			wantDeployments: []string{"chat", "mini"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, srv := initPlugin(t, func(p *AzureOpenAI) { p.FallbackModels = map[string]FallbackChain{Gpt4o: tt.chain} })
+			tt.queue(srv)
+
+			resp, err := Model(g, Gpt4o).Generate(context.Background(), helloRequest(), nil)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("Expected an error")
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("Generate failed: %v", err)
+				}
+				if resp.Text() != "from mini" {
+					t.Errorf("Text = %q", resp.Text())
+				}
+				if got := ResponseMetadataFrom(resp).Fallback; got != tt.wantFallback {
+					t.Errorf("Fallback = %q, want %q", got, tt.wantFallback)
+				}
+			}
+
+			var deployments []string
+			for _, r := range srv.Requests() {
+				deployments = append(deployments, r.Deployment)
+			}
+			if got := slices.Compact(deployments); !slices.Equal(got, tt.wantDeployments) {
+				t.Errorf("Deployments = %v, want %v", got, tt.wantDeployments)
+			}
+		})
+	}
+}
+
+func TestFallbackModels_KeepsSettings(t *testing.T) {
+	g, srv := initPlugin(t, func(p *AzureOpenAI) {
+		p.Middleware = []Middleware{mapConfig}
+		p.FallbackModels = map[string]FallbackChain{
+			Gpt4o: {Models: []FallbackModel{{Model: Gpt4oMini, Deployment: "mini"}}},
+		}
+	})
+	srv.QueueError(azopenaitest.EndpointChat, throttled())
+	srv.QueueChat(azopenaitest.ChatReply{Content: "from mini"})
+
+	req := helloRequest()
+	req.Config = &OpenAIConfig{Temperature: to.Ptr[float32](0.5), MaxTokens: to.Ptr[int32](42), User: "bob"}
+	if _, err := Model(g, Gpt4o).Generate(context.Background(), req, nil); err != nil {
+		t.Fatalf("Generate() error: %v", err)
+	}
+	requests := srv.Requests()
+	sent := requests[len(requests)-1]
+	body := sent.JSON()
+	if sent.Deployment != "mini" || body["temperature"] != 0.5 || body["max_tokens"] != float64(42) || body["user"] != "bob" {
+		t.Errorf("Fallback request to %q lost the caller's settings: %v", sent.Deployment, body)
+	}
+}
+
+func TestFallbackModels_AllFailJoinsErrors(t *testing.T) {
+	g, srv := initPlugin(t, func(p *AzureOpenAI) {
+		p.FallbackModels = map[string]FallbackChain{
+			Gpt4o: {Models: []FallbackModel{{Model: Gpt4oMini}, {Model: "undefined"}}},
+		}
+	})
+	srv.QueueError(azopenaitest.EndpointChat, throttled(), throttled())
+
+	_, err := Model(g, Gpt4o).Generate(context.Background(), helloRequest(), nil)
+	var rl *RateLimitError
+	if !errors.As(err, &rl) {
+		t.Fatalf("Expected *RateLimitError, got %v", err)
+	}
+	if !strings.Contains(err.Error(), `fallback model "undefined" is not defined`) {
+		t.Errorf("Error = %v", err)
+	}
+}
+
+func TestFallbackModels_NoLoop(t *testing.T) {
+	// Each model falls back to the other; a fallback call must not fall back again
+	g, srv := initPlugin(t, func(p *AzureOpenAI) {
+		p.FallbackModels = map[string]FallbackChain{
+			Gpt4o:     {Models: []FallbackModel{{Model: Gpt4oMini, Deployment: "mini"}}},
+			Gpt4oMini: {Models: []FallbackModel{{Model: Gpt4o, Deployment: "chat"}}},
+		}
+	})
+	srv.QueueError(azopenaitest.EndpointChat, throttled(), throttled())
+
+	if _, err := Model(g, Gpt4o).Generate(context.Background(), helloRequest(), nil); err == nil {
+		t.Fatal("Expected an error")
+	}
+	if n := len(srv.Requests()); n != 8 {
+		t.Errorf("Expected 8 requests including retries, got %d", n)
+	}
+}
+
+func TestFallbackModels_NotAfterStreaming(t *testing.T) {
+	g, srv := initPlugin(t, func(p *AzureOpenAI) {
+		p.FallbackModels = map[string]FallbackChain{
+			Gpt4o: {Models: []FallbackModel{{Model: Gpt4oMini, Deployment: "mini"}}, On: []ErrorClass{ErrorContentFilter}},
+		}
+	})
+	srv.QueueChat(
+		azopenaitest.ChatReply{Chunks: []string{"partial"}, FinishReason: "content_filter"},
+		azopenaitest.ChatReply{Content: "from mini"},
+	)
+
+	var chunks []string
+	resp, err := Model(g, Gpt4o).Generate(context.Background(), helloRequest(), func(ctx context.Context, c *ai.ModelResponseChunk) error {
+		chunks = append(chunks, c.Text())
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if resp.FinishReason != ai.FinishReasonBlocked || ResponseMetadataFrom(resp).Fallback != "" {
+		t.Errorf("Expected the blocked response without fallback, got %q", resp.FinishReason)
+	}
+	if n := len(srv.Requests()); n != 1 {
+		t.Errorf("Expected 1 request, got %d", n)
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright 2025 herosizy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package azopenai
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/ai/azopenai"
+	"github.com/firebase/genkit/go/ai"
+)
+
+// HedgeOptions configures hedged chat requests. When a non-streaming request has
+// not answered within Delay, a duplicate is sent and whichever succeeds first is
+// returned; the other is cancelled. The loser's usage is reported in
+// [ResponseMetadata].HedgeUsage and charged to costs and budgets along with the
+// winner's. Streaming, legacy completions and Responses API requests are not hedged.
+type HedgeOptions struct {
+	Models     []string      // Models to hedge, including ones added with DefineModel. If empty, every chat model is hedged.
+	Delay      time.Duration // Wait before sending the duplicate, e.g. the model's p95 latency. Zero sends both at once.
+	Client     Client        // Client for the duplicate, e.g. for another region. If nil, the plugin's client is used.
+	Deployment string        // Deployment for the duplicate. Defaults to the request's deployment.
+}
+
+// Values of ResponseMetadata.Hedge
+const (
+	hedgePrimary = "primary"
+	hedgeHedge   = "hedge"
+)
+
+// hedger sends hedged chat completion requests.
+type hedger struct {
+	client     Client
+	deployment string
+	delay      time.Duration
+	models     []string
+	limits     *limiter
+}
+
+// newHedger creates a hedger sending duplicates through client, or opts.Client
+// wrapped in mw when it is set. Duplicates take a slot from limits like any request.
+func newHedger(opts HedgeOptions, client Client, mw []ClientMiddleware, limits *limiter) *hedger {
+	if opts.Client != nil {
+		client = wrapClient(opts.Client, mw)
+	}
+	return &hedger{client: client, deployment: opts.Deployment, delay: opts.Delay, models: opts.Models, limits: limits}
+}
+
+// forModel returns the hedger if the named model is hedged
+func (h *hedger) forModel(name string) *hedger {
+	if h == nil || (len(h.models) > 0 && !slices.Contains(h.models, name)) {
+		return nil
+	}
+	return h
+}
+
+type hedgeResult struct {
+	resp   *ai.ModelResponse
+	err    error
+	winner string
+}
+
+// generate sends options through client and, if it has not answered after the
+// delay, a duplicate through the hedge client. An error before the delay is
+// returned without hedging; if both requests fail, the primary's error is returned.
+func (h *hedger) generate(ctx context.Context, client Client, options azopenai.ChatCompletionsOptions, op *operation) (*ai.ModelResponse, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan hedgeResult, 2)
+	send := func(c Client, options azopenai.ChatCompletionsOptions, name string) {
+		resp, err := handleNonStreamingRequest(ctx, c, options)
+		results <- hedgeResult{resp: resp, err: err, winner: name}
+	}
+	go send(client, options, hedgePrimary)
+
+	if h.delay > 0 {
+		timer := time.NewTimer(h.delay)
+		defer timer.Stop()
+		select {
+		case r := <-results:
+			return r.resp, r.err
+		case <-timer.C:
+		}
+	}
+
+	dup := options
+	if h.deployment != "" {
+		dup.DeploymentName = &h.deployment
+	}
+	go func() {
+		release, err := h.limits.acquire(ctx, deref(dup.DeploymentName))
+		if err != nil {
+			results <- hedgeResult{err: err, winner: hedgeHedge}
+			return
+		}
+		defer release()
+		send(h.client, dup, hedgeHedge)
+	}()
+
+	var primaryErr error
+	var failed bool
+	for range 2 {
+		r := <-results
+		if r.err != nil {
+			if r.winner == hedgePrimary {
+				primaryErr = r.err
+			}
+			failed = true
+			continue
+		}
+		cancel()
+		var loser *ai.GenerationUsage
+		if !failed {
+			loser = loserUsage(r.resp, results)
+		}
+		op.recordHedge(ctx, r.winner, loser)
+		md := responseMetadata(r.resp)
+		md.Hedge = r.winner
+		md.HedgeUsage = loser
+		return r.resp, nil
+	}
+	return nil, primaryErr
+}
+
+// loserUsage returns the usage of the request that lost to winner. If it has not
+// answered, it is cancelled and counted with the winner's prompt tokens, since
+// both sent the same prompt. A request that fails is not counted.
+func loserUsage(winner *ai.ModelResponse, results <-chan hedgeResult) *ai.GenerationUsage {
+	select {
+	case r := <-results:
+		if r.err != nil {
+			return nil
+		}
+		return r.resp.Usage
+	default:
+	}
+	if winner.Usage == nil {
+		return nil
+	}
+	return &ai.GenerationUsage{InputTokens: winner.Usage.InputTokens}
+}
@@ -0,0 +1,285 @@
+// Copyright 2025 herosizy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package azopenai
+
+import (
+	"context"
+	"errors"
+	"math"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/ai/azopenai"
+	"github.com/HeroSizy/genkit-go-plugins/azopenai/azopenaitest"
+	"github.com/firebase/genkit/go/genkit"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// failingClient fails chat completions after a delay; other methods panic
+type failingClient struct {
+	Client
+	delay time.Duration
+	err   error
+}
+
+func (c failingClient) GetChatCompletions(ctx context.Context, body azopenai.ChatCompletionsOptions, options *azopenai.GetChatCompletionsOptions) (azopenai.GetChatCompletionsResponse, error) {
+	time.Sleep(c.delay)
+	return azopenai.GetChatCompletionsResponse{}, c.err
+}
+
+// initWithHedge initializes the plugin against a fake service with hedging.
+// Chat replies echo their deployment and take the latency given for it.
+func initWithHedge(t *testing.T, hedge HedgeOptions, latency map[string]time.Duration, tel *TelemetryOptions) (*genkit.Genkit, *azopenaitest.Server) {
+	t.Helper()
+	g, srv := initPlugin(t, func(p *AzureOpenAI) {
+		p.Hedge = &hedge
+		p.Telemetry = tel
+	})
+	srv.OnChat(func(r azopenaitest.Request) azopenaitest.ChatReply {
+		return azopenaitest.ChatReply{
+			Content: "from " + r.Deployment,
+			Delay:   latency[r.Deployment],
+			Usage:   &azopenaitest.Usage{PromptTokens: 8, CompletionTokens: 3},
+		}
+	})
+	return g, srv
+}
+
+func TestHedge(t *testing.T) {
+	tests := []struct {
+		name            string
+		hedge           HedgeOptions
+		latency         map[string]time.Duration
+		wantText        string
+		wantHedge       string
+		wantDeployments []string
+	}{
+		{
+			name:            "answered before delay",
+			hedge:           HedgeOptions{Delay: time.Second, Deployment: "chat-b"},
+			wantText:        "from chat",
+			wantDeployments: []string{"chat"},
+		},
+		{
+			name:            "slow primary",
+			hedge:           HedgeOptions{Delay: 20 * time.Millisecond, Deployment: "chat-b"},
+			latency:         map[string]time.Duration{"chat": 5 * time.Second},
+			wantText:        "from chat-b",
+			wantHedge:       hedgeHedge,
+			wantDeployments: []string{"chat", "chat-b"},
+		},
+		{
+			name:            "slow hedge",
+			hedge:           HedgeOptions{Delay: 20 * time.Millisecond, Deployment: "chat-b"},
+			latency:         map[string]time.Duration{"chat": 100 * time.Millisecond, "chat-b": 5 * time.Second},
+			wantText:        "from chat",
+			wantHedge:       hedgePrimary,
+			wantDeployments: []string{"chat", "chat-b"},
+		},
+		{
+			name:            "model not hedged",
+			hedge:           HedgeOptions{Models: []string{Gpt4oMini}},
+			latency:         map[string]time.Duration{"chat": 50 * time.Millisecond},
+			wantText:        "from chat",
+			wantDeployments: []string{"chat"},
+		},
+		{
+			name:            "failed hedge",
+			hedge:           HedgeOptions{Delay: 20 * time.Millisecond, Client: failingClient{err: errors.New("unavailable")}},
+			latency:         map[string]time.Duration{"chat": 100 * time.Millisecond},
+			wantText:        "from chat",
+			wantHedge:       hedgePrimary,
+			wantDeployments: []string{"chat"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, srv := initWithHedge(t, tt.hedge, tt.latency, nil)
+			start := time.Now()
+			resp, err := Model(g, Gpt4o).Generate(context.Background(), helloRequest(), nil)
+			if err != nil {
+				t.Fatalf("Generate failed: %v", err)
+			}
+			if elapsed := time.Since(start); elapsed > 2*time.Second {
+				t.Errorf("Generate took %v, expected the slow request to be cancelled", elapsed)
+			}
+			if resp.Text() != tt.wantText {
+				t.Errorf("Text = %q, want %q", resp.Text(), tt.wantText)
+			}
+			if got := ResponseMetadataFrom(resp).Hedge; got != tt.wantHedge {
+				t.Errorf("Hedge = %q, want %q", got, tt.wantHedge)
+			}
+			var deployments []string
+			for _, r := range srv.Requests() {
+				deployments = append(deployments, r.Deployment)
+			}
+			slices.Sort(deployments)
+			if !slices.Equal(deployments, tt.wantDeployments) {
+				t.Errorf("Deployments = %v, want %v", deployments, tt.wantDeployments)
+			}
+		})
+	}
+}
+
+func TestHedge_ZeroDelay(t *testing.T) {
+	g, srv := initWithHedge(t, HedgeOptions{Deployment: "chat-b"}, nil, nil)
+	// The hedge only answers once the primary has reached the service, which
+	// holds it until the hedge wins, so both are sent without waiting
+	primary := make(chan struct{})
+	srv.OnChat(func(r azopenaitest.Request) azopenaitest.ChatReply {
+		if r.Deployment == "chat" {
+			close(primary)
+			return azopenaitest.ChatReply{Content: "from chat", Delay: time.Minute}
+		}
+		select {
+		case <-primary:
+		case <-time.After(5 * time.Second):
+			return azopenaitest.ChatReply{Content: "primary never arrived"}
+		}
+		return azopenaitest.ChatReply{Content: "from chat-b"}
+	})
+
+	resp, err := Model(g, Gpt4o).Generate(context.Background(), helloRequest(), nil)
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if resp.Text() != "from chat-b" || ResponseMetadataFrom(resp).Hedge != hedgeHedge {
+		t.Errorf("Expected the hedge to win, got %q (%q)", resp.Text(), ResponseMetadataFrom(resp).Hedge)
+	}
+}
+
+func TestHedge_Errors(t *testing.T) {
+	ctx := context.Background()
+	primaryErr := errors.New("primary failed")
+
+	t.Run("before delay", func(t *testing.T) {
+		g, srv := initWithHedge(t, HedgeOptions{Delay: time.Second}, nil, nil)
+		srv.QueueError(azopenaitest.EndpointChat, azopenaitest.DeploymentNotFound())
+		_, err := Model(g, Gpt4o).Generate(ctx, helloRequest(), nil)
+		var nf *DeploymentNotFoundError
+		if !errors.As(err, &nf) {
+			t.Fatalf("Expected *DeploymentNotFoundError, got %v", err)
+		}
+		if n := len(srv.Requests()); n != 1 {
+			t.Errorf("Expected no hedge, got %d requests", n)
+		}
+	})
+
+	t.Run("both fail", func(t *testing.T) {
+		g, err := genkit.Init(ctx)
+		if err != nil {
+			t.Fatalf("Failed to initialize Genkit: %v", err)
+		}
+		plugin := &AzureOpenAI{
+			Client: failingClient{delay: 50 * time.Millisecond, err: primaryErr},
+			Hedge:  &HedgeOptions{Client: failingClient{err: errors.New("hedge failed")}},
+		}
+		if err := plugin.Init(ctx, g); err != nil {
+			t.Fatalf("Failed to initialize plugin: %v", err)
+		}
+		if _, err := Model(g, Gpt4o).Generate(ctx, helloRequest(), nil); !errors.Is(err, primaryErr) {
+			t.Errorf("Expected the primary's error, got %v", err)
+		}
+	})
+}
+
+func TestHedge_Telemetry(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	g, _ := initWithHedge(t,
+		HedgeOptions{Delay: 20 * time.Millisecond, Deployment: "chat-b"},
+		map[string]time.Duration{"chat": 5 * time.Second},
+		&TelemetryOptions{MeterProvider: sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))})
+
+	if _, err := Model(g, Gpt4o).Generate(context.Background(), helloRequest(), nil); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("Failed to collect metrics: %v", err)
+	}
+	// Both requests are counted: the winner's usage and the cancelled one's prompt
+	tokens := map[string]int64{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != metricTokenUsage {
+				continue
+			}
+			for _, dp := range m.Data.(metricdata.Histogram[int64]).DataPoints {
+				typ, _ := dp.Attributes.Value(attrTokenType)
+				key := typ.AsString()
+				if loser, ok := dp.Attributes.Value(attribute.Key(attrHedgeLoser)); ok && loser.AsBool() {
+					key = "loser " + key
+				}
+				tokens[key] += dp.Sum
+			}
+		}
+	}
+	want := map[string]int64{"input": 8, "output": 3, "loser input": 8}
+	for k, v := range want {
+		if tokens[k] != v {
+			t.Errorf("Token usage %s = %d, want %d (all: %v)", k, tokens[k], v, tokens)
+		}
+	}
+}
+
+func TestHedge_Accounting(t *testing.T) {
+	tracker := NewCostTracker()
+	g, srv := initPlugin(t, func(p *AzureOpenAI) {
+		p.Hedge = &HedgeOptions{Delay: 20 * time.Millisecond, Deployment: "chat-b"}
+		p.Pricing = map[string]Price{"chat": {Input: 1, Output: 4}}
+		p.CostTracker = tracker
+		p.Budget = &BudgetOptions{Total: &BudgetLimit{MaxTokens: 20}}
+	})
+	srv.OnChat(func(r azopenaitest.Request) azopenaitest.ChatReply {
+		delay := time.Duration(0)
+		if r.Deployment == "chat" {
+			delay = 5 * time.Second
+		}
+		return azopenaitest.ChatReply{Content: "from " + r.Deployment, Delay: delay, Usage: &azopenaitest.Usage{PromptTokens: 8, CompletionTokens: 3}}
+	})
+
+	resp, err := Model(g, Gpt4o).Generate(context.Background(), helloRequest(), nil)
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	// The cancelled primary is charged the prompt it was sent
+	md := ResponseMetadataFrom(resp)
+	if md.HedgeUsage == nil || md.HedgeUsage.InputTokens != 8 || md.HedgeUsage.OutputTokens != 0 {
+		t.Fatalf("HedgeUsage = %+v, want 8 input tokens", md.HedgeUsage)
+	}
+	wantCost := (16*1 + 3*4) * 1e-6
+	if md.Cost == nil || math.Abs(md.Cost.Total-wantCost) > 1e-12 {
+		t.Errorf("Cost = %+v, want total %v", md.Cost, wantCost)
+	}
+	if s := tracker.Summary(""); s.Requests != 2 || s.InputTokens != 16 || s.OutputTokens != 3 {
+		t.Errorf("Summary = %+v, want both requests", s)
+	}
+
+	_, err = Model(g, Gpt4o).Generate(context.Background(), helloRequest(), nil)
+	var budgetErr *BudgetExceededError
+	if !errors.As(err, &budgetErr) || budgetErr.UsedTokens != 19 {
+		t.Errorf("Expected the total budget to have both requests charged, got %v", err)
+	}
+}
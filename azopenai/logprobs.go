@@ -0,0 +1,108 @@
+// Copyright 2025 herosizy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package azopenai
+
+import (
+	"cmp"
+	"encoding/json"
+	"slices"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/ai/azopenai"
+	"github.com/firebase/genkit/go/ai"
+)
+
+// TokenLogProb is the log probability of one generated token. Requested log
+// probabilities are stored in ResponseMetadata.LogProbs for the whole response
+// and in ChunkMetadata.LogProbs for the tokens of each streamed chunk.
+type TokenLogProb struct {
+	Token       string       `json:"token"`                 // Token text
+	LogProb     float32      `json:"logprob"`               // Natural log of the token's probability
+	TopLogProbs []TopLogProb `json:"topLogprobs,omitempty"` // Most likely tokens at this position, most likely first
+}
+
+// TopLogProb is a candidate token at a position in the output.
+type TopLogProb struct {
+	Token   string  `json:"token"`
+	LogProb float32 `json:"logprob"`
+}
+
+// ChunkMetadata is the plugin-specific metadata stored in ModelResponseChunk.Custom.
+type ChunkMetadata struct {
+	LogProbs []TokenLogProb `json:"logprobs,omitempty"` // Log probabilities of the chunk's tokens
+}
+
+// ChunkMetadataFrom returns the plugin metadata attached to chunk, or nil if there is none.
+// It accepts both the typed value set by the plugin and its JSON-decoded map form.
+func ChunkMetadataFrom(chunk *ai.ModelResponseChunk) *ChunkMetadata {
+	if chunk == nil || chunk.Custom == nil {
+		return nil
+	}
+	if md, ok := chunk.Custom.(*ChunkMetadata); ok {
+		return md
+	}
+	b, err := json.Marshal(chunk.Custom)
+	if err != nil {
+		return nil
+	}
+	var md ChunkMetadata
+	if err := json.Unmarshal(b, &md); err != nil {
+		return nil
+	}
+	return &md
+}
+
+// convertChatLogProbs converts chat completions log probabilities
+func convertChatLogProbs(lp *azopenai.ChatChoiceLogProbs) []TokenLogProb {
+	if lp == nil || len(lp.Content) == 0 {
+		return nil
+	}
+	out := make([]TokenLogProb, len(lp.Content))
+	for i, result := range lp.Content {
+		out[i] = TokenLogProb{Token: deref(result.Token), LogProb: deref(result.Logprob)}
+		for _, top := range result.TopLogProbs {
+			out[i].TopLogProbs = append(out[i].TopLogProbs, TopLogProb{Token: deref(top.Token), LogProb: deref(top.Logprob)})
+		}
+	}
+	return out
+}
+
+// convertCompletionsLogProbs converts legacy completions log probabilities
+func convertCompletionsLogProbs(lp *azopenai.ChoiceLogProbs) []TokenLogProb {
+	if lp == nil || len(lp.Tokens) == 0 {
+		return nil
+	}
+	out := make([]TokenLogProb, len(lp.Tokens))
+	for i, token := range lp.Tokens {
+		out[i].Token = token
+		if i < len(lp.TokenLogProbs) {
+			out[i].LogProb = lp.TokenLogProbs[i]
+		}
+		if i < len(lp.TopLogProbs) {
+			for t, p := range lp.TopLogProbs[i] {
+				out[i].TopLogProbs = append(out[i].TopLogProbs, TopLogProb{Token: t, LogProb: deref(p)})
+			}
+			slices.SortFunc(out[i].TopLogProbs, func(a, b TopLogProb) int {
+				return cmp.Or(cmp.Compare(b.LogProb, a.LogProb), cmp.Compare(a.Token, b.Token))
+			})
+		}
+	}
+	return out
+}
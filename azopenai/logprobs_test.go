@@ -0,0 +1,143 @@
+// Copyright 2025 herosizy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package azopenai
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/HeroSizy/genkit-go-plugins/azopenai/azopenaitest"
+	"github.com/firebase/genkit/go/ai"
+)
+
+func TestChatLogProbs(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    OpenAIConfig
+		stream    bool
+		wantBody  map[string]any
+		wantTop   int
+		wantProbs bool
+	}{
+		{name: "disabled", config: OpenAIConfig{DeploymentName: "chat"}, wantBody: map[string]any{}},
+		{name: "logprobs", config: OpenAIConfig{DeploymentName: "chat", LogProbs: true}, wantBody: map[string]any{"logprobs": true}, wantProbs: true},
+		{name: "top logprobs imply logprobs", config: OpenAIConfig{DeploymentName: "chat", TopLogProbs: to.Ptr(int32(2))}, wantBody: map[string]any{"logprobs": true, "top_logprobs": float64(2)}, wantTop: 2, wantProbs: true},
+		{name: "streaming", config: OpenAIConfig{DeploymentName: "chat", TopLogProbs: to.Ptr(int32(1))}, stream: true, wantBody: map[string]any{"logprobs": true, "top_logprobs": float64(1)}, wantTop: 1, wantProbs: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, srv := initWithFakeServer(t)
+			srv.QueueChat(azopenaitest.ChatReply{Chunks: []string{"Hel", "lo"}})
+
+			req := helloRequest()
+			req.Config = &tt.config
+			var chunks []*ai.ModelResponseChunk
+			var cb ai.ModelStreamCallback
+			if tt.stream {
+				cb = func(ctx context.Context, c *ai.ModelResponseChunk) error {
+					chunks = append(chunks, c)
+					return nil
+				}
+			}
+			resp, err := Model(g, Gpt4o).Generate(context.Background(), req, cb)
+			if err != nil {
+				t.Fatalf("Generate() error: %v", err)
+			}
+
+			body := srv.Requests()[0].JSON()
+			for _, key := range []string{"logprobs", "top_logprobs"} {
+				if body[key] != tt.wantBody[key] {
+					t.Errorf("%s = %v, want %v", key, body[key], tt.wantBody[key])
+				}
+			}
+
+			md := ResponseMetadataFrom(resp)
+			if !tt.wantProbs {
+				if md != nil && len(md.LogProbs) > 0 {
+					t.Errorf("Unexpected log probabilities %+v", md.LogProbs)
+				}
+				return
+			}
+			if md == nil || len(md.LogProbs) != 2 {
+				t.Fatalf("Expected 2 token log probabilities, got %+v", md)
+			}
+			if lp := md.LogProbs[1]; lp.Token != "lo" || lp.LogProb != -0.2 || len(lp.TopLogProbs) != tt.wantTop {
+				t.Errorf("Unexpected log probability %+v", lp)
+			}
+			if tt.stream {
+				if len(chunks) != 2 {
+					t.Fatalf("Expected 2 chunks, got %d", len(chunks))
+				}
+				cmd := ChunkMetadataFrom(chunks[0])
+				if cmd == nil || len(cmd.LogProbs) != 1 || cmd.LogProbs[0].Token != "Hel" {
+					t.Errorf("Unexpected chunk metadata %+v", cmd)
+				}
+			}
+		})
+	}
+}
+
+func TestLogProbs_Unsupported(t *testing.T) {
+	req := helloRequest()
+	configs := map[string]OpenAIConfig{
+		"logprobs":     {LogProbs: true},
+		"top logprobs": {TopLogProbs: to.Ptr(int32(2))},
+	}
+	for name, cfg := range configs {
+		t.Run(name, func(t *testing.T) {
+			if _, err := convertToResponsesRequest(context.Background(), Gpt4o, req, cfg, "chat"); err == nil {
+				t.Error("Expected the Responses API to reject log probabilities")
+			}
+			if _, err := convertToCompletionsRequest(context.Background(), Gpt35TurboInstruct, req, cfg, "instruct"); err == nil || !strings.Contains(err.Error(), "CompletionsConfig.LogProbs") {
+				t.Errorf("Expected completions models to point at CompletionsConfig.LogProbs, got %v", err)
+			}
+		})
+	}
+}
+
+func TestChunkMetadataFrom(t *testing.T) {
+	tests := []struct {
+		name   string
+		custom any
+		want   string
+	}{
+		{name: "none"},
+		{name: "typed", custom: &ChunkMetadata{LogProbs: []TokenLogProb{{Token: "Hel", LogProb: -0.1}}}, want: "Hel"},
+		{name: "map", custom: map[string]any{"logprobs": []any{map[string]any{"token": "Hel", "logprob": -0.1}}}, want: "Hel"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			md := ChunkMetadataFrom(&ai.ModelResponseChunk{Custom: tt.custom})
+			if tt.want == "" {
+				if md != nil {
+					t.Errorf("Expected no metadata, got %+v", md)
+				}
+				return
+			}
+			if md == nil || len(md.LogProbs) != 1 || md.LogProbs[0].Token != tt.want || md.LogProbs[0].LogProb != -0.1 {
+				t.Errorf("Unexpected chunk metadata %+v", md)
+			}
+		})
+	}
+}
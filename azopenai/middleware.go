@@ -0,0 +1,101 @@
+// Copyright 2025 herosizy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package azopenai
+
+import (
+	"context"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/ai/azopenai"
+	"github.com/firebase/genkit/go/ai"
+)
+
+// ChatCall is a chat request as seen by [Middleware].
+//
+// Exactly one of Options, Responses and Completions is set, depending on the
+// backend serving the model. Changes to it are sent to the service; changes to
+// Request after conversion are not.
+type ChatCall struct {
+	Model       string                           // Name of the Genkit model being called
+	Request     *ai.ModelRequest                 // Genkit request
+	Options     *azopenai.ChatCompletionsOptions // Chat completions request converted from Request; nil for Responses and completions models
+	Responses   *ResponsesRequest                // Responses API request converted from Request, for models in AzureOpenAI.Responses
+	Completions *azopenai.CompletionsOptions     // Legacy completions request converted from Request, for instruct models
+	Callback    ai.ModelStreamCallback           // Streaming callback, nil for non-streaming calls; may be wrapped
+}
+
+// Deployment returns the name of the Azure deployment the call is sent to.
+func (c *ChatCall) Deployment() string {
+	if c.Responses != nil {
+		return c.Responses.Model
+	}
+	if c.Completions != nil {
+		return deref(c.Completions.DeploymentName)
+	}
+	if c.Options != nil {
+		return deref(c.Options.DeploymentName)
+	}
+	return ""
+}
+
+// ChatHandler handles a chat call.
+type ChatHandler func(ctx context.Context, call *ChatCall) (*ai.ModelResponse, error)
+
+// EmbedCall is an embeddings request as seen by [Middleware].
+type EmbedCall struct {
+	Model   string                      // Name of the Genkit embedder being called
+	Request *ai.EmbedRequest            // Genkit request
+	Options *azopenai.EmbeddingsOptions // Azure request converted from Request; changes are sent to the service
+}
+
+// EmbedHandler handles an embeddings call.
+type EmbedHandler func(ctx context.Context, call *EmbedCall) (*ai.EmbedResponse, error)
+
+// Middleware wraps the chat and embedding handlers of every model and embedder
+// defined by the plugin. Either field may be nil.
+//
+// Middleware listed first on AzureOpenAI runs outermost. A middleware can
+// short-circuit by returning without calling next. The context passed to next is
+// used for the HTTP call, so headers can be injected with runtime.WithHTTPHeader
+// from the azcore runtime package.
+type Middleware struct {
+	Chat  func(next ChatHandler) ChatHandler
+	Embed func(next EmbedHandler) EmbedHandler
+}
+
+// chainChat wraps h so that mw[0] is the outermost handler
+func chainChat(h ChatHandler, mw []Middleware) ChatHandler {
+	for i := len(mw) - 1; i >= 0; i-- {
+		if mw[i].Chat != nil {
+			h = mw[i].Chat(h)
+		}
+	}
+	return h
+}
+
+// chainEmbed wraps h so that mw[0] is the outermost handler
+func chainEmbed(h EmbedHandler, mw []Middleware) EmbedHandler {
+	for i := len(mw) - 1; i >= 0; i-- {
+		if mw[i].Embed != nil {
+			h = mw[i].Embed(h)
+		}
+	}
+	return h
+}
@@ -0,0 +1,152 @@
+// Copyright 2025 herosizy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package azopenai
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/ai/azopenai"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/HeroSizy/genkit-go-plugins/azopenai/azopenaitest"
+	"github.com/firebase/genkit/go/ai"
+)
+
+// traceMiddleware appends enter and exit markers for name to log
+func traceMiddleware(log *[]string, name string) Middleware {
+	return Middleware{
+		Chat: func(next ChatHandler) ChatHandler {
+			return func(ctx context.Context, call *ChatCall) (*ai.ModelResponse, error) {
+				*log = append(*log, name+">")
+				defer func() { *log = append(*log, "<"+name) }()
+				return next(ctx, call)
+			}
+		},
+	}
+}
+
+func TestMiddleware_Order(t *testing.T) {
+	var log []string
+	g, srv := initPlugin(t, func(p *AzureOpenAI) {
+		p.Middleware = []Middleware{traceMiddleware(&log, "a"), Middleware{}, traceMiddleware(&log, "b")}
+	})
+	srv.QueueChat(azopenaitest.ChatReply{Content: "ok"}, azopenaitest.ChatReply{Content: "ok"})
+
+	for _, cb := range []ai.ModelStreamCallback{nil, func(context.Context, *ai.ModelResponseChunk) error { return nil }} {
+		log = nil
+		if _, err := Model(g, Gpt4o).Generate(context.Background(), helloRequest(), cb); err != nil {
+			t.Fatalf("Generate() error: %v", err)
+		}
+		if got := strings.Join(log, " "); got != "a> b> <b <a" {
+			t.Errorf("Middleware order = %q", got)
+		}
+	}
+}
+
+func TestMiddleware_ModifyRequest(t *testing.T) {
+	redact := Middleware{
+		Chat: func(next ChatHandler) ChatHandler {
+			return func(ctx context.Context, call *ChatCall) (*ai.ModelResponse, error) {
+				if call.Request == nil || call.Options.DeploymentName == nil {
+					t.Error("Middleware should see the Genkit request and Azure options")
+				}
+				call.Options.Messages = []azopenai.ChatRequestMessageClassification{
+					&azopenai.ChatRequestUserMessage{Content: azopenai.NewChatRequestUserMessageContent("[REDACTED]")},
+				}
+				ctx = runtime.WithHTTPHeader(ctx, http.Header{"X-Audit-Id": []string{"42"}})
+				return next(ctx, call)
+			}
+		},
+	}
+	g, srv := initPlugin(t, func(p *AzureOpenAI) { p.Middleware = []Middleware{redact} })
+	srv.QueueChat(azopenaitest.ChatReply{Content: "ok"})
+
+	if _, err := Model(g, Gpt4o).Generate(context.Background(), helloRequest(), nil); err != nil {
+		t.Fatalf("Generate() error: %v", err)
+	}
+	req := srv.Requests()[0]
+	if !strings.Contains(string(req.Body), "[REDACTED]") || strings.Contains(string(req.Body), "Hello") {
+		t.Errorf("Request body should be redacted: %s", req.Body)
+	}
+	if got := req.Header.Get("X-Audit-Id"); got != "42" {
+		t.Errorf("X-Audit-Id = %q, want 42", got)
+	}
+}
+
+func TestMiddleware_ShortCircuitStreaming(t *testing.T) {
+	canned := Middleware{
+		Chat: func(next ChatHandler) ChatHandler {
+			return func(ctx context.Context, call *ChatCall) (*ai.ModelResponse, error) {
+				if call.Callback != nil {
+					if err := call.Callback(ctx, &ai.ModelResponseChunk{Content: []*ai.Part{ai.NewTextPart("canned")}}); err != nil {
+						return nil, err
+					}
+				}
+				return &ai.ModelResponse{Message: ai.NewModelTextMessage("canned"), FinishReason: ai.FinishReasonStop}, nil
+			}
+		},
+	}
+	g, srv := initPlugin(t, func(p *AzureOpenAI) { p.Middleware = []Middleware{canned} })
+
+	var chunks []string
+	resp, err := Model(g, Gpt4o).Generate(context.Background(), helloRequest(), func(ctx context.Context, c *ai.ModelResponseChunk) error {
+		chunks = append(chunks, c.Text())
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Generate() error: %v", err)
+	}
+	if resp.Text() != "canned" || len(chunks) != 1 {
+		t.Errorf("Expected the canned response, got %q with chunks %q", resp.Text(), chunks)
+	}
+	if n := len(srv.Requests()); n != 0 {
+		t.Errorf("Short-circuited calls should not reach the service, got %d requests", n)
+	}
+}
+
+func TestMiddleware_Embed(t *testing.T) {
+	var seen []string
+	mw := Middleware{
+		Embed: func(next EmbedHandler) EmbedHandler {
+			return func(ctx context.Context, call *EmbedCall) (*ai.EmbedResponse, error) {
+				seen = append(seen, call.Options.Input...)
+				call.Options.Input = []string{"rewritten"}
+				return next(ctx, call)
+			}
+		},
+	}
+	g, srv := initPlugin(t, func(p *AzureOpenAI) { p.Middleware = []Middleware{mw} })
+
+	_, err := Embedder(g, TextEmbedding3Small).Embed(context.Background(), &ai.EmbedRequest{
+		Input: []*ai.Document{ai.DocumentFromText("original", nil)},
+	})
+	if err != nil {
+		t.Fatalf("Embed() error: %v", err)
+	}
+	if len(seen) != 1 || seen[0] != "original" {
+		t.Errorf("Middleware saw %q", seen)
+	}
+	if body := string(srv.Requests()[0].Body); !strings.Contains(body, "rewritten") {
+		t.Errorf("Request body should carry the rewritten input: %s", body)
+	}
+}
@@ -21,6 +21,8 @@
 package azopenai
 
 import (
+	"slices"
+
 	"github.com/firebase/genkit/go/ai"
 )
 
@@ -118,6 +120,21 @@ var (
 		Media:      false,
 	}
 
+	// Model capabilities for instruct models on the legacy completions endpoint.
+	// Conversations are flattened into a single prompt.
+	InstructModel = ai.ModelSupports{
+		Multiturn:  true,
+		Tools:      false,
+		ToolChoice: false,
+		SystemRole: true,
+		Media:      false,
+	}
+
+	// completionsModels lists models served by the legacy completions endpoint
+	completionsModels = []string{
+		gpt35TurboInstruct,
+	}
+
 	// Model capabilities for multimodal models
 	MultimodalModel = ai.ModelSupports{
 		Multiturn:  true,
@@ -187,7 +204,7 @@ var (
 			Versions: []string{
 				"gpt-3.5-turbo-instruct-0914",
 			},
-			Supports: &TextModel,
+			Supports: &InstructModel,
 			Stage:    ai.ModelStageStable,
 		},
 		textEmbedding3Large: {
@@ -245,6 +262,40 @@ var (
 	}
 )
 
+// ModelLimits describes the token limits of a model.
+type ModelLimits struct {
+	ContextWindow   int // Maximum number of tokens in the prompt and completion combined
+	MaxOutputTokens int // Maximum number of tokens the model can generate in one response
+}
+
+// modelLimits maps model names to their context and output token limits
+var modelLimits = map[string]ModelLimits{
+	gpt4:                {ContextWindow: 8192, MaxOutputTokens: 4096},
+	gpt4Turbo:           {ContextWindow: 128000, MaxOutputTokens: 4096},
+	gpt4TurboPreview:    {ContextWindow: 128000, MaxOutputTokens: 4096},
+	gpt4o:               {ContextWindow: 128000, MaxOutputTokens: 16384},
+	gpt4oMini:           {ContextWindow: 128000, MaxOutputTokens: 16384},
+	gpt35Turbo:          {ContextWindow: 16385, MaxOutputTokens: 4096},
+	gpt35TurboInstruct:  {ContextWindow: 4097, MaxOutputTokens: 1024},
+	gpt41:               {ContextWindow: 1047576, MaxOutputTokens: 32768},
+	gpt41Mini:           {ContextWindow: 1047576, MaxOutputTokens: 32768},
+	o4Mini:              {ContextWindow: 200000, MaxOutputTokens: 100000},
+	textEmbedding3Large: {ContextWindow: 8191},
+	textEmbedding3Small: {ContextWindow: 8191},
+}
+
+// LookupModelLimits returns the token limits of the named model.
+// The second result reports whether the model is known.
+func LookupModelLimits(name string) (ModelLimits, bool) {
+	limits, ok := modelLimits[name]
+	return limits, ok
+}
+
+// usesCompletions reports whether the named model is served by the legacy completions endpoint
+func usesCompletions(name string) bool {
+	return slices.Contains(completionsModels, name)
+}
+
 // listModels returns a map of supported models and their capabilities
 func listModels() (map[string]ai.ModelInfo, error) {
 	models := make(map[string]ai.ModelInfo, len(azureOpenAIModels))
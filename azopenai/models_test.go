@@ -68,6 +68,27 @@ func TestListModels(t *testing.T) {
 	}
 }
 
+func TestLookupModelLimits(t *testing.T) {
+	// Every catalog model should have limits
+	for _, name := range azureOpenAIModels {
+		limits, ok := LookupModelLimits(name)
+		if !ok {
+			t.Errorf("Model %s has no limits defined", name)
+			continue
+		}
+		if limits.ContextWindow <= 0 {
+			t.Errorf("Model %s should have a positive context window", name)
+		}
+		if limits.MaxOutputTokens > limits.ContextWindow {
+			t.Errorf("Model %s max output %d exceeds context window %d", name, limits.MaxOutputTokens, limits.ContextWindow)
+		}
+	}
+
+	if _, ok := LookupModelLimits("unknown-model"); ok {
+		t.Error("LookupModelLimits() should report unknown models")
+	}
+}
+
 func TestListEmbedders(t *testing.T) {
 	embedders, err := listEmbedders()
 	if err != nil {
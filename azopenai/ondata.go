@@ -0,0 +1,265 @@
+// Copyright 2025 herosizy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package azopenai
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/ai/azopenai"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+)
+
+// DataSource configures an Azure OpenAI "On Your Data" source used to ground responses.
+// Exactly one of AzureSearch or CosmosDB must be set.
+type DataSource struct {
+	AzureSearch *AzureSearchDataSource `json:"azureSearch,omitempty"` // Azure AI Search index
+	CosmosDB    *CosmosDBDataSource    `json:"cosmosDB,omitempty"`    // Azure Cosmos DB for MongoDB vCore index
+}
+
+// AzureSearchDataSource configures an Azure AI Search index as a data source.
+type AzureSearchDataSource struct {
+	Endpoint              string              `json:"endpoint"`                        // Search service endpoint
+	IndexName             string              `json:"indexName"`                       // Name of the search index
+	QueryType             string              `json:"queryType,omitempty"`             // "simple", "semantic", "vector", "vector_simple_hybrid" or "vector_semantic_hybrid"
+	SemanticConfiguration string              `json:"semanticConfiguration,omitempty"` // Semantic configuration for semantic queries
+	Filter                string              `json:"filter,omitempty"`                // OData filter applied to the search
+	TopNDocuments         *int32              `json:"topNDocuments,omitempty"`         // Number of documents used to ground the answer
+	Strictness            *int32              `json:"strictness,omitempty"`            // Relevance filtering strictness (1 to 5)
+	InScope               *bool               `json:"inScope,omitempty"`               // Whether answers are limited to the indexed data
+	EmbeddingDeployment   string              `json:"embeddingDeployment,omitempty"`   // Embedding deployment used for vector queries
+	FieldsMapping         *DataSourceFieldMap `json:"fieldsMapping,omitempty"`         // Index field mapping
+	Auth                  DataSourceAuth      `json:"auth"`                            // Authentication to the search service
+}
+
+// CosmosDBDataSource configures an Azure Cosmos DB for MongoDB vCore index as a data source.
+type CosmosDBDataSource struct {
+	DatabaseName        string             `json:"databaseName"`            // Database name
+	ContainerName       string             `json:"containerName"`           // Container name
+	IndexName           string             `json:"indexName"`               // Vector index name
+	EmbeddingDeployment string             `json:"embeddingDeployment"`     // Embedding deployment used for vector queries
+	FieldsMapping       DataSourceFieldMap `json:"fieldsMapping"`           // Container field mapping; ContentFields and VectorFields are required
+	TopNDocuments       *int32             `json:"topNDocuments,omitempty"` // Number of documents used to ground the answer
+	Strictness          *int32             `json:"strictness,omitempty"`    // Relevance filtering strictness (1 to 5)
+	InScope             *bool              `json:"inScope,omitempty"`       // Whether answers are limited to the indexed data
+	Auth                DataSourceAuth     `json:"auth"`                    // Authentication; requires ConnectionString
+}
+
+// DataSourceFieldMap maps index fields to the roles Azure OpenAI expects.
+type DataSourceFieldMap struct {
+	ContentFields []string `json:"contentFields,omitempty"`
+	VectorFields  []string `json:"vectorFields,omitempty"`
+	TitleField    string   `json:"titleField,omitempty"`
+	URLField      string   `json:"urlField,omitempty"`
+	FilePathField string   `json:"filePathField,omitempty"`
+}
+
+// DataSourceAuth configures how Azure OpenAI authenticates to a data source.
+// At most one field may be set; if none is, the system-assigned managed identity is used.
+type DataSourceAuth struct {
+	APIKey                    string `json:"apiKey,omitempty"`                    // API key of the data source
+	ConnectionString          string `json:"connectionString,omitempty"`          // Connection string of the data source
+	ManagedIdentityResourceID string `json:"managedIdentityResourceId,omitempty"` // Resource ID of a user-assigned managed identity
+}
+
+// GroundingMetadata holds the citations and intent returned for "On Your Data" requests.
+type GroundingMetadata struct {
+	Intent    string     `json:"intent,omitempty"`    // Detected intent, as a JSON-encoded list of search queries
+	Citations []Citation `json:"citations,omitempty"` // Documents the answer was grounded on
+}
+
+// Citation is a document cited by a grounded response.
+type Citation struct {
+	Content     string   `json:"content,omitempty"`
+	Title       string   `json:"title,omitempty"`
+	URL         string   `json:"url,omitempty"`
+	FilePath    string   `json:"filePath,omitempty"`
+	ChunkID     string   `json:"chunkId,omitempty"`
+	RerankScore *float64 `json:"rerankScore,omitempty"`
+}
+
+// convertDataSources converts data sources to Azure chat extension configurations
+func convertDataSources(sources []DataSource) ([]azopenai.AzureChatExtensionConfigurationClassification, error) {
+	configs := make([]azopenai.AzureChatExtensionConfigurationClassification, 0, len(sources))
+	for i, src := range sources {
+		switch {
+		case src.AzureSearch != nil && src.CosmosDB != nil:
+			return nil, fmt.Errorf("data source %d: only one of azureSearch or cosmosDB may be set", i)
+		case src.AzureSearch != nil:
+			cfg, err := convertAzureSearch(src.AzureSearch)
+			if err != nil {
+				return nil, fmt.Errorf("data source %d: %w", i, err)
+			}
+			configs = append(configs, cfg)
+		case src.CosmosDB != nil:
+			cfg, err := convertCosmosDB(src.CosmosDB)
+			if err != nil {
+				return nil, fmt.Errorf("data source %d: %w", i, err)
+			}
+			configs = append(configs, cfg)
+		default:
+			return nil, fmt.Errorf("data source %d: azureSearch or cosmosDB is required", i)
+		}
+	}
+	return configs, nil
+}
+
+func convertAzureSearch(src *AzureSearchDataSource) (*azopenai.AzureSearchChatExtensionConfiguration, error) {
+	if src.Endpoint == "" || src.IndexName == "" {
+		return nil, errors.New("azure search endpoint and index name are required")
+	}
+	auth, err := convertDataSourceAuth(src.Auth)
+	if err != nil {
+		return nil, err
+	}
+
+	params := &azopenai.AzureSearchChatExtensionParameters{
+		Endpoint:       to.Ptr(src.Endpoint),
+		IndexName:      to.Ptr(src.IndexName),
+		Authentication: auth,
+		TopNDocuments:  src.TopNDocuments,
+		Strictness:     src.Strictness,
+		InScope:        src.InScope,
+	}
+	if src.QueryType != "" {
+		params.QueryType = to.Ptr(azopenai.AzureSearchQueryType(src.QueryType))
+	}
+	if src.SemanticConfiguration != "" {
+		params.SemanticConfiguration = to.Ptr(src.SemanticConfiguration)
+	}
+	if src.Filter != "" {
+		params.Filter = to.Ptr(src.Filter)
+	}
+	if src.EmbeddingDeployment != "" {
+		params.EmbeddingDependency = deploymentVectorization(src.EmbeddingDeployment)
+	}
+	if m := src.FieldsMapping; m != nil {
+		params.FieldsMapping = &azopenai.AzureSearchIndexFieldMappingOptions{
+			ContentFields: m.ContentFields,
+			VectorFields:  m.VectorFields,
+			TitleField:    optionalString(m.TitleField),
+			URLField:      optionalString(m.URLField),
+			FilePathField: optionalString(m.FilePathField),
+		}
+	}
+	return &azopenai.AzureSearchChatExtensionConfiguration{Parameters: params}, nil
+}
+
+func convertCosmosDB(src *CosmosDBDataSource) (*azopenai.AzureCosmosDBChatExtensionConfiguration, error) {
+	if src.DatabaseName == "" || src.ContainerName == "" || src.IndexName == "" {
+		return nil, errors.New("cosmos db database, container and index names are required")
+	}
+	if src.EmbeddingDeployment == "" {
+		return nil, errors.New("cosmos db requires an embedding deployment")
+	}
+	if src.Auth.ConnectionString == "" {
+		return nil, errors.New("cosmos db requires a connection string")
+	}
+	auth, err := convertDataSourceAuth(src.Auth)
+	if err != nil {
+		return nil, err
+	}
+
+	m := src.FieldsMapping
+	return &azopenai.AzureCosmosDBChatExtensionConfiguration{
+		Parameters: &azopenai.AzureCosmosDBChatExtensionParameters{
+			DatabaseName:        to.Ptr(src.DatabaseName),
+			ContainerName:       to.Ptr(src.ContainerName),
+			IndexName:           to.Ptr(src.IndexName),
+			Authentication:      auth,
+			EmbeddingDependency: deploymentVectorization(src.EmbeddingDeployment),
+			TopNDocuments:       src.TopNDocuments,
+			Strictness:          src.Strictness,
+			InScope:             src.InScope,
+			FieldsMapping: &azopenai.AzureCosmosDBFieldMappingOptions{
+				ContentFields: m.ContentFields,
+				VectorFields:  m.VectorFields,
+				TitleField:    optionalString(m.TitleField),
+				URLField:      optionalString(m.URLField),
+				FilePathField: optionalString(m.FilePathField),
+			},
+		},
+	}, nil
+}
+
+// convertDataSourceAuth converts data source authentication to Azure format
+func convertDataSourceAuth(auth DataSourceAuth) (azopenai.OnYourDataAuthenticationOptionsClassification, error) {
+	set := 0
+	for _, v := range []string{auth.APIKey, auth.ConnectionString, auth.ManagedIdentityResourceID} {
+		if v != "" {
+			set++
+		}
+	}
+	if set > 1 {
+		return nil, errors.New("only one data source authentication method may be set")
+	}
+
+	switch {
+	case auth.APIKey != "":
+		return &azopenai.OnYourDataAPIKeyAuthenticationOptions{Key: to.Ptr(auth.APIKey)}, nil
+	case auth.ConnectionString != "":
+		return &azopenai.OnYourDataConnectionStringAuthenticationOptions{ConnectionString: to.Ptr(auth.ConnectionString)}, nil
+	case auth.ManagedIdentityResourceID != "":
+		return &azopenai.OnYourDataUserAssignedManagedIdentityAuthenticationOptions{ManagedIdentityResourceID: to.Ptr(auth.ManagedIdentityResourceID)}, nil
+	default:
+		return &azopenai.OnYourDataSystemAssignedManagedIdentityAuthenticationOptions{}, nil
+	}
+}
+
+func deploymentVectorization(deployment string) *azopenai.OnYourDataDeploymentNameVectorizationSource {
+	return &azopenai.OnYourDataDeploymentNameVectorizationSource{
+		DeploymentName: to.Ptr(deployment),
+		Type:           to.Ptr(azopenai.OnYourDataVectorizationSourceTypeDeploymentName),
+	}
+}
+
+// optionalString returns a pointer to s, or nil if s is empty.
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// addContext merges the "On Your Data" message context into the grounding metadata.
+func (g *GroundingMetadata) addContext(c *azopenai.AzureChatExtensionsMessageContext) {
+	if c == nil {
+		return
+	}
+	if c.Intent != nil {
+		g.Intent = *c.Intent
+	}
+	for _, cit := range c.Citations {
+		g.Citations = append(g.Citations, Citation{
+			Content:     deref(cit.Content),
+			Title:       deref(cit.Title),
+			URL:         deref(cit.URL),
+			FilePath:    deref(cit.FilePath),
+			ChunkID:     deref(cit.ChunkID),
+			RerankScore: cit.RerankScore,
+		})
+	}
+}
+
+// isEmpty reports whether no grounding information was collected.
+func (g *GroundingMetadata) isEmpty() bool {
+	return g == nil || (g.Intent == "" && len(g.Citations) == 0)
+}
@@ -0,0 +1,247 @@
+// Copyright 2025 herosizy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package azopenai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/ai/azopenai"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/firebase/genkit/go/ai"
+)
+
+const groundedChatCompletion = `{
+	"id": "chatcmpl-2",
+	"object": "chat.completion",
+	"created": 1700000000,
+	"model": "gpt-4o",
+	"choices": [{
+		"index": 0,
+		"finish_reason": "stop",
+		"message": {
+			"role": "assistant",
+			"content": "Our return window is 30 days [doc1].",
+			"context": {
+				"intent": "[\"return policy\"]",
+				"citations": [{
+					"content": "Items may be returned within 30 days.",
+					"title": "Returns",
+					"url": "https://contoso.com/returns",
+					"filepath": "returns.md",
+					"chunk_id": "0"
+				}]
+			}
+		}
+	}]
+}`
+
+func TestConvertDataSources(t *testing.T) {
+	tests := []struct {
+		name     string
+		sources  []DataSource
+		hasError bool
+	}{
+		{
+			name: "azure search with api key",
+			sources: []DataSource{{AzureSearch: &AzureSearchDataSource{
+				Endpoint:  "https://search.example.com",
+				IndexName: "docs",
+				QueryType: "vector_semantic_hybrid",
+				Auth:      DataSourceAuth{APIKey: "key"},
+			}}},
+		},
+		{
+			name: "cosmos db",
+			sources: []DataSource{{CosmosDB: &CosmosDBDataSource{
+				DatabaseName:        "db",
+				ContainerName:       "items",
+				IndexName:           "vectors",
+				EmbeddingDeployment: "text-embedding-3-small",
+				FieldsMapping:       DataSourceFieldMap{ContentFields: []string{"content"}, VectorFields: []string{"vector"}},
+				Auth:                DataSourceAuth{ConnectionString: "mongodb://example"},
+			}}},
+		},
+		{
+			name:     "empty data source",
+			sources:  []DataSource{{}},
+			hasError: true,
+		},
+		{
+			name: "both kinds set",
+			sources: []DataSource{{
+				AzureSearch: &AzureSearchDataSource{Endpoint: "https://search.example.com", IndexName: "docs"},
+				CosmosDB:    &CosmosDBDataSource{},
+			}},
+			hasError: true,
+		},
+		{
+			name:     "azure search missing index",
+			sources:  []DataSource{{AzureSearch: &AzureSearchDataSource{Endpoint: "https://search.example.com"}}},
+			hasError: true,
+		},
+		{
+			name: "cosmos db missing connection string",
+			sources: []DataSource{{CosmosDB: &CosmosDBDataSource{
+				DatabaseName: "db", ContainerName: "items", IndexName: "vectors", EmbeddingDeployment: "emb",
+			}}},
+			hasError: true,
+		},
+		{
+			name: "multiple auth methods",
+			sources: []DataSource{{AzureSearch: &AzureSearchDataSource{
+				Endpoint:  "https://search.example.com",
+				IndexName: "docs",
+				Auth:      DataSourceAuth{APIKey: "key", ConnectionString: "conn"},
+			}}},
+			hasError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := convertDataSources(tt.sources)
+			if tt.hasError && err == nil {
+				t.Error("Expected error but got none")
+			}
+			if !tt.hasError {
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				if len(result) != len(tt.sources) {
+					t.Errorf("Expected %d configurations, got %d", len(tt.sources), len(result))
+				}
+			}
+		})
+	}
+}
+
+func TestConvertDataSourceAuth(t *testing.T) {
+	tests := []struct {
+		name     string
+		auth     DataSourceAuth
+		expected string
+	}{
+		{"api key", DataSourceAuth{APIKey: "key"}, "*azopenai.OnYourDataAPIKeyAuthenticationOptions"},
+		{"connection string", DataSourceAuth{ConnectionString: "conn"}, "*azopenai.OnYourDataConnectionStringAuthenticationOptions"},
+		{"user assigned identity", DataSourceAuth{ManagedIdentityResourceID: "/subscriptions/x"}, "*azopenai.OnYourDataUserAssignedManagedIdentityAuthenticationOptions"},
+		{"system assigned identity", DataSourceAuth{}, "*azopenai.OnYourDataSystemAssignedManagedIdentityAuthenticationOptions"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth, err := convertDataSourceAuth(tt.auth)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got := fmt.Sprintf("%T", auth); got != tt.expected {
+				t.Errorf("convertDataSourceAuth() = %s, want %s", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDataSources_EndToEnd(t *testing.T) {
+	var sent map[string]any
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &sent); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, groundedChatCompletion)
+	})
+
+	request := &ai.ModelRequest{
+		Messages: []*ai.Message{ai.NewUserTextMessage("What is the return policy?")},
+	}
+	cfg := OpenAIConfig{
+		DeploymentName: "gpt-4o",
+		DataSources: []DataSource{{AzureSearch: &AzureSearchDataSource{
+			Endpoint:              "https://search.example.com",
+			IndexName:             "policies",
+			QueryType:             "semantic",
+			SemanticConfiguration: "default",
+			Filter:                "category eq 'returns'",
+			TopNDocuments:         to.Ptr(int32(3)),
+			Strictness:            to.Ptr(int32(4)),
+			Auth:                  DataSourceAuth{APIKey: "search-key"},
+		}}},
+	}
+	options, err := convertToAzureOpenAIRequest(context.Background(), "", request, cfg)
+	if err != nil {
+		t.Fatalf("convertToAzureOpenAIRequest() error: %v", err)
+	}
+
+	resp, err := handleNonStreamingRequest(context.Background(), client, options)
+	if err != nil {
+		t.Fatalf("handleNonStreamingRequest() error: %v", err)
+	}
+
+	sources, ok := sent["data_sources"].([]any)
+	if !ok || len(sources) != 1 {
+		t.Fatalf("Expected one data source in request, got %v", sent["data_sources"])
+	}
+	source := sources[0].(map[string]any)
+	if source["type"] != "azure_search" {
+		t.Errorf("Data source type = %v, want azure_search", source["type"])
+	}
+	params := source["parameters"].(map[string]any)
+	if params["index_name"] != "policies" || params["query_type"] != "semantic" || params["filter"] != "category eq 'returns'" {
+		t.Errorf("Unexpected data source parameters: %v", params)
+	}
+	if auth := params["authentication"].(map[string]any); auth["type"] != "api_key" {
+		t.Errorf("Authentication type = %v, want api_key", auth["type"])
+	}
+
+	md := ResponseMetadataFrom(resp)
+	if md == nil || md.Grounding == nil {
+		t.Fatal("Expected grounding metadata")
+	}
+	if md.Grounding.Intent != `["return policy"]` {
+		t.Errorf("Intent = %q", md.Grounding.Intent)
+	}
+	if len(md.Grounding.Citations) != 1 {
+		t.Fatalf("Expected 1 citation, got %d", len(md.Grounding.Citations))
+	}
+	cit := md.Grounding.Citations[0]
+	if cit.Title != "Returns" || cit.URL != "https://contoso.com/returns" || cit.FilePath != "returns.md" {
+		t.Errorf("Unexpected citation: %+v", cit)
+	}
+}
+
+func TestToStreamOptions_DataSources(t *testing.T) {
+	sources, err := convertDataSources([]DataSource{{AzureSearch: &AzureSearchDataSource{
+		Endpoint:  "https://search.example.com",
+		IndexName: "docs",
+	}}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	stream := toStreamOptions(azopenai.ChatCompletionsOptions{AzureExtensionsOptions: sources})
+	if len(stream.AzureExtensionsOptions) != 1 {
+		t.Error("Data sources should be passed through to streaming requests")
+	}
+}
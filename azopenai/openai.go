@@ -26,6 +26,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"slices"
 	"strings"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/ai/azopenai"
@@ -37,15 +38,74 @@ import (
 // OpenAIConfig represents the configuration options for Azure OpenAI models.
 type OpenAIConfig struct {
 	ai.GenerationCommonConfig
-	DeploymentName   string            `json:"deploymentName,omitempty"`   // Azure OpenAI deployment name
-	MaxTokens        *int32            `json:"maxTokens,omitempty"`        // Maximum number of tokens to generate
-	Temperature      *float32          `json:"temperature,omitempty"`      // Controls randomness (0.0 to 2.0)
-	TopP             *float32          `json:"topP,omitempty"`             // Nucleus sampling parameter
-	PresencePenalty  *float32          `json:"presencePenalty,omitempty"`  // Presence penalty (-2.0 to 2.0)
-	FrequencyPenalty *float32          `json:"frequencyPenalty,omitempty"` // Frequency penalty (-2.0 to 2.0)
-	LogitBias        map[string]*int32 `json:"logitBias,omitempty"`        // Logit bias modifications (fixed type)
-	User             string            `json:"user,omitempty"`             // User identifier
-	Seed             *int64            `json:"seed,omitempty"`             // Random seed for deterministic outputs (fixed type)
+	DeploymentName    string             `json:"deploymentName,omitempty"`    // Azure OpenAI deployment name
+	MaxTokens         *int32             `json:"maxTokens,omitempty"`         // Maximum number of tokens to generate
+	Temperature       *float32           `json:"temperature,omitempty"`       // Controls randomness (0.0 to 2.0)
+	TopP              *float32           `json:"topP,omitempty"`              // Nucleus sampling parameter
+	PresencePenalty   *float32           `json:"presencePenalty,omitempty"`   // Presence penalty (-2.0 to 2.0)
+	FrequencyPenalty  *float32           `json:"frequencyPenalty,omitempty"`  // Frequency penalty (-2.0 to 2.0)
+	LogitBias         map[string]*int32  `json:"logitBias,omitempty"`         // Logit bias modifications (fixed type)
+	User              string             `json:"user,omitempty"`              // User identifier
+	Seed              *int64             `json:"seed,omitempty"`              // Random seed for deterministic outputs (fixed type)
+	Truncation        *TruncationConfig  `json:"truncation,omitempty"`        // Opt-in history truncation to fit the context window
+	DataSources       []DataSource       `json:"dataSources,omitempty"`       // "On Your Data" sources used to ground responses
+	NoCache           bool               `json:"noCache,omitempty"`           // Bypass the response cache for this request
+	Responses         *ResponsesConfig   `json:"responses,omitempty"`         // Settings for models served by the Responses API
+	Completions       *CompletionsConfig `json:"completions,omitempty"`       // Settings for instruct models on the legacy completions endpoint
+	ToolChoice        string             `json:"toolChoice,omitempty"`        // "auto", "none", "required" or the name of a tool to call
+	ParallelToolCalls *bool              `json:"parallelToolCalls,omitempty"` // Whether the model may call several tools in one turn
+	StrictTools       bool               `json:"strictTools,omitempty"`       // Enforce tool input schemas with strict mode
+	LogProbs          bool               `json:"logProbs,omitempty"`          // Return the log probability of each output token
+	TopLogProbs       *int32             `json:"topLogProbs,omitempty"`       // Most likely tokens to return per position (0-20), implies LogProbs
+	Prediction        *Prediction        `json:"prediction,omitempty"`        // Expected output, to speed up mostly unchanged rewrites
+	PromptCache       *PromptCacheConfig `json:"promptCache,omitempty"`       // Prompt caching hints
+}
+
+// ResponseMetadata is the plugin-specific metadata stored in ModelResponse.Custom.
+// Use [ResponseMetadataFrom] to read it back from a response.
+type ResponseMetadata struct {
+	ID            string                    `json:"id,omitempty"`            // Response ID assigned by Azure OpenAI
+	Model         string                    `json:"model,omitempty"`         // Model that produced the response
+	ContentFilter *ContentFilterAnnotations `json:"contentFilter,omitempty"` // Content filter results for the prompt and completion
+	Grounding     *GroundingMetadata        `json:"grounding,omitempty"`     // Citations and intent for "On Your Data" requests
+	Cached        bool                      `json:"cached,omitempty"`        // Whether the response was served from a cache
+	SemanticCache *SemanticCacheHit         `json:"semanticCache,omitempty"` // Matched prompt when served from the semantic cache
+	Reasoning     string                    `json:"reasoning,omitempty"`     // Reasoning summary returned by the Responses API
+	LogProbs      []TokenLogProb            `json:"logprobs,omitempty"`      // Per-token log probabilities, when requested
+	Cost          *Cost                     `json:"cost,omitempty"`          // Estimated cost, when the model's price is known, including HedgeUsage
+	Fallback      string                    `json:"fallback,omitempty"`      // Model that served the request in place of the requested one
+	Hedge         string                    `json:"hedge,omitempty"`         // Request that answered when a hedge was sent: "primary" or "hedge"
+	HedgeUsage    *ai.GenerationUsage       `json:"hedgeUsage,omitempty"`    // Usage of the request that lost the hedge, billed on top of Usage
+}
+
+// ResponseMetadataFrom returns the plugin metadata attached to resp, or nil if there is none.
+// It accepts both the typed value set by the plugin and its JSON-decoded map form.
+func ResponseMetadataFrom(resp *ai.ModelResponse) *ResponseMetadata {
+	if resp == nil || resp.Custom == nil {
+		return nil
+	}
+	if md, ok := resp.Custom.(*ResponseMetadata); ok {
+		return md
+	}
+	b, err := json.Marshal(resp.Custom)
+	if err != nil {
+		return nil
+	}
+	var md ResponseMetadata
+	if err := json.Unmarshal(b, &md); err != nil {
+		return nil
+	}
+	return &md
+}
+
+// responseMetadata returns the plugin metadata of response, attaching a new one if needed.
+func responseMetadata(response *ai.ModelResponse) *ResponseMetadata {
+	md := ResponseMetadataFrom(response)
+	if md == nil {
+		md = &ResponseMetadata{}
+	}
+	response.Custom = md
+	return md
 }
 
 // EmbedConfig contains configuration for embedding requests
@@ -54,10 +114,66 @@ type EmbedConfig struct {
 	User           string `json:"user,omitempty"`
 }
 
+// handlerConfig carries plugin-level settings into model and embedder handlers
+type handlerConfig struct {
+	client      Client            // Client for the Azure OpenAI service
+	telemetry   *telemetry        // Instrumentation; defaults to the global providers when nil
+	middleware  []Middleware      // Wrappers around chat and embed handlers, outermost first
+	responses   *responsesBackend // Backend for models served by the Responses API, if any
+	completions []string          // Models served by the legacy completions endpoint besides the built-in instruct models
+	costs       *costEstimator    // Pricing and cost tracking; default prices when nil
+	hedge       *hedger           // Sender of hedged chat requests; requests are not hedged when nil
+	limits      *limiter          // Per-deployment concurrency limits; requests are not limited when nil
+}
+
 // defineModel creates and registers a model with Genkit
-func defineModel(g *genkit.Genkit, client *azopenai.Client, name string, info ai.ModelInfo) ai.Model {
+func defineModel(g *genkit.Genkit, hc handlerConfig, name string, info ai.ModelInfo) ai.Model {
+	client, tel := hc.client, hc.telemetry
+	if tel == nil {
+		tel = newTelemetry(nil)
+	}
+	responses := hc.responses.forModel(name)
+	completions := usesCompletions(name) || slices.Contains(hc.completions, name)
+	hedge := hc.hedge.forModel(name)
+
+	// The innermost handler calls the service; middleware runs around it
+	handler := chainChat(func(ctx context.Context, call *ChatCall) (*ai.ModelResponse, error) {
+		cfg, _ := call.Request.Config.(*OpenAIConfig)
+		ctx, op := tel.startChat(ctx, call.Model, deref(cfg), call.Request)
+		release, err := hc.limits.acquire(ctx, call.Deployment())
+		if err != nil {
+			op.endChat(ctx, nil, err)
+			return nil, err
+		}
+		defer release()
+
+		// Handle Responses API vs legacy completions vs streaming vs non-streaming
+		var resp *ai.ModelResponse
+		switch {
+		case responses != nil:
+			resp, err = responses.generate(ctx, call, op.wrapCallback(call.Callback))
+		case completions:
+			resp, err = handleCompletionsRequest(ctx, client, *call.Completions, op.wrapCallback(call.Callback))
+		case call.Callback != nil:
+			resp, err = handleStreamingRequest(ctx, client, *call.Options, op.wrapCallback(call.Callback))
+		case hedge != nil:
+			resp, err = hedge.generate(ctx, client, *call.Options, op)
+		default:
+			resp, err = handleNonStreamingRequest(ctx, client, *call.Options)
+		}
+		if err == nil {
+			hc.costs.applyCost(ctx, call.Model, call.Deployment(), resp)
+		}
+		op.endChat(ctx, resp, err)
+		return resp, err
+	}, hc.middleware)
+
 	return genkit.DefineModel(g, azureOpenAIProvider, name, &info,
 		func(ctx context.Context, mr *ai.ModelRequest, cb ai.ModelStreamCallback) (*ai.ModelResponse, error) {
+			if client == nil {
+				return nil, errNoClient
+			}
+
 			// Extract config from request
 			var cfg OpenAIConfig
 			if mr.Config != nil {
@@ -68,34 +184,60 @@ func defineModel(g *genkit.Genkit, client *azopenai.Client, name string, info ai
 
 			if cfg.DeploymentName == "" {
 				cfg.DeploymentName = name
-				mr.Config = &cfg
 			}
-
-			// Convert Genkit request to Azure OpenAI format
-			azRequest, err := convertToAzureOpenAIRequest(mr, cfg)
-			if err != nil {
-				return nil, fmt.Errorf("failed to convert request: %w", err)
+			mr.Config = &cfg
+
+			// Convert Genkit request to the format of the model's backend
+			call := &ChatCall{Model: name, Request: mr, Callback: cb}
+			switch {
+			case responses != nil:
+				req, err := convertToResponsesRequest(ctx, name, mr, cfg, cfg.DeploymentName)
+				if err != nil {
+					return nil, fmt.Errorf("failed to convert request: %w", err)
+				}
+				call.Responses = req
+			case completions:
+				options, err := convertToCompletionsRequest(ctx, name, mr, cfg, cfg.DeploymentName)
+				if err != nil {
+					return nil, fmt.Errorf("failed to convert request: %w", err)
+				}
+				call.Completions = &options
+			default:
+				azRequest, err := convertToAzureOpenAIRequest(ctx, name, mr, cfg)
+				if err != nil {
+					return nil, fmt.Errorf("failed to convert request: %w", err)
+				}
+				call.Options = &azRequest
 			}
 
-			// Handle streaming vs non-streaming
-			if cb != nil {
-				return handleStreamingRequest(ctx, client, azRequest, cb)
-			} else {
-				return handleNonStreamingRequest(ctx, client, azRequest)
-			}
+			return handler(ctx, call)
 		})
 }
 
-// convertToAzureOpenAIRequest converts a Genkit ModelRequest to Azure OpenAI format
-func convertToAzureOpenAIRequest(mr *ai.ModelRequest, cfg OpenAIConfig) (azopenai.ChatCompletionsOptions, error) {
-	messages := make([]azopenai.ChatRequestMessageClassification, 0, len(mr.Messages))
+// convertToAzureOpenAIRequest converts a Genkit ModelRequest for model to Azure OpenAI format
+func convertToAzureOpenAIRequest(ctx context.Context, model string, mr *ai.ModelRequest, cfg OpenAIConfig) (azopenai.ChatCompletionsOptions, error) {
+	// Prediction.Message indexes the messages as given, before reordering and truncation
+	prediction, err := convertPrediction(mr, cfg)
+	if err != nil {
+		return azopenai.ChatCompletionsOptions{}, err
+	}
+	mr = cacheFriendlyRequest(mr, cfg)
+	msgs := mr.Messages
+	if cfg.Truncation != nil {
+		msgs, err = truncateMessages(ctx, model, mr.Messages, cfg)
+		if err != nil {
+			return azopenai.ChatCompletionsOptions{}, err
+		}
+	}
+
+	messages := make([]azopenai.ChatRequestMessageClassification, 0, len(msgs))
 
-	for _, msg := range mr.Messages {
-		azMsg, err := convertMessage(msg)
+	for _, msg := range msgs {
+		azMsgs, err := convertMessages(msg)
 		if err != nil {
 			return azopenai.ChatCompletionsOptions{}, err
 		}
-		messages = append(messages, azMsg)
+		messages = append(messages, azMsgs...)
 	}
 
 	deploymentName := cfg.DeploymentName
@@ -133,19 +275,68 @@ func convertToAzureOpenAIRequest(mr *ai.ModelRequest, cfg OpenAIConfig) (azopena
 	if cfg.Seed != nil {
 		options.Seed = cfg.Seed // Now the types match
 	}
+	if cfg.LogProbs || cfg.TopLogProbs != nil {
+		options.LogProbs = to.Ptr(true)
+		options.TopLogProbs = cfg.TopLogProbs
+	}
+
+	options.Prediction = prediction
+
+	if len(cfg.DataSources) > 0 {
+		dataSources, err := convertDataSources(cfg.DataSources)
+		if err != nil {
+			return azopenai.ChatCompletionsOptions{}, err
+		}
+		options.AzureExtensionsOptions = dataSources
+	}
 
 	// Handle tools if present
 	if len(mr.Tools) > 0 {
-		tools, err := convertTools(mr.Tools)
+		tools, err := convertTools(mr.Tools, cfg.StrictTools)
 		if err != nil {
 			return azopenai.ChatCompletionsOptions{}, err
 		}
 		options.Tools = tools
+		options.ParallelToolCalls = cfg.ParallelToolCalls
+	}
+
+	choice, err := resolveToolChoice(mr, cfg)
+	if err != nil {
+		return azopenai.ChatCompletionsOptions{}, err
+	}
+	if len(mr.Tools) > 0 {
+		options.ToolChoice = convertToolChoice(choice)
 	}
 
 	return options, nil
 }
 
+// convertMessages converts a Genkit message to one or more Azure OpenAI messages.
+// A tool message carrying several tool responses becomes one message per response.
+func convertMessages(msg *ai.Message) ([]azopenai.ChatRequestMessageClassification, error) {
+	if msg.Role == ai.RoleTool {
+		var messages []azopenai.ChatRequestMessageClassification
+		for _, part := range msg.Content {
+			if !part.IsToolResponse() {
+				continue
+			}
+			toolMsg, err := convertToolResponse(part.ToolResponse)
+			if err != nil {
+				return nil, err
+			}
+			messages = append(messages, toolMsg)
+		}
+		if len(messages) > 0 {
+			return messages, nil
+		}
+	}
+	azMsg, err := convertMessage(msg)
+	if err != nil {
+		return nil, err
+	}
+	return []azopenai.ChatRequestMessageClassification{azMsg}, nil
+}
+
 // convertMessage converts a Genkit message to Azure OpenAI format
 func convertMessage(msg *ai.Message) (azopenai.ChatRequestMessageClassification, error) {
 	content := extractTextContent(msg.Content)
@@ -160,11 +351,22 @@ func convertMessage(msg *ai.Message) (azopenai.ChatRequestMessageClassification,
 			Content: azopenai.NewChatRequestUserMessageContent(content),
 		}, nil
 	case ai.RoleModel:
-		return &azopenai.ChatRequestAssistantMessage{
-			Content: azopenai.NewChatRequestAssistantMessageContent(content), // Fixed type
-		}, nil
+		toolCalls, err := convertToolRequests(msg)
+		if err != nil {
+			return nil, err
+		}
+		assistant := &azopenai.ChatRequestAssistantMessage{ToolCalls: toolCalls}
+		if content != "" || len(toolCalls) == 0 {
+			assistant.Content = azopenai.NewChatRequestAssistantMessageContent(content) // Fixed type
+		}
+		return assistant, nil
 	case ai.RoleTool:
-		// Tool messages need special handling
+		for _, part := range msg.Content {
+			if part.IsToolResponse() {
+				return convertToolResponse(part.ToolResponse)
+			}
+		}
+		// Without a tool response there is no call ID to link the message to
 		return &azopenai.ChatRequestToolMessage{
 			Content:    azopenai.NewChatRequestToolMessageContent(content), // Fixed type
 			ToolCallID: to.Ptr("tool_call_id"),                             // This should be properly tracked
@@ -186,14 +388,14 @@ func extractTextContent(parts []*ai.Part) string {
 	return strings.Join(textParts, "")
 }
 
-// convertTools converts Genkit tools to Azure OpenAI format
-func convertTools(tools []*ai.ToolDefinition) ([]azopenai.ChatCompletionsToolDefinitionClassification, error) {
+// convertTools converts Genkit tools to Azure OpenAI format.
+// Input schemas are normalized with [normalizeToolSchema].
+func convertTools(tools []*ai.ToolDefinition, strict bool) ([]azopenai.ChatCompletionsToolDefinitionClassification, error) {
 	azTools := make([]azopenai.ChatCompletionsToolDefinitionClassification, len(tools))
 	for i, tool := range tools {
-		// Convert the input schema to JSON bytes
-		parametersBytes, err := json.Marshal(tool.InputSchema)
+		parametersBytes, err := toolParameters(tool, strict)
 		if err != nil {
-			return nil, fmt.Errorf("failed to marshal tool parameters: %w", err)
+			return nil, err
 		}
 
 		azTools[i] = &azopenai.ChatCompletionsFunctionToolDefinition{
@@ -202,6 +404,7 @@ func convertTools(tools []*ai.ToolDefinition) ([]azopenai.ChatCompletionsToolDef
 				Name:        &tool.Name,
 				Description: &tool.Description,
 				Parameters:  parametersBytes, // Fixed type
+				Strict:      to.Ptr(strict),
 			},
 		}
 	}
@@ -209,29 +412,22 @@ func convertTools(tools []*ai.ToolDefinition) ([]azopenai.ChatCompletionsToolDef
 }
 
 // handleStreamingRequest handles streaming chat completions
-func handleStreamingRequest(ctx context.Context, client *azopenai.Client, options azopenai.ChatCompletionsOptions, cb ai.ModelStreamCallback) (*ai.ModelResponse, error) {
-	resp, err := client.GetChatCompletionsStream(ctx, azopenai.ChatCompletionsStreamOptions{
-		Messages:         options.Messages,
-		DeploymentName:   options.DeploymentName,
-		MaxTokens:        options.MaxTokens,
-		Temperature:      options.Temperature,
-		TopP:             options.TopP,
-		PresencePenalty:  options.PresencePenalty,
-		FrequencyPenalty: options.FrequencyPenalty,
-		LogitBias:        options.LogitBias,
-		User:             options.User,
-		Seed:             options.Seed,
-		Tools:            options.Tools,
-		N:                to.Ptr[int32](1),
-	}, nil)
+func handleStreamingRequest(ctx context.Context, client Client, options azopenai.ChatCompletionsOptions, cb ai.ModelStreamCallback) (*ai.ModelResponse, error) {
+	resp, err := client.GetChatCompletionsStream(ctx, toStreamOptions(options), nil)
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to get chat completions stream: %w", err)
+		return nil, fmt.Errorf("failed to get chat completions stream: %w", mapAzureError(err))
 	}
 	defer resp.ChatCompletionsStream.Close()
 
 	var fullContent strings.Builder
 	var finishReason ai.FinishReason
+	filters := &ContentFilterAnnotations{}
+	grounding := &GroundingMetadata{}
+	var id, model string
+	var usage *azopenai.CompletionsUsage
+	var toolCalls toolCallAccumulator
+	var logProbs []TokenLogProb
 
 	for {
 		chatCompletion, err := resp.ChatCompletionsStream.Read()
@@ -239,13 +435,32 @@ func handleStreamingRequest(ctx context.Context, client *azopenai.Client, option
 			break
 		}
 		if err != nil {
-			return nil, fmt.Errorf("failed to read chat completion: %w", err)
+			return nil, fmt.Errorf("failed to read chat completion: %w", mapAzureError(err))
+		}
+
+		if chatCompletion.ID != nil && *chatCompletion.ID != "" {
+			id = *chatCompletion.ID
 		}
+		if chatCompletion.Model != nil && *chatCompletion.Model != "" {
+			model = *chatCompletion.Model
+		}
+		if chatCompletion.Usage != nil {
+			usage = chatCompletion.Usage
+		}
+		filters.addPrompt(chatCompletion.PromptFilterResults)
 
 		for _, choice := range chatCompletion.Choices {
-			if choice.Delta.Content != nil {
+			filters.addChoice(choice.ContentFilterResults)
+			if choice.Delta != nil {
+				grounding.addContext(choice.Delta.Context)
+				toolCalls.add(choice.Delta.ToolCalls)
+			}
+
+			if choice.Delta != nil && choice.Delta.Content != nil {
 				content := *choice.Delta.Content
 				fullContent.WriteString(content)
+				chunkLogProbs := convertChatLogProbs(choice.LogProbs)
+				logProbs = append(logProbs, chunkLogProbs...)
 
 				// Call the streaming callback
 				if cb != nil {
@@ -253,6 +468,9 @@ func handleStreamingRequest(ctx context.Context, client *azopenai.Client, option
 						Content: []*ai.Part{ai.NewTextPart(content)},
 						Role:    ai.RoleModel,
 					}
+					if len(chunkLogProbs) > 0 {
+						chunk.Custom = &ChunkMetadata{LogProbs: chunkLogProbs}
+					}
 					if err := cb(ctx, chunk); err != nil {
 						return nil, fmt.Errorf("streaming callback error: %w", err)
 					}
@@ -265,31 +483,76 @@ func handleStreamingRequest(ctx context.Context, client *azopenai.Client, option
 		}
 	}
 
+	// Tool calls arrive in fragments, so they are streamed once complete
+	toolParts := toolCalls.parts()
+	if cb != nil && len(toolParts) > 0 {
+		if err := cb(ctx, &ai.ModelResponseChunk{Content: toolParts, Role: ai.RoleModel}); err != nil {
+			return nil, fmt.Errorf("streaming callback error: %w", err)
+		}
+	}
+
 	// Return the final response
-	return &ai.ModelResponse{
+	response := &ai.ModelResponse{
 		Message: &ai.Message{ // Fixed structure
-			Content: []*ai.Part{ai.NewTextPart(fullContent.String())},
+			Content: messageContent(fullContent.String(), toolParts),
 			Role:    ai.RoleModel,
 		},
 		FinishReason: finishReason,
-	}, nil
+		Usage:        convertUsage(usage),
+	}
+	applyResponseInfo(response, id, model)
+	applyContentFilter(response, filters)
+	applyGrounding(response, grounding)
+	applyLogProbs(response, logProbs)
+	return response, nil
+}
+
+// toStreamOptions converts chat completions options to their streaming equivalent
+func toStreamOptions(options azopenai.ChatCompletionsOptions) azopenai.ChatCompletionsStreamOptions {
+	return azopenai.ChatCompletionsStreamOptions{
+		Messages:               options.Messages,
+		DeploymentName:         options.DeploymentName,
+		AzureExtensionsOptions: options.AzureExtensionsOptions,
+		MaxTokens:              options.MaxTokens,
+		Temperature:            options.Temperature,
+		TopP:                   options.TopP,
+		PresencePenalty:        options.PresencePenalty,
+		FrequencyPenalty:       options.FrequencyPenalty,
+		LogitBias:              options.LogitBias,
+		User:                   options.User,
+		Seed:                   options.Seed,
+		LogProbs:               options.LogProbs,
+		Prediction:             options.Prediction,
+		TopLogProbs:            options.TopLogProbs,
+		Tools:                  options.Tools,
+		ToolChoice:             options.ToolChoice,
+		ParallelToolCalls:      options.ParallelToolCalls,
+		N:                      to.Ptr[int32](1),
+		StreamOptions:          &azopenai.ChatCompletionStreamOptions{IncludeUsage: to.Ptr(true)},
+	}
 }
 
 // handleNonStreamingRequest handles non-streaming chat completions
-func handleNonStreamingRequest(ctx context.Context, client *azopenai.Client, options azopenai.ChatCompletionsOptions) (*ai.ModelResponse, error) {
+func handleNonStreamingRequest(ctx context.Context, client Client, options azopenai.ChatCompletionsOptions) (*ai.ModelResponse, error) {
 	resp, err := client.GetChatCompletions(ctx, options, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get chat completions: %w", err)
+		return nil, fmt.Errorf("failed to get chat completions: %w", mapAzureError(err))
 	}
+	return convertChatCompletions(resp.ChatCompletions)
+}
 
+// convertChatCompletions converts a complete chat completions response to Genkit format
+func convertChatCompletions(resp azopenai.ChatCompletions) (*ai.ModelResponse, error) {
 	if len(resp.Choices) == 0 {
 		return nil, errors.New("no choices returned from Azure OpenAI")
 	}
 
 	choice := resp.Choices[0]
 	content := ""
-	if choice.Message.Content != nil {
-		content = *choice.Message.Content
+	var toolParts []*ai.Part
+	if choice.Message != nil {
+		content = deref(choice.Message.Content)
+		toolParts = convertToolCalls(choice.Message.ToolCalls)
 	}
 
 	finishReason := ai.FinishReasonStop
@@ -297,13 +560,98 @@ func handleNonStreamingRequest(ctx context.Context, client *azopenai.Client, opt
 		finishReason = convertFinishReason(*choice.FinishReason)
 	}
 
-	return &ai.ModelResponse{
+	filters := &ContentFilterAnnotations{}
+	filters.addPrompt(resp.PromptFilterResults)
+	filters.addChoice(choice.ContentFilterResults)
+	grounding := &GroundingMetadata{}
+	if choice.Message != nil {
+		grounding.addContext(choice.Message.Context)
+	}
+
+	response := &ai.ModelResponse{
 		Message: &ai.Message{ // Fixed structure
-			Content: []*ai.Part{ai.NewTextPart(content)},
+			Content: messageContent(content, toolParts),
 			Role:    ai.RoleModel,
 		},
 		FinishReason: finishReason,
-	}, nil
+		Usage:        convertUsage(resp.Usage),
+	}
+	applyResponseInfo(response, deref(resp.ID), deref(resp.Model))
+	applyContentFilter(response, filters)
+	applyGrounding(response, grounding)
+	applyLogProbs(response, convertChatLogProbs(choice.LogProbs))
+	return response, nil
+}
+
+// convertUsage converts Azure OpenAI token usage to Genkit format
+func convertUsage(usage *azopenai.CompletionsUsage) *ai.GenerationUsage {
+	if usage == nil {
+		return nil
+	}
+	out := &ai.GenerationUsage{
+		InputTokens:  int(deref(usage.PromptTokens)),
+		OutputTokens: int(deref(usage.CompletionTokens)),
+		TotalTokens:  int(deref(usage.TotalTokens)),
+		Custom:       predictionUsage(usage),
+	}
+	if details := usage.PromptTokensDetails; details != nil {
+		out.CachedContentTokens = int(deref(details.CachedTokens))
+		setUsageCustom(out, UsageInputAudioTokens, deref(details.AudioTokens))
+	}
+	if details := usage.CompletionTokensDetails; details != nil {
+		out.ThoughtsTokens = int(deref(details.ReasoningTokens))
+		setUsageCustom(out, UsageOutputAudioTokens, deref(details.AudioTokens))
+	}
+	return out
+}
+
+// setUsageCustom records a nonzero token count in usage.Custom
+func setUsageCustom(usage *ai.GenerationUsage, key string, tokens int32) {
+	if tokens == 0 {
+		return
+	}
+	if usage.Custom == nil {
+		usage.Custom = map[string]float64{}
+	}
+	usage.Custom[key] = float64(tokens)
+}
+
+// applyResponseInfo records the response ID and model in the response metadata.
+func applyResponseInfo(response *ai.ModelResponse, id, model string) {
+	if id == "" && model == "" {
+		return
+	}
+	md := responseMetadata(response)
+	md.ID = id
+	md.Model = model
+}
+
+// applyGrounding attaches "On Your Data" citations and intent to the response.
+func applyGrounding(response *ai.ModelResponse, grounding *GroundingMetadata) {
+	if grounding.isEmpty() {
+		return
+	}
+	responseMetadata(response).Grounding = grounding
+}
+
+// applyLogProbs attaches per-token log probabilities to the response.
+func applyLogProbs(response *ai.ModelResponse, logProbs []TokenLogProb) {
+	if len(logProbs) == 0 {
+		return
+	}
+	responseMetadata(response).LogProbs = logProbs
+}
+
+// applyContentFilter attaches content filter annotations to the response
+// and explains the block in FinishMessage when the completion was filtered.
+func applyContentFilter(response *ai.ModelResponse, filters *ContentFilterAnnotations) {
+	if filters.isEmpty() {
+		return
+	}
+	responseMetadata(response).ContentFilter = filters
+	if response.FinishReason == ai.FinishReasonBlocked {
+		response.FinishMessage = filters.blockedMessage()
+	}
 }
 
 // convertFinishReason converts Azure OpenAI finish reason to Genkit format
@@ -316,15 +664,60 @@ func convertFinishReason(reason azopenai.CompletionsFinishReason) ai.FinishReaso
 	case azopenai.CompletionsFinishReasonContentFiltered:
 		return ai.FinishReasonBlocked
 	case azopenai.CompletionsFinishReasonToolCalls:
-		return ai.FinishReasonStop // TODO: Handle tool calls properly
+		return ai.FinishReasonStop // Tool calls are returned as tool request parts
 	default:
 		return ai.FinishReasonOther
 	}
 }
 
 // defineEmbedder creates a new embedder for the specified embedding model
-func defineEmbedder(g *genkit.Genkit, client *azopenai.Client, name string) ai.Embedder {
+func defineEmbedder(g *genkit.Genkit, hc handlerConfig, name string) ai.Embedder {
+	client, tel := hc.client, hc.telemetry
+	if tel == nil {
+		tel = newTelemetry(nil)
+	}
+
+	// The innermost handler calls the service; middleware runs around it
+	handler := chainEmbed(func(ctx context.Context, call *EmbedCall) (*ai.EmbedResponse, error) {
+		ctx, op := tel.startEmbeddings(ctx, call.Model, deref(call.Options.DeploymentName))
+		release, err := hc.limits.acquire(ctx, deref(call.Options.DeploymentName))
+		if err != nil {
+			op.endEmbeddings(ctx, 0, err)
+			return nil, err
+		}
+		defer release()
+		resp, err := client.GetEmbeddings(ctx, *call.Options, nil)
+		if err != nil {
+			err = fmt.Errorf("failed to get embeddings from Azure OpenAI: %w", mapAzureError(err))
+			op.endEmbeddings(ctx, 0, err)
+			return nil, err
+		}
+		var inputTokens int
+		if resp.Usage != nil {
+			inputTokens = int(deref(resp.Usage.PromptTokens))
+		}
+		op.endEmbeddings(ctx, inputTokens, nil)
+
+		// Convert Azure OpenAI response to Genkit format
+		var embeddings []*ai.Embedding
+		for _, item := range resp.Data {
+			embeddings = append(embeddings, &ai.Embedding{
+				Embedding: item.Embedding,
+			})
+		}
+
+		embedResp := &ai.EmbedResponse{
+			Embeddings: embeddings,
+		}
+		hc.costs.applyEmbedCost(ctx, call.Model, deref(call.Options.DeploymentName), call.Options.Input, inputTokens, embedResp)
+		return embedResp, nil
+	}, hc.middleware)
+
 	return genkit.DefineEmbedder(g, azureOpenAIProvider, name, func(ctx context.Context, req *ai.EmbedRequest) (*ai.EmbedResponse, error) {
+		if client == nil {
+			return nil, errNoClient
+		}
+
 		// Extract configuration from request options
 		var config *EmbedConfig
 		if opts, ok := req.Options.(*EmbedConfig); ok {
@@ -365,21 +758,6 @@ func defineEmbedder(g *genkit.Genkit, client *azopenai.Client, name string) ai.E
 			body.User = to.Ptr(config.User)
 		}
 
-		resp, err := client.GetEmbeddings(ctx, body, nil)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get embeddings from Azure OpenAI: %w", err)
-		}
-
-		// Convert Azure OpenAI response to Genkit format
-		var embeddings []*ai.Embedding
-		for _, item := range resp.Data {
-			embeddings = append(embeddings, &ai.Embedding{
-				Embedding: item.Embedding,
-			})
-		}
-
-		return &ai.EmbedResponse{
-			Embeddings: embeddings,
-		}, nil
+		return handler(ctx, &EmbedCall{Model: name, Request: req, Options: &body})
 	})
 }
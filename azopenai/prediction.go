@@ -0,0 +1,100 @@
+// Copyright 2025 herosizy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package azopenai
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/ai/azopenai"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/firebase/genkit/go/ai"
+)
+
+// Prediction is the expected output of a request, such as the current version of a
+// file being rewritten. Tokens matching the prediction are returned much faster.
+// Set either Content or Message, which takes the prediction from a request message.
+type Prediction struct {
+	Content string `json:"content,omitempty"` // Static predicted content
+	Message *int   `json:"message,omitempty"` // Index of the request message holding the prediction; negative values count from the end
+	Part    int    `json:"part,omitempty"`    // Index of the text part within that message
+}
+
+// Usage.Custom keys for predicted output token counts
+const (
+	UsageAcceptedPredictionTokens = "acceptedPredictionTokens" // Predicted tokens that appeared in the completion
+	UsageRejectedPredictionTokens = "rejectedPredictionTokens" // Predicted tokens that did not, still billed as output
+)
+
+// convertPrediction resolves the prediction of a request to Azure OpenAI format.
+// Predicted outputs cannot be combined with tools, log probabilities or penalties.
+func convertPrediction(mr *ai.ModelRequest, cfg OpenAIConfig) (*azopenai.PredictionContent, error) {
+	p := cfg.Prediction
+	if p == nil {
+		return nil, nil
+	}
+	switch {
+	case len(mr.Tools) > 0:
+		return nil, errors.New("prediction: tools are not supported with predicted outputs")
+	case cfg.LogProbs || cfg.TopLogProbs != nil:
+		return nil, errors.New("prediction: log probabilities are not supported with predicted outputs")
+	case deref(cfg.PresencePenalty) > 0 || deref(cfg.FrequencyPenalty) > 0:
+		return nil, errors.New("prediction: positive presence or frequency penalties are not supported with predicted outputs")
+	}
+
+	content := p.Content
+	if p.Message != nil {
+		if content != "" {
+			return nil, errors.New("prediction: set either content or message, not both")
+		}
+		i := *p.Message
+		if i < 0 {
+			i += len(mr.Messages)
+		}
+		if i < 0 || i >= len(mr.Messages) {
+			return nil, fmt.Errorf("prediction: message %d out of range", *p.Message)
+		}
+		parts := mr.Messages[i].Content
+		if p.Part < 0 || p.Part >= len(parts) || !parts[p.Part].IsText() {
+			return nil, fmt.Errorf("prediction: message %d has no text part %d", *p.Message, p.Part)
+		}
+		content = parts[p.Part].Text
+	}
+	if content == "" {
+		return nil, errors.New("prediction: content is empty")
+	}
+	return &azopenai.PredictionContent{
+		Type:    to.Ptr("content"),
+		Content: azopenai.NewPredictionContentContent(content),
+	}, nil
+}
+
+// predictionUsage returns the predicted output token counts of usage for Usage.Custom
+func predictionUsage(usage *azopenai.CompletionsUsage) map[string]float64 {
+	details := usage.CompletionTokensDetails
+	if details == nil || (details.AcceptedPredictionTokens == nil && details.RejectedPredictionTokens == nil) {
+		return nil
+	}
+	return map[string]float64{
+		UsageAcceptedPredictionTokens: float64(deref(details.AcceptedPredictionTokens)),
+		UsageRejectedPredictionTokens: float64(deref(details.RejectedPredictionTokens)),
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright 2025 herosizy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package azopenai
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/HeroSizy/genkit-go-plugins/azopenai/azopenaitest"
+	"github.com/firebase/genkit/go/ai"
+)
+
+func TestConvertPrediction(t *testing.T) {
+	messages := []*ai.Message{
+		ai.NewSystemTextMessage("Rename the variable x to count."),
+		ai.NewUserMessage(ai.NewTextPart("Here is the file:"), ai.NewTextPart("x := 0\nx++\n")),
+	}
+	tests := []struct {
+		name       string
+		prediction *Prediction
+		tools      []*ai.ToolDefinition
+		logProbs   bool
+		want       string
+		errMsg     string
+	}{
+		{name: "none"},
+		{name: "static content", prediction: &Prediction{Content: "x := 0"}, want: "x := 0"},
+		{name: "message part", prediction: &Prediction{Message: to.Ptr(1), Part: 1}, want: "x := 0\nx++\n"},
+		{name: "last message", prediction: &Prediction{Message: to.Ptr(-1), Part: 1}, want: "x := 0\nx++\n"},
+		{name: "both", prediction: &Prediction{Content: "a", Message: to.Ptr(0)}, errMsg: "either content or message"},
+		{name: "message out of range", prediction: &Prediction{Message: to.Ptr(2)}, errMsg: "message 2 out of range"},
+		{name: "missing part", prediction: &Prediction{Message: to.Ptr(0), Part: 1}, errMsg: "no text part 1"},
+		{name: "empty", prediction: &Prediction{}, errMsg: "content is empty"},
+		{name: "with tools", prediction: &Prediction{Content: "a"}, tools: []*ai.ToolDefinition{weatherTool()}, errMsg: "tools are not supported"},
+		{name: "with log probabilities", prediction: &Prediction{Content: "a"}, logProbs: true, errMsg: "log probabilities are not supported"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mr := &ai.ModelRequest{Messages: messages, Tools: tt.tools}
+			got, err := convertPrediction(mr, OpenAIConfig{Prediction: tt.prediction, LogProbs: tt.logProbs})
+			if tt.errMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+					t.Errorf("Expected error containing %q, got %v", tt.errMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if tt.want == "" {
+				if got != nil {
+					t.Errorf("Expected no prediction, got %+v", got)
+				}
+				return
+			}
+			b, _ := json.Marshal(got)
+			want, _ := json.Marshal(map[string]any{"content": tt.want, "type": "content"})
+			if string(b) != string(want) {
+				t.Errorf("convertPrediction() = %s, want %s", b, want)
+			}
+		})
+	}
+}
+
+func TestConvertToAzureOpenAIRequest_PredictionStablePrefix(t *testing.T) {
+	mr := &ai.ModelRequest{Messages: []*ai.Message{
+		ai.NewUserTextMessage("x := 0"),
+		ai.NewSystemTextMessage("Rename the variable x to count."),
+	}}
+	cfg := OpenAIConfig{
+		DeploymentName: "chat",
+		Prediction:     &Prediction{Message: to.Ptr(0)},
+		PromptCache:    &PromptCacheConfig{StablePrefix: true},
+	}
+	options, err := convertToAzureOpenAIRequest(context.Background(), "", mr, cfg)
+	if err != nil {
+		t.Fatalf("convertToAzureOpenAIRequest() error: %v", err)
+	}
+	b, _ := json.Marshal(options.Prediction)
+	if !strings.Contains(string(b), `"x := 0"`) {
+		t.Errorf("Prediction should come from the message as given, got %s", b)
+	}
+}
+
+func TestFakeServer_Prediction(t *testing.T) {
+	g, srv := initWithFakeServer(t)
+	usage := &azopenaitest.Usage{PromptTokens: 20, CompletionTokens: 12, AcceptedPredictionTokens: 9, RejectedPredictionTokens: 2}
+	srv.QueueChat(
+		azopenaitest.ChatReply{Content: "count := 0\ncount++\n", Usage: usage},
+		azopenaitest.ChatReply{Chunks: []string{"count := 0\n", "count++\n"}, Usage: usage},
+	)
+
+	for _, stream := range []bool{false, true} {
+		req := helloRequest()
+		req.Config = &OpenAIConfig{DeploymentName: "chat", Prediction: &Prediction{Content: "x := 0\nx++\n"}}
+		var cb ai.ModelStreamCallback
+		if stream {
+			cb = func(context.Context, *ai.ModelResponseChunk) error { return nil }
+		}
+		resp, err := Model(g, Gpt4o).Generate(context.Background(), req, cb)
+		if err != nil {
+			t.Fatalf("Generate(stream=%v) error: %v", stream, err)
+		}
+		if u := resp.Usage; u == nil || u.Custom[UsageAcceptedPredictionTokens] != 9 || u.Custom[UsageRejectedPredictionTokens] != 2 {
+			t.Errorf("stream=%v: unexpected usage %+v", stream, resp.Usage)
+		}
+	}
+
+	for i, req := range srv.Requests() {
+		prediction, _ := req.JSON()["prediction"].(map[string]any)
+		if prediction["type"] != "content" || prediction["content"] != "x := 0\nx++\n" {
+			t.Errorf("Request %d: unexpected prediction %v", i, req.JSON()["prediction"])
+		}
+	}
+}
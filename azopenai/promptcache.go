@@ -0,0 +1,66 @@
+// Copyright 2025 herosizy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package azopenai
+
+import (
+	"cmp"
+	"slices"
+
+	"github.com/firebase/genkit/go/ai"
+)
+
+// PromptCacheConfig tunes requests for Azure OpenAI prompt caching, which reuses
+// the processing of a prompt prefix shared with recent requests. Cached prompt
+// tokens are reported in Usage.CachedContentTokens whether or not it is set.
+type PromptCacheConfig struct {
+	// Key groups requests that share a long prefix so they are routed to the same
+	// cache. It is sent as prompt_cache_key by models using the Responses API;
+	// the chat completions API version used by the Azure SDK does not accept it.
+	Key string `json:"key,omitempty"`
+	// StablePrefix moves system messages ahead of the conversation and sorts tools
+	// by name, so that requests differing only in recent turns share a prefix.
+	StablePrefix bool `json:"stablePrefix,omitempty"`
+}
+
+// cacheFriendlyRequest returns mr reordered for prompt caching when the config asks
+// for a stable prefix: system messages first, in their original order, then the
+// remaining messages, with tools sorted by name. mr itself is not modified.
+func cacheFriendlyRequest(mr *ai.ModelRequest, cfg OpenAIConfig) *ai.ModelRequest {
+	if cfg.PromptCache == nil || !cfg.PromptCache.StablePrefix {
+		return mr
+	}
+	out := *mr
+	out.Messages = make([]*ai.Message, 0, len(mr.Messages))
+	for _, msg := range mr.Messages {
+		if msg.Role == ai.RoleSystem {
+			out.Messages = append(out.Messages, msg)
+		}
+	}
+	for _, msg := range mr.Messages {
+		if msg.Role != ai.RoleSystem {
+			out.Messages = append(out.Messages, msg)
+		}
+	}
+	out.Tools = slices.SortedStableFunc(slices.Values(mr.Tools), func(a, b *ai.ToolDefinition) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+	return &out
+}
@@ -0,0 +1,111 @@
+// Copyright 2025 herosizy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package azopenai
+
+import (
+	"context"
+	"testing"
+
+	"github.com/HeroSizy/genkit-go-plugins/azopenai/azopenaitest"
+	"github.com/firebase/genkit/go/ai"
+)
+
+func TestCacheFriendlyRequest(t *testing.T) {
+	mr := &ai.ModelRequest{
+		Messages: []*ai.Message{
+			ai.NewUserTextMessage("Hi"),
+			ai.NewSystemTextMessage("You are helpful."),
+			ai.NewModelTextMessage("Hello"),
+			ai.NewSystemTextMessage("Answer briefly."),
+		},
+		Tools: []*ai.ToolDefinition{{Name: "weather"}, {Name: "calendar"}},
+	}
+
+	tests := []struct {
+		name      string
+		config    *PromptCacheConfig
+		wantTexts []string
+		wantTools []string
+	}{
+		{name: "unset", wantTexts: []string{"Hi", "You are helpful.", "Hello", "Answer briefly."}, wantTools: []string{"weather", "calendar"}},
+		{name: "key only", config: &PromptCacheConfig{Key: "flow"}, wantTexts: []string{"Hi", "You are helpful.", "Hello", "Answer briefly."}, wantTools: []string{"weather", "calendar"}},
+		{name: "stable prefix", config: &PromptCacheConfig{StablePrefix: true}, wantTexts: []string{"You are helpful.", "Answer briefly.", "Hi", "Hello"}, wantTools: []string{"calendar", "weather"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := cacheFriendlyRequest(mr, OpenAIConfig{PromptCache: tt.config})
+			for i, msg := range got.Messages {
+				if msg.Text() != tt.wantTexts[i] {
+					t.Errorf("Message %d = %q, want %q", i, msg.Text(), tt.wantTexts[i])
+				}
+			}
+			for i, tool := range got.Tools {
+				if tool.Name != tt.wantTools[i] {
+					t.Errorf("Tool %d = %q, want %q", i, tool.Name, tt.wantTools[i])
+				}
+			}
+		})
+	}
+	if mr.Messages[0].Text() != "Hi" || mr.Tools[0].Name != "weather" {
+		t.Error("cacheFriendlyRequest modified the original request")
+	}
+}
+
+func TestFakeServer_CachedTokens(t *testing.T) {
+	g, srv := initWithFakeServer(t)
+	usage := &azopenaitest.Usage{PromptTokens: 2048, CompletionTokens: 5, CachedTokens: 1920}
+	srv.QueueChat(azopenaitest.ChatReply{Content: "Hi", Usage: usage}, azopenaitest.ChatReply{Chunks: []string{"Hi"}, Usage: usage})
+
+	for _, stream := range []bool{false, true} {
+		var cb ai.ModelStreamCallback
+		if stream {
+			cb = func(context.Context, *ai.ModelResponseChunk) error { return nil }
+		}
+		resp, err := Model(g, Gpt4o).Generate(context.Background(), helloRequest(), cb)
+		if err != nil {
+			t.Fatalf("Generate(stream=%v) error: %v", stream, err)
+		}
+		if resp.Usage == nil || resp.Usage.CachedContentTokens != 1920 {
+			t.Errorf("stream=%v: unexpected usage %+v", stream, resp.Usage)
+		}
+	}
+}
+
+func TestResponses_PromptCacheKey(t *testing.T) {
+	g, srv := initPlugin(t, useResponses)
+	srv.QueueResponse(azopenaitest.ChatReply{Content: "Hi", Usage: &azopenaitest.Usage{PromptTokens: 1500, CompletionTokens: 1, CachedTokens: 1024}})
+
+	req := &ai.ModelRequest{
+		Messages: []*ai.Message{ai.NewUserTextMessage("Hello")},
+		Config:   &OpenAIConfig{PromptCache: &PromptCacheConfig{Key: "support-flow"}},
+	}
+	resp, err := Model(g, Gpt4o).Generate(context.Background(), req, nil)
+	if err != nil {
+		t.Fatalf("Generate() error: %v", err)
+	}
+	if got := srv.Requests()[0].JSON()["prompt_cache_key"]; got != "support-flow" {
+		t.Errorf("prompt_cache_key = %v, want support-flow", got)
+	}
+	if resp.Usage == nil || resp.Usage.CachedContentTokens != 1024 {
+		t.Errorf("Unexpected usage %+v", resp.Usage)
+	}
+}
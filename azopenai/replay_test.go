@@ -0,0 +1,118 @@
+// Copyright 2025 herosizy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package azopenai
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/HeroSizy/genkit-go-plugins/azopenai/cassette"
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+)
+
+// initWithCassette initializes the plugin against a recorded cassette in testdata/cassettes
+func initWithCassette(t *testing.T, name string) *genkit.Genkit {
+	t.Helper()
+	ctx := context.Background()
+	g, err := genkit.Init(ctx)
+	if err != nil {
+		t.Fatalf("Failed to initialize Genkit: %v", err)
+	}
+	plugin := &AzureOpenAI{
+		APIKey:    "test-key",
+		Endpoint:  "https://test.openai.azure.com/",
+		Transport: cassette.Start(t, "testdata/cassettes/"+name+".json", nil),
+	}
+	if err := plugin.Init(ctx, g); err != nil {
+		t.Fatalf("Failed to initialize plugin: %v", err)
+	}
+	return g
+}
+
+func capitalRequest() *ai.ModelRequest {
+	return &ai.ModelRequest{
+		Messages: []*ai.Message{ai.NewUserTextMessage("What is the capital of France?")},
+		Config:   &OpenAIConfig{DeploymentName: "gpt-4o"},
+	}
+}
+
+func TestReplay_Chat(t *testing.T) {
+	g := initWithCassette(t, "chat")
+
+	resp, err := Model(g, Gpt4o).Generate(context.Background(), capitalRequest(), nil)
+	if err != nil {
+		t.Fatalf("Generate() error: %v", err)
+	}
+	if got := resp.Text(); got != "Paris is the capital of France." {
+		t.Errorf("Text() = %q", got)
+	}
+	if resp.FinishReason != ai.FinishReasonStop {
+		t.Errorf("FinishReason = %q, want %q", resp.FinishReason, ai.FinishReasonStop)
+	}
+	if resp.Usage == nil || resp.Usage.TotalTokens != 21 {
+		t.Errorf("Unexpected usage %+v", resp.Usage)
+	}
+	if md := ResponseMetadataFrom(resp); md == nil || md.ID != "chatcmpl-rec1" {
+		t.Errorf("Unexpected metadata %+v", md)
+	}
+}
+
+func TestReplay_ChatStreaming(t *testing.T) {
+	g := initWithCassette(t, "chat_streaming")
+
+	var chunks []string
+	resp, err := Model(g, Gpt4o).Generate(context.Background(), capitalRequest(), func(ctx context.Context, chunk *ai.ModelResponseChunk) error {
+		chunks = append(chunks, chunk.Text())
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Generate() error: %v", err)
+	}
+	if got := strings.Join(chunks, ""); got != "Paris is the capital." {
+		t.Errorf("Streamed text = %q", got)
+	}
+	if got := resp.Text(); got != "Paris is the capital." {
+		t.Errorf("Text() = %q", got)
+	}
+	if resp.Usage == nil || resp.Usage.OutputTokens != 5 {
+		t.Errorf("Unexpected usage %+v", resp.Usage)
+	}
+	md := ResponseMetadataFrom(resp)
+	if md == nil || md.ContentFilter == nil || md.ContentFilter.Prompt["hate"].Severity != "safe" {
+		t.Errorf("Expected prompt filter results in metadata, got %+v", md)
+	}
+}
+
+func TestReplay_Embeddings(t *testing.T) {
+	g := initWithCassette(t, "embeddings")
+
+	resp, err := Embedder(g, TextEmbedding3Small).Embed(context.Background(), &ai.EmbedRequest{
+		Input: []*ai.Document{ai.DocumentFromText("hello world", nil)},
+	})
+	if err != nil {
+		t.Fatalf("Embed() error: %v", err)
+	}
+	if len(resp.Embeddings) != 1 || len(resp.Embeddings[0].Embedding) != 3 {
+		t.Errorf("Unexpected embeddings %+v", resp.Embeddings)
+	}
+}
@@ -0,0 +1,626 @@
+// Copyright 2025 herosizy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package azopenai
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/streaming"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/firebase/genkit/go/ai"
+)
+
+const (
+	responsesAPIVersion          = "2025-04-01-preview"
+	defaultResponsesPollInterval = 2 * time.Second
+)
+
+// ResponsesOptions routes chat models through the Responses API instead of
+// chat completions.
+type ResponsesOptions struct {
+	Models       []string        // Models served by the Responses API, including ones added with DefineModel
+	Client       ResponsesClient // Client for the Responses API. If nil, one is built from APIKey, Endpoint and Transport.
+	PollInterval time.Duration   // Interval between status checks of background responses. Defaults to 2s.
+}
+
+// ResponsesConfig holds per-request Responses API settings. It is ignored by
+// models that use chat completions.
+type ResponsesConfig struct {
+	PreviousResponseID string           `json:"previousResponseId,omitempty"` // Continue from a stored response; only messages after the last model turn are sent
+	Store              *bool            `json:"store,omitempty"`              // Whether the service stores the response for later chaining
+	Background         bool             `json:"background,omitempty"`         // Run asynchronously and poll until the response finishes
+	ReasoningEffort    string           `json:"reasoningEffort,omitempty"`    // "low", "medium" or "high" for reasoning models
+	ReasoningSummary   string           `json:"reasoningSummary,omitempty"`   // "auto", "concise" or "detailed"
+	Tools              []map[string]any `json:"tools,omitempty"`              // Built-in tools, e.g. {"type": "web_search_preview"}
+}
+
+// ResponsesClient sends requests to the Responses API. Bodies are the JSON
+// documents of the REST API; errors for non-2xx replies should be
+// [*azcore.ResponseError] so they are mapped to the plugin's error types.
+type ResponsesClient interface {
+	CreateResponse(ctx context.Context, body []byte) ([]byte, error)
+	CreateResponseStream(ctx context.Context, body []byte) (io.ReadCloser, error) // Server-sent events
+	GetResponse(ctx context.Context, id string) ([]byte, error)
+}
+
+// responsesBackend serves the models routed to the Responses API
+type responsesBackend struct {
+	client       ResponsesClient
+	models       []string
+	pollInterval time.Duration
+}
+
+func newResponsesBackend(opts ResponsesOptions, client ResponsesClient) *responsesBackend {
+	interval := opts.PollInterval
+	if interval <= 0 {
+		interval = defaultResponsesPollInterval
+	}
+	return &responsesBackend{client: client, models: opts.Models, pollInterval: interval}
+}
+
+// forModel returns the backend if the named model uses the Responses API
+func (b *responsesBackend) forModel(name string) *responsesBackend {
+	if b == nil || !slices.Contains(b.models, name) {
+		return nil
+	}
+	return b
+}
+
+// generate runs a chat call against the Responses API
+func (b *responsesBackend) generate(ctx context.Context, call *ChatCall, cb ai.ModelStreamCallback) (*ai.ModelResponse, error) {
+	req := *call.Responses // Copied so streaming does not change the caller's request
+	if cb != nil && !req.Background {
+		req.Stream = true
+		body, err := json.Marshal(req)
+		if err != nil {
+			return nil, err
+		}
+		stream, err := b.client.CreateResponseStream(ctx, body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create response stream: %w", mapAzureError(err))
+		}
+		defer stream.Close()
+		return readResponsesStream(ctx, stream, cb)
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	data, err := b.client.CreateResponse(ctx, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create response: %w", mapAzureError(err))
+	}
+	var resp responsesResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if req.Background {
+		if resp, err = b.wait(ctx, resp); err != nil {
+			return nil, err
+		}
+	}
+	response, err := convertResponse(&resp)
+	if err != nil {
+		return nil, err
+	}
+	if cb != nil {
+		// Background responses cannot be streamed, so the result is sent as one chunk
+		chunk := &ai.ModelResponseChunk{Content: response.Message.Content, Role: ai.RoleModel}
+		if err := cb(ctx, chunk); err != nil {
+			return nil, fmt.Errorf("streaming callback error: %w", err)
+		}
+	}
+	return response, nil
+}
+
+// wait polls a background response until it leaves the queued and in-progress states
+func (b *responsesBackend) wait(ctx context.Context, resp responsesResponse) (responsesResponse, error) {
+	for resp.Status == "queued" || resp.Status == "in_progress" {
+		select {
+		case <-ctx.Done():
+			return resp, ctx.Err()
+		case <-time.After(b.pollInterval):
+		}
+		data, err := b.client.GetResponse(ctx, resp.ID)
+		if err != nil {
+			return resp, fmt.Errorf("failed to get response %s: %w", resp.ID, mapAzureError(err))
+		}
+		resp = responsesResponse{}
+		if err := json.Unmarshal(data, &resp); err != nil {
+			return resp, fmt.Errorf("failed to decode response: %w", err)
+		}
+	}
+	return resp, nil
+}
+
+// ResponsesRequest is the body of a create response request, as sent to the
+// Responses API. Input and Tools hold the input items and tools of the REST API.
+type ResponsesRequest struct {
+	Model              string              `json:"model"`
+	Input              []any               `json:"input"`
+	Tools              []any               `json:"tools,omitempty"`
+	MaxOutputTokens    *int32              `json:"max_output_tokens,omitempty"`
+	Temperature        *float32            `json:"temperature,omitempty"`
+	TopP               *float32            `json:"top_p,omitempty"`
+	User               string              `json:"user,omitempty"`
+	Store              *bool               `json:"store,omitempty"`
+	PreviousResponseID string              `json:"previous_response_id,omitempty"`
+	Background         bool                `json:"background,omitempty"`
+	Stream             bool                `json:"stream,omitempty"`
+	Reasoning          *ResponsesReasoning `json:"reasoning,omitempty"`
+	ToolChoice         any                 `json:"tool_choice,omitempty"`
+	ParallelToolCalls  *bool               `json:"parallel_tool_calls,omitempty"`
+	PromptCacheKey     string              `json:"prompt_cache_key,omitempty"`
+}
+
+// ResponsesReasoning configures reasoning for reasoning models.
+type ResponsesReasoning struct {
+	Effort  string `json:"effort,omitempty"`
+	Summary string `json:"summary,omitempty"`
+}
+
+type responsesMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type responsesFunctionCall struct {
+	Type      string `json:"type"`
+	CallID    string `json:"call_id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+type responsesFunctionOutput struct {
+	Type   string `json:"type"`
+	CallID string `json:"call_id"`
+	Output string `json:"output"`
+}
+
+type responsesTool struct {
+	Type        string `json:"type"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Parameters  any    `json:"parameters,omitempty"`
+	Strict      bool   `json:"strict"`
+}
+
+// responsesResponse is a response object returned by the Responses API
+type responsesResponse struct {
+	ID                string                `json:"id"`
+	Model             string                `json:"model"`
+	Status            string                `json:"status"`
+	Output            []responsesOutputItem `json:"output"`
+	Usage             *responsesUsage       `json:"usage"`
+	Error             *responsesError       `json:"error"`
+	IncompleteDetails *struct {
+		Reason string `json:"reason"`
+	} `json:"incomplete_details"`
+}
+
+type responsesOutputItem struct {
+	Type      string             `json:"type"`
+	Content   []responsesContent `json:"content"`
+	Summary   []responsesContent `json:"summary"`
+	CallID    string             `json:"call_id"`
+	Name      string             `json:"name"`
+	Arguments string             `json:"arguments"`
+}
+
+type responsesContent struct {
+	Type    string `json:"type"`
+	Text    string `json:"text"`
+	Refusal string `json:"refusal"`
+}
+
+type responsesUsage struct {
+	InputTokens        int `json:"input_tokens"`
+	OutputTokens       int `json:"output_tokens"`
+	TotalTokens        int `json:"total_tokens"`
+	InputTokensDetails *struct {
+		CachedTokens int `json:"cached_tokens"`
+	} `json:"input_tokens_details"`
+	OutputTokensDetails *struct {
+		ReasoningTokens int `json:"reasoning_tokens"`
+	} `json:"output_tokens_details"`
+}
+
+type responsesError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// responsesEvent is a server-sent event of a streaming response
+type responsesEvent struct {
+	Type     string               `json:"type"`
+	Delta    string               `json:"delta"`
+	Item     *responsesOutputItem `json:"item"`
+	Response *responsesResponse   `json:"response"`
+	Code     string               `json:"code"`
+	Message  string               `json:"message"`
+}
+
+// convertToResponsesRequest converts a Genkit ModelRequest for model to a Responses API request
+func convertToResponsesRequest(ctx context.Context, model string, mr *ai.ModelRequest, cfg OpenAIConfig, deployment string) (*ResponsesRequest, error) {
+	if deployment == "" {
+		return nil, errors.New("deployment name is required")
+	}
+	if len(cfg.DataSources) > 0 {
+		return nil, errors.New("data sources are not supported by the Responses API")
+	}
+	if cfg.Prediction != nil {
+		return nil, errors.New("predicted outputs are not supported by the Responses API")
+	}
+	if cfg.LogProbs || cfg.TopLogProbs != nil {
+		return nil, errors.New("log probabilities are not supported by the Responses API")
+	}
+	rc := deref(cfg.Responses)
+	mr = cacheFriendlyRequest(mr, cfg)
+
+	msgs := mr.Messages
+	switch {
+	case rc.PreviousResponseID != "":
+		// Earlier turns are already part of the stored response
+		for i := len(msgs) - 1; i >= 0; i-- {
+			if msgs[i].Role == ai.RoleModel {
+				msgs = msgs[i+1:]
+				break
+			}
+		}
+	case cfg.Truncation != nil:
+		var err error
+		if msgs, err = truncateMessages(ctx, model, msgs, cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	input, err := convertResponsesInput(msgs)
+	if err != nil {
+		return nil, err
+	}
+	req := &ResponsesRequest{
+		Model:              deployment,
+		Input:              input,
+		MaxOutputTokens:    cfg.MaxTokens,
+		Temperature:        cfg.Temperature,
+		TopP:               cfg.TopP,
+		User:               cfg.User,
+		Store:              rc.Store,
+		PreviousResponseID: rc.PreviousResponseID,
+		Background:         rc.Background,
+	}
+	if cfg.PromptCache != nil {
+		req.PromptCacheKey = cfg.PromptCache.Key
+	}
+	if rc.Background {
+		if rc.Store != nil && !*rc.Store {
+			return nil, errors.New("background responses must be stored")
+		}
+		req.Store = to.Ptr(true)
+	}
+	if rc.ReasoningEffort != "" || rc.ReasoningSummary != "" {
+		req.Reasoning = &ResponsesReasoning{Effort: rc.ReasoningEffort, Summary: rc.ReasoningSummary}
+	}
+	for _, tool := range mr.Tools {
+		params, err := toolParameters(tool, cfg.StrictTools)
+		if err != nil {
+			return nil, err
+		}
+		req.Tools = append(req.Tools, responsesTool{
+			Type:        "function",
+			Name:        tool.Name,
+			Description: tool.Description,
+			Parameters:  json.RawMessage(params),
+			// The Responses API defaults to strict mode, so it is always sent
+			Strict: cfg.StrictTools,
+		})
+	}
+	for _, tool := range rc.Tools {
+		req.Tools = append(req.Tools, tool)
+	}
+	choice, err := resolveToolChoice(mr, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if len(req.Tools) > 0 {
+		req.ToolChoice = responsesToolChoice(choice)
+		req.ParallelToolCalls = cfg.ParallelToolCalls
+	}
+	return req, nil
+}
+
+// responsesToolChoice converts a resolved tool choice to Responses API format
+func responsesToolChoice(choice string) any {
+	switch choice {
+	case "":
+		return nil
+	case string(ai.ToolChoiceAuto), string(ai.ToolChoiceNone), string(ai.ToolChoiceRequired):
+		return choice
+	default:
+		return map[string]string{"type": "function", "name": choice}
+	}
+}
+
+// convertResponsesInput converts Genkit messages to Responses API input items.
+// Tool requests and responses become function_call and function_call_output
+// items linked by the tool reference.
+func convertResponsesInput(msgs []*ai.Message) ([]any, error) {
+	input := make([]any, 0, len(msgs))
+	for _, msg := range msgs {
+		content := extractTextContent(msg.Content)
+		switch msg.Role {
+		case ai.RoleSystem, ai.RoleUser:
+			input = append(input, responsesMessage{Role: string(msg.Role), Content: content})
+		case ai.RoleModel:
+			if content != "" {
+				input = append(input, responsesMessage{Role: "assistant", Content: content})
+			}
+			for _, part := range msg.Content {
+				if !part.IsToolRequest() {
+					continue
+				}
+				args, err := json.Marshal(part.ToolRequest.Input)
+				if err != nil {
+					return nil, fmt.Errorf("failed to marshal tool request: %w", err)
+				}
+				input = append(input, responsesFunctionCall{
+					Type:      "function_call",
+					CallID:    toolCallID(part.ToolRequest.Ref, part.ToolRequest.Name),
+					Name:      part.ToolRequest.Name,
+					Arguments: string(args),
+				})
+			}
+		case ai.RoleTool:
+			for _, part := range msg.Content {
+				if !part.IsToolResponse() {
+					continue
+				}
+				output, err := json.Marshal(part.ToolResponse.Output)
+				if err != nil {
+					return nil, fmt.Errorf("failed to marshal tool response: %w", err)
+				}
+				input = append(input, responsesFunctionOutput{
+					Type:   "function_call_output",
+					CallID: toolCallID(part.ToolResponse.Ref, part.ToolResponse.Name),
+					Output: string(output),
+				})
+			}
+		default:
+			return nil, fmt.Errorf("unsupported role: %s", msg.Role)
+		}
+	}
+	return input, nil
+}
+
+// convertResponse converts a finished Responses API response to Genkit format
+func convertResponse(resp *responsesResponse) (*ai.ModelResponse, error) {
+	if resp.Status == "failed" {
+		msg := "unknown error"
+		if resp.Error != nil {
+			msg = fmt.Sprintf("%s: %s", resp.Error.Code, resp.Error.Message)
+		}
+		return nil, fmt.Errorf("response %s failed: %s", resp.ID, msg)
+	}
+
+	var parts []*ai.Part
+	var reasoning []string
+	for _, item := range resp.Output {
+		switch item.Type {
+		case "message":
+			for _, c := range item.Content {
+				switch c.Type {
+				case "output_text":
+					parts = append(parts, ai.NewTextPart(c.Text))
+				case "refusal":
+					parts = append(parts, ai.NewTextPart(c.Refusal))
+				}
+			}
+		case "function_call":
+			parts = append(parts, ai.NewToolRequestPart(&ai.ToolRequest{
+				Name:  item.Name,
+				Ref:   item.CallID,
+				Input: toolArguments(item.Arguments),
+			}))
+		case "reasoning":
+			for _, s := range item.Summary {
+				reasoning = append(reasoning, s.Text)
+			}
+		}
+	}
+	if len(parts) == 0 {
+		parts = append(parts, ai.NewTextPart(""))
+	}
+
+	response := &ai.ModelResponse{
+		Message:      &ai.Message{Content: parts, Role: ai.RoleModel},
+		FinishReason: ai.FinishReasonStop,
+		Usage:        convertResponsesUsage(resp.Usage),
+	}
+	if resp.Status == "incomplete" && resp.IncompleteDetails != nil {
+		switch resp.IncompleteDetails.Reason {
+		case "max_output_tokens":
+			response.FinishReason = ai.FinishReasonLength
+		case "content_filter":
+			response.FinishReason = ai.FinishReasonBlocked
+			response.FinishMessage = "response blocked by content filter"
+		default:
+			response.FinishReason = ai.FinishReasonOther
+		}
+	}
+	applyResponseInfo(response, resp.ID, resp.Model)
+	if len(reasoning) > 0 {
+		responseMetadata(response).Reasoning = strings.Join(reasoning, "\n\n")
+	}
+	return response, nil
+}
+
+func convertResponsesUsage(usage *responsesUsage) *ai.GenerationUsage {
+	if usage == nil {
+		return nil
+	}
+	out := &ai.GenerationUsage{
+		InputTokens:  usage.InputTokens,
+		OutputTokens: usage.OutputTokens,
+		TotalTokens:  usage.TotalTokens,
+	}
+	if usage.InputTokensDetails != nil {
+		out.CachedContentTokens = usage.InputTokensDetails.CachedTokens
+	}
+	if usage.OutputTokensDetails != nil {
+		out.ThoughtsTokens = usage.OutputTokensDetails.ReasoningTokens
+	}
+	return out
+}
+
+// readResponsesStream translates server-sent events to chunks: text deltas as
+// text parts, reasoning summary deltas as custom parts with a "reasoning" key
+// and completed function calls as tool requests
+func readResponsesStream(ctx context.Context, stream io.Reader, cb ai.ModelStreamCallback) (*ai.ModelResponse, error) {
+	scanner := bufio.NewScanner(stream)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	var data bytes.Buffer
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if payload, ok := bytes.CutPrefix(line, []byte("data:")); ok {
+			data.Write(bytes.TrimSpace(payload))
+			continue
+		}
+		if len(line) > 0 || data.Len() == 0 {
+			continue
+		}
+
+		var event responsesEvent
+		if err := json.Unmarshal(data.Bytes(), &event); err != nil {
+			return nil, fmt.Errorf("failed to decode response event: %w", err)
+		}
+		data.Reset()
+
+		var chunk *ai.Part
+		switch event.Type {
+		case "response.output_text.delta":
+			chunk = ai.NewTextPart(event.Delta)
+		case "response.reasoning_summary_text.delta":
+			chunk = ai.NewCustomPart(map[string]any{"reasoning": event.Delta})
+		case "response.output_item.done":
+			if event.Item != nil && event.Item.Type == "function_call" {
+				chunk = ai.NewToolRequestPart(&ai.ToolRequest{
+					Name:  event.Item.Name,
+					Ref:   event.Item.CallID,
+					Input: toolArguments(event.Item.Arguments),
+				})
+			}
+		case "response.completed", "response.incomplete", "response.failed":
+			if event.Response == nil {
+				return nil, fmt.Errorf("%s event without a response", event.Type)
+			}
+			return convertResponse(event.Response)
+		case "error":
+			return nil, fmt.Errorf("response stream error: %s: %s", event.Code, event.Message)
+		}
+		if chunk != nil {
+			if err := cb(ctx, &ai.ModelResponseChunk{Content: []*ai.Part{chunk}, Role: ai.RoleModel}); err != nil {
+				return nil, fmt.Errorf("streaming callback error: %w", err)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read response stream: %w", err)
+	}
+	return nil, errors.New("response stream ended before the response completed")
+}
+
+// azureResponsesClient is the default ResponsesClient, sharing the plugin's
+// credentials, transport and the Azure SDK's retry policy
+type azureResponsesClient struct {
+	endpoint string
+	pipeline runtime.Pipeline
+}
+
+func newResponsesClient(endpoint, apiKey string, transport policy.Transporter) *azureResponsesClient {
+	return &azureResponsesClient{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		pipeline: runtime.NewPipeline("azopenai", "v0.0.0", runtime.PipelineOptions{
+			PerRetry: []policy.Policy{runtime.NewKeyCredentialPolicy(azcore.NewKeyCredential(apiKey), "api-key", nil)},
+		}, &policy.ClientOptions{Transport: transport}),
+	}
+}
+
+func (c *azureResponsesClient) CreateResponse(ctx context.Context, body []byte) ([]byte, error) {
+	resp, err := c.do(ctx, http.MethodPost, "", body, false)
+	if err != nil {
+		return nil, err
+	}
+	return runtime.Payload(resp)
+}
+
+func (c *azureResponsesClient) CreateResponseStream(ctx context.Context, body []byte) (io.ReadCloser, error) {
+	resp, err := c.do(ctx, http.MethodPost, "", body, true)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (c *azureResponsesClient) GetResponse(ctx context.Context, id string) ([]byte, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/"+id, nil, false)
+	if err != nil {
+		return nil, err
+	}
+	return runtime.Payload(resp)
+}
+
+func (c *azureResponsesClient) do(ctx context.Context, method, path string, body []byte, stream bool) (*http.Response, error) {
+	req, err := runtime.NewRequest(ctx, method, c.endpoint+"/openai/responses"+path)
+	if err != nil {
+		return nil, err
+	}
+	req.Raw().URL.RawQuery = "api-version=" + responsesAPIVersion
+	if body != nil {
+		if err := req.SetBody(streaming.NopCloser(bytes.NewReader(body)), "application/json"); err != nil {
+			return nil, err
+		}
+	}
+	if stream {
+		runtime.SkipBodyDownload(req)
+	}
+	resp, err := c.pipeline.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if !runtime.HasStatusCode(resp, http.StatusOK) {
+		return nil, runtime.NewResponseError(resp)
+	}
+	return resp, nil
+}
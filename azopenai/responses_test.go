@@ -0,0 +1,327 @@
+// Copyright 2025 herosizy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package azopenai
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/HeroSizy/genkit-go-plugins/azopenai/azopenaitest"
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+)
+
+// useResponses serves Gpt4o through the Responses API
+func useResponses(p *AzureOpenAI) {
+	p.Responses = &ResponsesOptions{Models: []string{Gpt4o}, PollInterval: time.Millisecond}
+}
+
+func TestResponses_NonStreaming(t *testing.T) {
+	g, srv := initPlugin(t, useResponses)
+	srv.QueueResponse(azopenaitest.ChatReply{
+		Content:   "Paris",
+		Reasoning: "The capital of France is Paris.",
+		Usage:     &azopenaitest.Usage{PromptTokens: 12, CompletionTokens: 1, ReasoningTokens: 20},
+	})
+
+	req := &ai.ModelRequest{
+		Messages: []*ai.Message{
+			ai.NewSystemTextMessage("Answer briefly."),
+			ai.NewUserTextMessage("Capital of France?"),
+		},
+		Config: &OpenAIConfig{
+			DeploymentName: "gpt-4o-prod",
+			MaxTokens:      to.Ptr[int32](50),
+			Responses: &ResponsesConfig{
+				ReasoningSummary: "auto",
+				Tools:            []map[string]any{{"type": "web_search_preview"}},
+			},
+		},
+	}
+	resp, err := Model(g, Gpt4o).Generate(context.Background(), req, nil)
+	if err != nil {
+		t.Fatalf("Generate() error: %v", err)
+	}
+	if resp.Text() != "Paris" || resp.FinishReason != ai.FinishReasonStop {
+		t.Errorf("Unexpected response %q (%s)", resp.Text(), resp.FinishReason)
+	}
+	md := ResponseMetadataFrom(resp)
+	if md == nil || !strings.HasPrefix(md.ID, "resp_") || md.Reasoning != "The capital of France is Paris." {
+		t.Errorf("Unexpected metadata %+v", md)
+	}
+	if resp.Usage.InputTokens != 12 || resp.Usage.OutputTokens != 21 || resp.Usage.ThoughtsTokens != 20 {
+		t.Errorf("Unexpected usage %+v", resp.Usage)
+	}
+
+	sent := srv.Requests()[0]
+	if sent.Endpoint != azopenaitest.EndpointResponses || sent.Deployment != "gpt-4o-prod" {
+		t.Fatalf("Expected a Responses API request for gpt-4o-prod, got %s %q", sent.Endpoint, sent.Deployment)
+	}
+	body := sent.JSON()
+	input := body["input"].([]any)
+	if len(input) != 2 || input[0].(map[string]any)["role"] != "system" {
+		t.Errorf("Unexpected input %v", input)
+	}
+	if body["max_output_tokens"] != float64(50) || body["reasoning"].(map[string]any)["summary"] != "auto" {
+		t.Errorf("Unexpected request body %v", body)
+	}
+	if tools := body["tools"].([]any); len(tools) != 1 || tools[0].(map[string]any)["type"] != "web_search_preview" {
+		t.Errorf("Built-in tools not sent: %v", body["tools"])
+	}
+}
+
+func TestResponses_Streaming(t *testing.T) {
+	g, srv := initPlugin(t, useResponses)
+	srv.QueueResponse(azopenaitest.ChatReply{Chunks: []string{"Hel", "lo"}, Reasoning: "Greeting."})
+
+	var text []string
+	var reasoning []any
+	resp, err := Model(g, Gpt4o).Generate(context.Background(), helloRequest(), func(ctx context.Context, c *ai.ModelResponseChunk) error {
+		for _, p := range c.Content {
+			if p.IsCustom() {
+				reasoning = append(reasoning, p.Custom["reasoning"])
+			} else {
+				text = append(text, p.Text)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Generate() error: %v", err)
+	}
+	if strings.Join(text, "|") != "Hel|lo" || len(reasoning) != 1 || reasoning[0] != "Greeting." {
+		t.Errorf("Unexpected chunks %q, reasoning %v", text, reasoning)
+	}
+	if resp.Text() != "Hello" || ResponseMetadataFrom(resp).Reasoning != "Greeting." {
+		t.Errorf("Unexpected final response %q", resp.Text())
+	}
+	if stream, _ := srv.Requests()[0].JSON()["stream"].(bool); !stream {
+		t.Error("Expected a streaming request")
+	}
+}
+
+func TestResponses_ToolCalls(t *testing.T) {
+	g, srv := initPlugin(t, useResponses)
+	srv.QueueResponse(
+		azopenaitest.ChatReply{ToolCalls: []azopenaitest.ToolCall{{ID: "call_1", Name: "weather", Arguments: `{"city":"Oslo"}`}}},
+		azopenaitest.ChatReply{Content: "It is sunny."},
+	)
+	tool := &ai.ToolDefinition{Name: "weather", Description: "Current weather", InputSchema: map[string]any{"type": "object"}}
+
+	req := &ai.ModelRequest{
+		Messages: []*ai.Message{ai.NewUserTextMessage("Weather in Oslo?")},
+		Tools:    []*ai.ToolDefinition{tool},
+	}
+	resp, err := Model(g, Gpt4o).Generate(context.Background(), req, nil)
+	if err != nil {
+		t.Fatalf("Generate() error: %v", err)
+	}
+	parts := resp.Message.Content
+	if len(parts) != 1 || !parts[0].IsToolRequest() {
+		t.Fatalf("Expected a tool request, got %+v", parts)
+	}
+	if tr := parts[0].ToolRequest; tr.Name != "weather" || tr.Ref != "call_1" || tr.Input.(map[string]any)["city"] != "Oslo" {
+		t.Errorf("Unexpected tool request %+v", tr)
+	}
+	if fn := srv.Requests()[0].JSON()["tools"].([]any)[0].(map[string]any); fn["type"] != "function" || fn["name"] != "weather" {
+		t.Errorf("Unexpected function tool %v", fn)
+	}
+
+	req.Messages = append(req.Messages, resp.Message, ai.NewMessage(ai.RoleTool, nil, ai.NewToolResponsePart(&ai.ToolResponse{
+		Name: "weather", Ref: "call_1", Output: map[string]any{"sky": "clear"},
+	})))
+	if _, err := Model(g, Gpt4o).Generate(context.Background(), req, nil); err != nil {
+		t.Fatalf("Generate() error: %v", err)
+	}
+	input := srv.Requests()[1].JSON()["input"].([]any)
+	if len(input) != 3 {
+		t.Fatalf("Expected 3 input items, got %v", input)
+	}
+	call, output := input[1].(map[string]any), input[2].(map[string]any)
+	if call["type"] != "function_call" || call["call_id"] != "call_1" || call["arguments"] != `{"city":"Oslo"}` {
+		t.Errorf("Unexpected function call item %v", call)
+	}
+	if output["type"] != "function_call_output" || output["call_id"] != "call_1" || output["output"] != `{"sky":"clear"}` {
+		t.Errorf("Unexpected function output item %v", output)
+	}
+}
+
+func TestResponses_PreviousResponseID(t *testing.T) {
+	g, srv := initPlugin(t, useResponses)
+	srv.QueueResponse(azopenaitest.ChatReply{Content: "Hi!"}, azopenaitest.ChatReply{Content: "Bye!"})
+
+	first, err := Model(g, Gpt4o).Generate(context.Background(), helloRequest(), nil)
+	if err != nil {
+		t.Fatalf("Generate() error: %v", err)
+	}
+	id := ResponseMetadataFrom(first).ID
+	if _, ok := srv.StoredResponse(id); !ok {
+		t.Fatalf("Response %s was not stored", id)
+	}
+
+	req := &ai.ModelRequest{
+		Messages: []*ai.Message{ai.NewUserTextMessage("Hello"), first.Message, ai.NewUserTextMessage("Goodbye")},
+		Config:   &OpenAIConfig{Responses: &ResponsesConfig{PreviousResponseID: id}},
+	}
+	if _, err := Model(g, Gpt4o).Generate(context.Background(), req, nil); err != nil {
+		t.Fatalf("Generate() error: %v", err)
+	}
+	body := srv.Requests()[1].JSON()
+	input := body["input"].([]any)
+	if body["previous_response_id"] != id || len(input) != 1 || input[0].(map[string]any)["content"] != "Goodbye" {
+		t.Errorf("Expected only the new turn chained to %s, got %v", id, body)
+	}
+
+	req.Config = &OpenAIConfig{Responses: &ResponsesConfig{PreviousResponseID: "resp_missing"}}
+	if _, err := Model(g, Gpt4o).Generate(context.Background(), req, nil); err == nil {
+		t.Error("Expected an error for an unknown previous response")
+	}
+}
+
+func TestResponses_Background(t *testing.T) {
+	g, srv := initPlugin(t, useResponses)
+	srv.QueueResponse(azopenaitest.ChatReply{Content: "Done in the background"})
+
+	req := helloRequest()
+	req.Config.(*OpenAIConfig).Responses = &ResponsesConfig{Background: true}
+	var chunks int
+	resp, err := Model(g, Gpt4o).Generate(context.Background(), req, func(context.Context, *ai.ModelResponseChunk) error {
+		chunks++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Generate() error: %v", err)
+	}
+	if resp.Text() != "Done in the background" || chunks != 1 {
+		t.Errorf("Unexpected response %q after %d chunks", resp.Text(), chunks)
+	}
+
+	reqs := srv.Requests()
+	if len(reqs) != 2 {
+		t.Fatalf("Expected a create and a poll request, got %d", len(reqs))
+	}
+	if body := reqs[0].JSON(); body["background"] != true || body["store"] != true {
+		t.Errorf("Unexpected request body %v", body)
+	}
+
+	req.Config.(*OpenAIConfig).Responses = &ResponsesConfig{Background: true, Store: to.Ptr(false)}
+	if _, err := Model(g, Gpt4o).Generate(context.Background(), req, nil); err == nil {
+		t.Error("Background responses without storage should be rejected")
+	}
+}
+
+func TestResponses_Incomplete(t *testing.T) {
+	g, srv := initPlugin(t, useResponses)
+	srv.QueueResponse(azopenaitest.ChatReply{Content: "Once upon", FinishReason: "length"})
+
+	resp, err := Model(g, Gpt4o).Generate(context.Background(), helloRequest(), nil)
+	if err != nil {
+		t.Fatalf("Generate() error: %v", err)
+	}
+	if resp.FinishReason != ai.FinishReasonLength || resp.Text() != "Once upon" {
+		t.Errorf("Unexpected response %q (%s)", resp.Text(), resp.FinishReason)
+	}
+}
+
+func TestResponses_OtherModelsUseChat(t *testing.T) {
+	g, srv := initPlugin(t, useResponses)
+	srv.QueueChat(azopenaitest.ChatReply{Content: "From chat"})
+
+	resp, err := Model(g, Gpt4oMini).Generate(context.Background(), helloRequest(), nil)
+	if err != nil {
+		t.Fatalf("Generate() error: %v", err)
+	}
+	if resp.Text() != "From chat" || srv.Requests()[0].Endpoint != azopenaitest.EndpointChat {
+		t.Errorf("Expected gpt-4o-mini to use chat completions, got %q", resp.Text())
+	}
+}
+
+func TestResponses_CustomClientRequiresResponsesClient(t *testing.T) {
+	ctx := context.Background()
+	g, err := genkit.Init(ctx)
+	if err != nil {
+		t.Fatalf("Failed to initialize Genkit: %v", err)
+	}
+	plugin := &AzureOpenAI{Client: &mockClient{}, Responses: &ResponsesOptions{Models: []string{Gpt4o}}}
+	if err := plugin.Init(ctx, g); err == nil {
+		t.Error("Init() should fail without a Responses API client")
+	}
+}
+
+func TestResponses_CacheAndMiddleware(t *testing.T) {
+	summaries := 0
+	g, srv := initPlugin(t, func(p *AzureOpenAI) {
+		useResponses(p)
+		p.Cache = &CacheOptions{}
+		p.Middleware = []Middleware{{
+			Chat: func(next ChatHandler) ChatHandler {
+				return func(ctx context.Context, call *ChatCall) (*ai.ModelResponse, error) {
+					if call.Options != nil || call.Responses == nil {
+						t.Error("Responses models should only carry a Responses request")
+					}
+					call.Responses.User = "from-middleware"
+					return next(ctx, call)
+				}
+			},
+		}}
+	})
+	srv.QueueResponse(azopenaitest.ChatReply{Content: "low"}, azopenaitest.ChatReply{Content: "high"})
+
+	generate := func(effort string) *ai.ModelResponse {
+		t.Helper()
+		resp, err := Model(g, Gpt4o).Generate(context.Background(), &ai.ModelRequest{
+			Messages: []*ai.Message{ai.NewUserTextMessage(strings.Repeat("old ", 200)), ai.NewModelTextMessage("ok"), ai.NewUserTextMessage("Hi")},
+			Config: &OpenAIConfig{
+				Responses: &ResponsesConfig{ReasoningEffort: effort},
+				Truncation: &TruncationConfig{Strategy: TruncationSummarize, MaxInputTokens: 50, Summarizer: func(context.Context, []*ai.Message) (string, error) {
+					summaries++
+					return "earlier chat", nil
+				}},
+			},
+		}, nil)
+		if err != nil {
+			t.Fatalf("Generate() error: %v", err)
+		}
+		return resp
+	}
+
+	if resp := generate("low"); resp.Text() != "low" {
+		t.Errorf("Unexpected response %q", resp.Text())
+	}
+	if summaries != 1 {
+		t.Errorf("History was summarized %d times, want 1", summaries)
+	}
+	if user := srv.Requests()[0].JSON()["user"]; user != "from-middleware" {
+		t.Errorf("Middleware edits were not sent, user = %v", user)
+	}
+	if resp := generate("high"); resp.Text() != "high" || ResponseMetadataFrom(resp).Cached {
+		t.Error("Requests with other Responses settings should not share a cache entry")
+	}
+	if resp := generate("low"); resp.Text() != "low" || !ResponseMetadataFrom(resp).Cached {
+		t.Error("Expected a cache hit for an identical request")
+	}
+	if n := len(srv.Requests()); n != 2 {
+		t.Errorf("Expected 2 requests, got %d", n)
+	}
+}
@@ -0,0 +1,262 @@
+// Copyright 2025 herosizy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package azopenai
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// Keywords describing the schema document rather than the data, which Azure rejects.
+var schemaMetaKeywords = []string{"$schema", "$id", "$anchor", "$comment", "$defs", "definitions"}
+
+// Validation keywords outside the JSON Schema subset accepted in strict mode.
+// They are dropped rather than rejected, since they only narrow valid values.
+var strictStrippedKeywords = []string{
+	"default", "examples", "format", "pattern", "minLength", "maxLength",
+	"minimum", "maximum", "exclusiveMinimum", "exclusiveMaximum", "multipleOf",
+	"minItems", "maxItems", "uniqueItems", "contains", "minContains", "maxContains",
+	"minProperties", "maxProperties", "propertyNames", "readOnly", "writeOnly", "deprecated",
+}
+
+// Keywords strict mode cannot express, which would change a schema's meaning if dropped.
+var strictRejectedKeywords = []string{
+	"allOf", "not", "if", "then", "else", "dependentRequired", "dependentSchemas",
+	"patternProperties", "unevaluatedProperties", "unevaluatedItems", "prefixItems",
+}
+
+// normalizeToolSchema prepares a JSON-encoded tool input schema for Azure OpenAI.
+// It inlines $ref pointers into $defs and definitions and removes meta keywords.
+// In strict mode it also requires every property, makes optional properties
+// nullable, forbids additional properties and drops unsupported validation
+// keywords, failing on constructs strict mode cannot represent.
+func normalizeToolSchema(data []byte, strict bool) ([]byte, error) {
+	var schema map[string]any
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil, errors.New("schema must be a JSON object")
+	}
+	if schema == nil {
+		schema = map[string]any{"type": "object", "properties": map[string]any{}}
+	}
+	n := &schemaNormalizer{defs: map[string]any{}, strict: strict}
+	for _, key := range []string{"definitions", "$defs"} {
+		if defs, ok := schema[key].(map[string]any); ok {
+			for name, def := range defs {
+				n.defs["#/"+key+"/"+name] = def
+			}
+		}
+	}
+	normalized, err := n.normalize(schema, "#", nil)
+	if err != nil {
+		return nil, err
+	}
+	if strict && normalized.(map[string]any)["type"] != "object" {
+		return nil, errors.New("strict mode requires an object schema at the root")
+	}
+	return json.Marshal(normalized)
+}
+
+type schemaNormalizer struct {
+	defs   map[string]any
+	strict bool
+}
+
+// normalize returns a normalized copy of node. path locates node for error
+// messages and refs holds the references being expanded, to detect recursion.
+func (n *schemaNormalizer) normalize(node any, path string, refs []string) (any, error) {
+	schema, ok := node.(map[string]any)
+	if !ok {
+		// Booleans are valid schemas; anything else passes through unchanged
+		return node, nil
+	}
+
+	if ref, ok := schema["$ref"].(string); ok {
+		if slices.Contains(refs, ref) {
+			return nil, fmt.Errorf("recursive $ref %q at %s cannot be inlined", ref, path)
+		}
+		target, ok := n.defs[ref].(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("unresolved $ref %q at %s", ref, path)
+		}
+		// Keywords next to $ref, such as a description, override the definition's
+		merged := make(map[string]any, len(target)+len(schema))
+		for k, v := range target {
+			merged[k] = v
+		}
+		for k, v := range schema {
+			if k != "$ref" {
+				merged[k] = v
+			}
+		}
+		return n.normalize(merged, path, append(refs, ref))
+	}
+
+	out := make(map[string]any, len(schema))
+	for k, v := range schema {
+		switch {
+		case slices.Contains(schemaMetaKeywords, k):
+		case n.strict && slices.Contains(strictStrippedKeywords, k):
+		case n.strict && slices.Contains(strictRejectedKeywords, k):
+			return nil, fmt.Errorf("%q at %s is not supported in strict mode", k, path)
+		default:
+			out[k] = v
+		}
+	}
+
+	// Every subschema is normalized so that no $ref points into the removed definitions
+	for _, key := range []string{"properties", "patternProperties", "dependentSchemas"} {
+		props, ok := out[key].(map[string]any)
+		if !ok {
+			continue
+		}
+		normalized := make(map[string]any, len(props))
+		for name, prop := range props {
+			p, err := n.normalize(prop, path+"/"+key+"/"+name, refs)
+			if err != nil {
+				return nil, err
+			}
+			normalized[name] = p
+		}
+		out[key] = normalized
+	}
+	for _, key := range []string{"items", "additionalItems", "contains", "propertyNames", "not", "if", "then", "else", "unevaluatedItems", "unevaluatedProperties"} {
+		sub, ok := out[key]
+		if !ok {
+			continue
+		}
+		if _, isList := sub.([]any); isList {
+			continue // Tuple items are handled with the other schema lists
+		}
+		normalized, err := n.normalize(sub, path+"/"+key, refs)
+		if err != nil {
+			return nil, err
+		}
+		out[key] = normalized
+	}
+	if additional, ok := out["additionalProperties"].(map[string]any); ok {
+		if n.strict {
+			return nil, fmt.Errorf("additionalProperties schema at %s is not supported in strict mode", path)
+		}
+		normalized, err := n.normalize(additional, path+"/additionalProperties", refs)
+		if err != nil {
+			return nil, err
+		}
+		out["additionalProperties"] = normalized
+	}
+	for _, key := range []string{"anyOf", "oneOf", "allOf", "prefixItems", "items"} {
+		variants, ok := out[key].([]any)
+		if !ok {
+			continue
+		}
+		normalized := make([]any, len(variants))
+		for i, variant := range variants {
+			v, err := n.normalize(variant, fmt.Sprintf("%s/%s/%d", path, key, i), refs)
+			if err != nil {
+				return nil, err
+			}
+			normalized[i] = v
+		}
+		out[key] = normalized
+	}
+
+	if n.strict {
+		if err := n.strictObject(out, path); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// strictObject applies strict mode rules to a normalized schema. oneOf becomes
+// anyOf, and objects list every property as required and forbid others, with
+// properties that were optional made nullable instead.
+func (n *schemaNormalizer) strictObject(schema map[string]any, path string) error {
+	if oneOf, ok := schema["oneOf"]; ok {
+		if _, ok := schema["anyOf"]; ok {
+			return fmt.Errorf("both anyOf and oneOf at %s are not supported in strict mode", path)
+		}
+		schema["anyOf"] = oneOf
+		delete(schema, "oneOf")
+	}
+
+	props, isObject := schema["properties"].(map[string]any)
+	if !isObject && schema["type"] != "object" {
+		return nil
+	}
+	if additional, ok := schema["additionalProperties"]; ok && additional != false {
+		return fmt.Errorf("additionalProperties at %s must be false in strict mode", path)
+	}
+	schema["additionalProperties"] = false
+	if props == nil {
+		props = map[string]any{}
+		schema["properties"] = props
+	}
+
+	var required []string
+	if list, ok := schema["required"].([]any); ok {
+		for _, name := range list {
+			if s, ok := name.(string); ok {
+				required = append(required, s)
+			}
+		}
+	}
+	names := make([]string, 0, len(props))
+	for name := range props {
+		names = append(names, name)
+		if !slices.Contains(required, name) {
+			prop, ok := props[name].(map[string]any)
+			if !ok {
+				return fmt.Errorf("property %s/properties/%s must be a schema object in strict mode", path, name)
+			}
+			makeNullable(prop)
+		}
+	}
+	slices.Sort(names)
+	all := make([]any, len(names))
+	for i, name := range names {
+		all[i] = name
+	}
+	schema["required"] = all
+	return nil
+}
+
+// makeNullable lets schema also accept null, the strict mode spelling of an optional property
+func makeNullable(schema map[string]any) {
+	switch t := schema["type"].(type) {
+	case string:
+		if t != "null" {
+			schema["type"] = []any{t, "null"}
+		}
+	case []any:
+		if !slices.Contains(t, any("null")) {
+			schema["type"] = append(t, "null")
+		}
+	default:
+		if anyOf, ok := schema["anyOf"].([]any); ok {
+			schema["anyOf"] = append(anyOf, map[string]any{"type": "null"})
+		}
+	}
+	if enum, ok := schema["enum"].([]any); ok && !slices.Contains(enum, nil) {
+		schema["enum"] = append(enum, nil)
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2025 herosizy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package azopenai
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/HeroSizy/genkit-go-plugins/azopenai/azopenaitest"
+	"github.com/firebase/genkit/go/ai"
+)
+
+func TestNormalizeToolSchema(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		strict bool
+		want   string
+		errMsg string
+	}{
+		{
+			name:   "missing schema",
+			schema: `null`,
+			want:   `{"properties":{},"type":"object"}`,
+		},
+		{
+			name:   "inlines refs and drops meta keywords",
+			schema: `{"$schema":"https://json-schema.org/draft/2020-12/schema","$ref":"#/$defs/Query","$defs":{"Query":{"type":"object","properties":{"city":{"$ref":"#/$defs/City","description":"Where"}}},"City":{"type":"string","description":"City name"}}}`,
+			want:   `{"properties":{"city":{"description":"Where","type":"string"}},"type":"object"}`,
+		},
+		{
+			name:   "inlines refs in composition keywords outside strict mode",
+			schema: `{"$defs":{"Named":{"type":"object","properties":{"name":{"type":"string"}}},"Id":{"type":"integer"}},"type":"object","properties":{"pet":{"allOf":[{"$ref":"#/$defs/Named"}],"not":{"$ref":"#/$defs/Id"}},"pair":{"type":"array","prefixItems":[{"$ref":"#/$defs/Id"}]}},"if":{"$ref":"#/$defs/Named"},"then":{"$ref":"#/$defs/Named"},"else":{"$ref":"#/$defs/Id"},"dependentSchemas":{"pet":{"$ref":"#/$defs/Named"}}}`,
+			want:   `{"dependentSchemas":{"pet":{"properties":{"name":{"type":"string"}},"type":"object"}},"else":{"type":"integer"},"if":{"properties":{"name":{"type":"string"}},"type":"object"},"properties":{"pair":{"prefixItems":[{"type":"integer"}],"type":"array"},"pet":{"allOf":[{"properties":{"name":{"type":"string"}},"type":"object"}],"not":{"type":"integer"}}},"then":{"properties":{"name":{"type":"string"}},"type":"object"},"type":"object"}`,
+		},
+		{
+			name:   "keeps validation keywords outside strict mode",
+			schema: `{"type":"object","properties":{"days":{"type":"integer","minimum":1}}}`,
+			want:   `{"properties":{"days":{"minimum":1,"type":"integer"}},"type":"object"}`,
+		},
+		{
+			name:   "strict mode requires every property",
+			schema: `{"type":"object","properties":{"city":{"type":"string","format":"hostname"},"unit":{"type":"string","enum":["c","f"]}},"required":["city"]}`,
+			strict: true,
+			want:   `{"additionalProperties":false,"properties":{"city":{"type":"string"},"unit":{"enum":["c","f",null],"type":["string","null"]}},"required":["city","unit"],"type":"object"}`,
+		},
+		{
+			name:   "strict mode converts oneOf in nested items",
+			schema: `{"type":"object","properties":{"stops":{"type":"array","minItems":1,"items":{"oneOf":[{"type":"string"},{"type":"object","properties":{"lat":{"type":"number"}},"required":["lat"]}]}}},"required":["stops"]}`,
+			strict: true,
+			want:   `{"additionalProperties":false,"properties":{"stops":{"items":{"anyOf":[{"type":"string"},{"additionalProperties":false,"properties":{"lat":{"type":"number"}},"required":["lat"],"type":"object"}]},"type":"array"}},"required":["stops"],"type":"object"}`,
+		},
+		{
+			name:   "unresolved ref",
+			schema: `{"type":"object","properties":{"city":{"$ref":"#/$defs/City"}}}`,
+			errMsg: `unresolved $ref "#/$defs/City" at #/properties/city`,
+		},
+		{
+			name:   "recursive ref",
+			schema: `{"$ref":"#/$defs/Node","$defs":{"Node":{"type":"object","properties":{"next":{"$ref":"#/$defs/Node"}}}}}`,
+			errMsg: `recursive $ref "#/$defs/Node" at #/properties/next`,
+		},
+		{
+			name:   "strict mode rejects non-object root",
+			schema: `{"type":"string"}`,
+			strict: true,
+			errMsg: "object schema at the root",
+		},
+		{
+			name:   "strict mode rejects allOf",
+			schema: `{"type":"object","properties":{"a":{"allOf":[{"type":"string"}]}}}`,
+			strict: true,
+			errMsg: `"allOf" at #/properties/a`,
+		},
+		{
+			name:   "strict mode rejects open objects",
+			schema: `{"type":"object","additionalProperties":{"type":"string"}}`,
+			strict: true,
+			errMsg: "additionalProperties schema at #",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeToolSchema([]byte(tt.schema), tt.strict)
+			if tt.errMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+					t.Errorf("Expected error containing %q, got %v", tt.errMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("normalizeToolSchema() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFakeServer_StrictTools(t *testing.T) {
+	g, srv := initWithFakeServer(t)
+	srv.QueueChat(azopenaitest.ChatReply{Content: "ok"})
+
+	tool := &ai.ToolDefinition{Name: "weather", InputSchema: map[string]any{
+		"type":       "object",
+		"properties": map[string]any{"city": map[string]any{"type": "string"}},
+	}}
+	req := &ai.ModelRequest{
+		Messages: []*ai.Message{ai.NewUserTextMessage("Weather?")},
+		Tools:    []*ai.ToolDefinition{tool},
+		Config:   &OpenAIConfig{DeploymentName: "chat", StrictTools: true},
+	}
+	if _, err := Model(g, Gpt4o).Generate(context.Background(), req, nil); err != nil {
+		t.Fatalf("Generate() error: %v", err)
+	}
+	fn := srv.Requests()[0].JSON()["tools"].([]any)[0].(map[string]any)["function"].(map[string]any)
+	params, _ := json.Marshal(fn["parameters"])
+	if fn["strict"] != true || !strings.Contains(string(params), `"additionalProperties":false`) {
+		t.Errorf("Expected a strict function definition, got %v", fn)
+	}
+
+	// Incompatible schemas fail before a request is sent
+	tool.InputSchema = map[string]any{"type": "object", "properties": map[string]any{"city": map[string]any{"$ref": "#/$defs/City"}}}
+	_, err := Model(g, Gpt4o).Generate(context.Background(), req, nil)
+	if err == nil || !strings.Contains(err.Error(), `tool "weather"`) {
+		t.Errorf("Expected a schema error naming the tool, got %v", err)
+	}
+	if n := len(srv.Requests()); n != 1 {
+		t.Errorf("Expected 1 request, got %d", n)
+	}
+}
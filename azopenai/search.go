@@ -0,0 +1,385 @@
+// Copyright 2025 herosizy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package azopenai
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+)
+
+const (
+	defaultSearchAPIVersion = "2024-07-01"
+	defaultRetrieverK       = 3
+	indexBatchSize          = 100
+)
+
+// Metadata keys set on documents returned by Azure AI Search retrievers.
+const (
+	SearchScoreKey         = "@search.score"         // Relevance score of the hit
+	SearchRerankerScoreKey = "@search.rerankerScore" // Semantic ranker score, for semantic queries
+)
+
+// Search query types supported by Azure AI Search retrievers.
+const (
+	SearchQueryVector         = "vector"          // Pure vector similarity search
+	SearchQueryHybrid         = "hybrid"          // Keyword search combined with vector search
+	SearchQuerySemanticHybrid = "semantic_hybrid" // Hybrid search re-ranked by the semantic ranker
+)
+
+// AzureSearchConfig configures an Azure AI Search index used by a retriever or indexer.
+type AzureSearchConfig struct {
+	Endpoint        string      // Search service endpoint, e.g. https://<service>.search.windows.net
+	IndexName       string      // Name of an existing search index
+	APIKey          string      // Admin or query key. If empty, the value of the environment variable AZURE_SEARCH_API_KEY will be consulted.
+	APIVersion      string      // Search REST API version. Defaults to 2024-07-01.
+	Embedder        ai.Embedder // Embedder used for documents and queries, e.g. from [Embedder]
+	EmbedderOptions any         // Options passed to the embedder, e.g. *EmbedConfig
+
+	KeyField       string   // Key field of the index. Defaults to "id".
+	ContentField   string   // Searchable text field. Defaults to "content".
+	VectorField    string   // Vector field. Defaults to "contentVector".
+	MetadataField  string   // String field holding JSON-encoded document metadata. Defaults to "metadata".
+	MetadataFields []string // Metadata keys stored as top-level, filterable index fields
+
+	HTTPClient *http.Client // HTTP client used to call the search service. Defaults to http.DefaultClient.
+}
+
+// RetrieverOptions configures a single Azure AI Search retrieval.
+type RetrieverOptions struct {
+	K                     int    `json:"k,omitempty"`                     // Number of documents to return. Defaults to 3.
+	QueryType             string `json:"queryType,omitempty"`             // SearchQueryVector (default), SearchQueryHybrid or SearchQuerySemanticHybrid
+	SemanticConfiguration string `json:"semanticConfiguration,omitempty"` // Semantic configuration for SearchQuerySemanticHybrid
+	Filter                string `json:"filter,omitempty"`                // OData filter over filterable index fields
+}
+
+// searchIndex is a client for a single Azure AI Search index.
+type searchIndex struct {
+	cfg    AzureSearchConfig
+	apiKey string
+}
+
+// DefineRetriever defines a retriever that embeds queries with cfg.Embedder
+// and searches the configured Azure AI Search index.
+// Per-request options are passed as *RetrieverOptions.
+func DefineRetriever(g *genkit.Genkit, name string, cfg AzureSearchConfig) (ai.Retriever, error) {
+	idx, err := newSearchIndex(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("azopenai.DefineRetriever: %w", err)
+	}
+	return genkit.DefineRetriever(g, azureOpenAIProvider, name, idx.retrieve), nil
+}
+
+// DefineIndexer defines an indexer that embeds documents with cfg.Embedder
+// and uploads them to the configured Azure AI Search index.
+func DefineIndexer(g *genkit.Genkit, name string, cfg AzureSearchConfig) (ai.Indexer, error) {
+	idx, err := newSearchIndex(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("azopenai.DefineIndexer: %w", err)
+	}
+	return genkit.DefineIndexer(g, azureOpenAIProvider, name, idx.index), nil
+}
+
+func newSearchIndex(cfg AzureSearchConfig) (*searchIndex, error) {
+	if cfg.Endpoint == "" || cfg.IndexName == "" {
+		return nil, errors.New("search endpoint and index name are required")
+	}
+	if cfg.Embedder == nil {
+		return nil, errors.New("embedder is required")
+	}
+	apiKey := cfg.APIKey
+	if apiKey == "" {
+		apiKey = os.Getenv("AZURE_SEARCH_API_KEY")
+		if apiKey == "" {
+			return nil, errors.New("Azure AI Search requires setting AZURE_SEARCH_API_KEY in the environment")
+		}
+	}
+	if cfg.APIVersion == "" {
+		cfg.APIVersion = defaultSearchAPIVersion
+	}
+	if cfg.KeyField == "" {
+		cfg.KeyField = "id"
+	}
+	if cfg.ContentField == "" {
+		cfg.ContentField = "content"
+	}
+	if cfg.VectorField == "" {
+		cfg.VectorField = "contentVector"
+	}
+	if cfg.MetadataField == "" {
+		cfg.MetadataField = "metadata"
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = http.DefaultClient
+	}
+	return &searchIndex{cfg: cfg, apiKey: apiKey}, nil
+}
+
+// retrieve implements the retriever action.
+func (s *searchIndex) retrieve(ctx context.Context, req *ai.RetrieverRequest) (*ai.RetrieverResponse, error) {
+	if req.Query == nil {
+		return nil, errors.New("retriever query is required")
+	}
+	var opts RetrieverOptions
+	switch o := req.Options.(type) {
+	case *RetrieverOptions:
+		opts = *o
+	case RetrieverOptions:
+		opts = o
+	}
+	if opts.K <= 0 {
+		opts.K = defaultRetrieverK
+	}
+
+	vectors, err := s.embed(ctx, []*ai.Document{req.Query})
+	if err != nil {
+		return nil, err
+	}
+
+	body := map[string]any{
+		"top": opts.K,
+		"vectorQueries": []map[string]any{{
+			"kind":   "vector",
+			"vector": vectors[0],
+			"fields": s.cfg.VectorField,
+			"k":      opts.K,
+		}},
+	}
+	if opts.Filter != "" {
+		body["filter"] = opts.Filter
+	}
+	switch opts.QueryType {
+	case "", SearchQueryVector:
+	case SearchQueryHybrid:
+		body["search"] = documentText(req.Query)
+	case SearchQuerySemanticHybrid:
+		if opts.SemanticConfiguration == "" {
+			return nil, errors.New("semantic_hybrid queries require a semantic configuration")
+		}
+		body["search"] = documentText(req.Query)
+		body["queryType"] = "semantic"
+		body["semanticConfiguration"] = opts.SemanticConfiguration
+	default:
+		return nil, fmt.Errorf("unsupported search query type %q", opts.QueryType)
+	}
+
+	var result struct {
+		Value []map[string]any `json:"value"`
+	}
+	if err := s.do(ctx, "search", body, &result); err != nil {
+		return nil, err
+	}
+
+	docs := make([]*ai.Document, 0, len(result.Value))
+	for _, hit := range result.Value {
+		docs = append(docs, s.toDocument(hit))
+	}
+	return &ai.RetrieverResponse{Documents: docs}, nil
+}
+
+// index implements the indexer action.
+func (s *searchIndex) index(ctx context.Context, req *ai.IndexerRequest) error {
+	for start := 0; start < len(req.Documents); start += indexBatchSize {
+		end := min(start+indexBatchSize, len(req.Documents))
+		if err := s.indexBatch(ctx, req.Documents[start:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *searchIndex) indexBatch(ctx context.Context, docs []*ai.Document) error {
+	vectors, err := s.embed(ctx, docs)
+	if err != nil {
+		return err
+	}
+
+	actions := make([]map[string]any, len(docs))
+	for i, doc := range docs {
+		action, err := s.fromDocument(doc, vectors[i])
+		if err != nil {
+			return err
+		}
+		actions[i] = action
+	}
+
+	var result struct {
+		Value []struct {
+			Key          string `json:"key"`
+			Status       bool   `json:"status"`
+			ErrorMessage string `json:"errorMessage"`
+		} `json:"value"`
+	}
+	if err := s.do(ctx, "index", map[string]any{"value": actions}, &result); err != nil {
+		return err
+	}
+	var failed []string
+	for _, r := range result.Value {
+		if !r.Status {
+			failed = append(failed, fmt.Sprintf("%s: %s", r.Key, r.ErrorMessage))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("azure search: failed to index %d documents: %s", len(failed), strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// embed returns one embedding per document.
+func (s *searchIndex) embed(ctx context.Context, docs []*ai.Document) ([][]float32, error) {
+	resp, err := s.cfg.Embedder.Embed(ctx, &ai.EmbedRequest{Input: docs, Options: s.cfg.EmbedderOptions})
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed documents: %w", err)
+	}
+	if len(resp.Embeddings) != len(docs) {
+		return nil, fmt.Errorf("embedder returned %d embeddings for %d documents", len(resp.Embeddings), len(docs))
+	}
+	vectors := make([][]float32, len(docs))
+	for i, e := range resp.Embeddings {
+		vectors[i] = e.Embedding
+	}
+	return vectors, nil
+}
+
+// fromDocument converts a document to an Azure AI Search upload action.
+func (s *searchIndex) fromDocument(doc *ai.Document, vector []float32) (map[string]any, error) {
+	text := documentText(doc)
+	key, _ := doc.Metadata[s.cfg.KeyField].(string)
+	if key == "" {
+		sum := sha256.Sum256([]byte(text))
+		key = hex.EncodeToString(sum[:])
+	}
+
+	action := map[string]any{
+		"@search.action":   "mergeOrUpload",
+		s.cfg.KeyField:     key,
+		s.cfg.ContentField: text,
+		s.cfg.VectorField:  vector,
+	}
+
+	rest := make(map[string]any, len(doc.Metadata))
+	for k, v := range doc.Metadata {
+		if k == s.cfg.KeyField {
+			continue
+		}
+		if s.isMetadataField(k) {
+			action[k] = v
+			continue
+		}
+		rest[k] = v
+	}
+	b, err := json.Marshal(rest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal metadata of document %q: %w", key, err)
+	}
+	action[s.cfg.MetadataField] = string(b)
+	return action, nil
+}
+
+// toDocument converts a search hit to a document.
+func (s *searchIndex) toDocument(hit map[string]any) *ai.Document {
+	text, _ := hit[s.cfg.ContentField].(string)
+	metadata := map[string]any{}
+	if raw, ok := hit[s.cfg.MetadataField].(string); ok && raw != "" {
+		_ = json.Unmarshal([]byte(raw), &metadata)
+	}
+	if key, ok := hit[s.cfg.KeyField]; ok {
+		metadata[s.cfg.KeyField] = key
+	}
+	for _, k := range s.cfg.MetadataFields {
+		if v, ok := hit[k]; ok {
+			metadata[k] = v
+		}
+	}
+	for _, k := range []string{SearchScoreKey, SearchRerankerScoreKey} {
+		if v, ok := hit[k]; ok {
+			metadata[k] = v
+		}
+	}
+	return ai.DocumentFromText(text, metadata)
+}
+
+func (s *searchIndex) isMetadataField(key string) bool {
+	for _, k := range s.cfg.MetadataFields {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// do sends a request to the index's documents API and decodes the JSON response into out.
+func (s *searchIndex) do(ctx context.Context, op string, body any, out any) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to marshal search request: %w", err)
+	}
+	u := fmt.Sprintf("%s/indexes/%s/docs/%s?api-version=%s",
+		strings.TrimRight(s.cfg.Endpoint, "/"), url.PathEscape(s.cfg.IndexName), op, url.QueryEscape(s.cfg.APIVersion))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("api-key", s.apiKey)
+
+	resp, err := s.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("azure search %s request failed: %w", op, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read azure search response: %w", err)
+	}
+	// 207 Multi-Status reports per-document failures in the body
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusMultiStatus {
+		return fmt.Errorf("azure search %s request failed with status %d: %s", op, resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("failed to decode azure search response: %w", err)
+	}
+	return nil
+}
+
+// documentText returns the concatenated text parts of doc.
+func documentText(doc *ai.Document) string {
+	var textParts []string
+	for _, part := range doc.Content {
+		if part.IsText() {
+			textParts = append(textParts, part.Text)
+		}
+	}
+	return strings.Join(textParts, " ")
+}
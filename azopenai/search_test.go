@@ -0,0 +1,239 @@
+// Copyright 2025 herosizy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package azopenai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+)
+
+// fakeSearchService is an in-memory stand-in for an Azure AI Search index
+type fakeSearchService struct {
+	mu       sync.Mutex
+	docs     map[string]map[string]any
+	searches []map[string]any
+}
+
+func (f *fakeSearchService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("api-key") != "search-key" {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	var body map[string]any
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/indexes/docs/docs/index"):
+		var results []map[string]any
+		for _, action := range body["value"].([]any) {
+			doc := action.(map[string]any)
+			key := doc["id"].(string)
+			f.docs[key] = doc
+			results = append(results, map[string]any{"key": key, "status": true, "statusCode": 201})
+		}
+		json.NewEncoder(w).Encode(map[string]any{"value": results})
+	case strings.HasSuffix(r.URL.Path, "/indexes/docs/docs/search"):
+		f.searches = append(f.searches, body)
+		var hits []map[string]any
+		for _, doc := range f.docs {
+			if filter, ok := body["filter"].(string); ok && filter != fmt.Sprintf("category eq '%v'", doc["category"]) {
+				continue
+			}
+			hit := map[string]any{"@search.score": 0.9}
+			for k, v := range doc {
+				if k != "@search.action" && k != "contentVector" {
+					hit[k] = v
+				}
+			}
+			hits = append(hits, hit)
+		}
+		json.NewEncoder(w).Encode(map[string]any{"value": hits})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// newTestEmbedder defines an embedder backed by a fake embeddings endpoint
+func newTestEmbedder(t *testing.T, g *genkit.Genkit) ai.Embedder {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Input []string `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		var data []map[string]any
+		for i, in := range body.Input {
+			data = append(data, map[string]any{"object": "embedding", "index": i, "embedding": []float32{float32(len(in)), 1}})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"object": "list",
+			"data":   data,
+			"model":  TextEmbedding3Small,
+			"usage":  map[string]any{"prompt_tokens": 1, "total_tokens": 1},
+		})
+	})
+	return defineEmbedder(g, handlerConfig{client: client}, TextEmbedding3Small)
+}
+
+func TestAzureSearch_IndexAndRetrieve(t *testing.T) {
+	ctx := context.Background()
+	g, err := genkit.Init(ctx)
+	if err != nil {
+		t.Fatalf("Failed to initialize Genkit: %v", err)
+	}
+
+	fake := &fakeSearchService{docs: map[string]map[string]any{}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	cfg := AzureSearchConfig{
+		Endpoint:       srv.URL,
+		IndexName:      "docs",
+		APIKey:         "search-key",
+		Embedder:       newTestEmbedder(t, g),
+		MetadataFields: []string{"category"},
+	}
+	indexer, err := DefineIndexer(g, "docs", cfg)
+	if err != nil {
+		t.Fatalf("DefineIndexer() error: %v", err)
+	}
+	retriever, err := DefineRetriever(g, "docs", cfg)
+	if err != nil {
+		t.Fatalf("DefineRetriever() error: %v", err)
+	}
+
+	err = indexer.Index(ctx, &ai.IndexerRequest{Documents: []*ai.Document{
+		ai.DocumentFromText("Returns are accepted within 30 days", map[string]any{"id": "returns", "category": "policy", "author": "ops"}),
+		ai.DocumentFromText("Shipping takes 3-5 days", map[string]any{"category": "shipping"}),
+	}})
+	if err != nil {
+		t.Fatalf("Index() error: %v", err)
+	}
+	if len(fake.docs) != 2 {
+		t.Fatalf("Expected 2 indexed documents, got %d", len(fake.docs))
+	}
+	stored := fake.docs["returns"]
+	if stored["category"] != "policy" {
+		t.Errorf("Filterable metadata should be stored as a top-level field, got %v", stored["category"])
+	}
+	if stored["metadata"] != `{"author":"ops"}` {
+		t.Errorf("Remaining metadata should be JSON-encoded, got %v", stored["metadata"])
+	}
+	if vec, ok := stored["contentVector"].([]any); !ok || len(vec) != 2 {
+		t.Errorf("Expected embedding vector to be uploaded, got %v", stored["contentVector"])
+	}
+
+	resp, err := retriever.Retrieve(ctx, &ai.RetrieverRequest{
+		Query: ai.DocumentFromText("how do returns work?", nil),
+		Options: &RetrieverOptions{
+			K:                     2,
+			QueryType:             SearchQuerySemanticHybrid,
+			SemanticConfiguration: "default",
+			Filter:                "category eq 'policy'",
+		},
+	})
+	if err != nil {
+		t.Fatalf("Retrieve() error: %v", err)
+	}
+	if len(resp.Documents) != 1 {
+		t.Fatalf("Expected 1 document, got %d", len(resp.Documents))
+	}
+	doc := resp.Documents[0]
+	if doc.Content[0].Text != "Returns are accepted within 30 days" {
+		t.Errorf("Unexpected document text %q", doc.Content[0].Text)
+	}
+	if doc.Metadata["id"] != "returns" || doc.Metadata["author"] != "ops" || doc.Metadata["category"] != "policy" {
+		t.Errorf("Unexpected document metadata %v", doc.Metadata)
+	}
+	if doc.Metadata[SearchScoreKey] != 0.9 {
+		t.Errorf("Expected search score in metadata, got %v", doc.Metadata[SearchScoreKey])
+	}
+
+	search := fake.searches[0]
+	if search["queryType"] != "semantic" || search["semanticConfiguration"] != "default" {
+		t.Errorf("Expected semantic ranking parameters, got %v", search)
+	}
+	if search["search"] != "how do returns work?" {
+		t.Errorf("Hybrid queries should include the query text, got %v", search["search"])
+	}
+	vq := search["vectorQueries"].([]any)[0].(map[string]any)
+	if vq["fields"] != "contentVector" || vq["k"] != float64(2) {
+		t.Errorf("Unexpected vector query %v", vq)
+	}
+}
+
+func TestAzureSearch_Errors(t *testing.T) {
+	ctx := context.Background()
+	g, err := genkit.Init(ctx)
+	if err != nil {
+		t.Fatalf("Failed to initialize Genkit: %v", err)
+	}
+	embedder := newTestEmbedder(t, g)
+
+	if _, err := DefineRetriever(g, "missing-embedder", AzureSearchConfig{Endpoint: "https://x", IndexName: "docs", APIKey: "k"}); err == nil {
+		t.Error("Expected error without an embedder")
+	}
+	if _, err := DefineIndexer(g, "missing-index", AzureSearchConfig{Endpoint: "https://x", APIKey: "k", Embedder: embedder}); err == nil {
+		t.Error("Expected error without an index name")
+	}
+
+	fake := &fakeSearchService{docs: map[string]map[string]any{}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	retriever, err := DefineRetriever(g, "bad-key", AzureSearchConfig{
+		Endpoint:  srv.URL,
+		IndexName: "docs",
+		APIKey:    "wrong-key",
+		Embedder:  embedder,
+	})
+	if err != nil {
+		t.Fatalf("DefineRetriever() error: %v", err)
+	}
+	_, err = retriever.Retrieve(ctx, &ai.RetrieverRequest{Query: ai.DocumentFromText("query", nil)})
+	if err == nil || !strings.Contains(err.Error(), "status 403") {
+		t.Errorf("Expected status 403 error, got %v", err)
+	}
+
+	_, err = retriever.Retrieve(ctx, &ai.RetrieverRequest{
+		Query:   ai.DocumentFromText("query", nil),
+		Options: &RetrieverOptions{QueryType: SearchQuerySemanticHybrid},
+	})
+	if err == nil || !strings.Contains(err.Error(), "semantic configuration") {
+		t.Errorf("Expected semantic configuration error, got %v", err)
+	}
+}
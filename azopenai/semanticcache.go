@@ -0,0 +1,305 @@
+// Copyright 2025 herosizy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package azopenai
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/firebase/genkit/go/ai"
+)
+
+// SemanticCacheOptions configures a [SemanticCache].
+type SemanticCacheOptions struct {
+	Embedder   string        // Plugin embedder used for prompts. Defaults to TextEmbedding3Small.
+	Threshold  float64       // Minimum cosine similarity for a hit. Defaults to 0.95.
+	TTL        time.Duration // How long entries stay cached. Zero means they never expire.
+	MaxEntries int           // Maximum number of entries; the oldest are evicted first. Defaults to 1000.
+	Models     []string      // Models that use the cache. If empty, all chat models do.
+}
+
+// SemanticCacheHit describes the cached prompt a response was served for.
+type SemanticCacheHit struct {
+	Prompt     string  `json:"prompt"`     // Final user turn of the cached request
+	Similarity float64 `json:"similarity"` // Cosine similarity to the current final user turn
+}
+
+// SemanticCache returns cached responses for prompts that are similar, rather
+// than identical, to earlier ones. It embeds the final user turn of each chat
+// request with one of the plugin's embedders and searches, in an in-memory
+// vector store, prior prompts of requests that differ only in that turn: the
+// same model and deployment, earlier messages, tools and settings.
+//
+// Set AzureOpenAI.SemanticCache to enable it. Requests with OpenAIConfig.NoCache
+// bypass it.
+type SemanticCache struct {
+	opts SemanticCacheOptions
+
+	mu       sync.Mutex
+	embedder ai.Embedder
+	entries  []*semanticEntry
+}
+
+type semanticEntry struct {
+	scope    string    // Model and deployment the entry belongs to
+	model    string    // Genkit model name
+	prompt   string    // Final user turn
+	vector   []float32 // Normalized embedding of prompt
+	response []byte    // JSON-encoded ai.ModelResponse
+	expires  time.Time
+}
+
+// NewSemanticCache returns an empty semantic cache.
+func NewSemanticCache(opts SemanticCacheOptions) *SemanticCache {
+	if opts.Embedder == "" {
+		opts.Embedder = TextEmbedding3Small
+	}
+	if opts.Threshold == 0 {
+		opts.Threshold = 0.95
+	}
+	if opts.MaxEntries == 0 {
+		opts.MaxEntries = 1000
+	}
+	return &SemanticCache{opts: opts}
+}
+
+// Len returns the number of cached entries, including expired ones not yet evicted.
+func (c *SemanticCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// Clear removes all entries.
+func (c *SemanticCache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = nil
+}
+
+// InvalidateModel removes the entries of the named model and returns how many were removed.
+func (c *SemanticCache) InvalidateModel(model string) int {
+	return c.invalidate(func(e *semanticEntry) bool { return e.model == model })
+}
+
+// InvalidatePrompt removes entries whose prompt equals prompt and returns how many were removed.
+func (c *SemanticCache) InvalidatePrompt(prompt string) int {
+	return c.invalidate(func(e *semanticEntry) bool { return e.prompt == prompt })
+}
+
+func (c *SemanticCache) invalidate(match func(*semanticEntry) bool) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := len(c.entries)
+	c.entries = slices.DeleteFunc(c.entries, match)
+	return n - len(c.entries)
+}
+
+// bind sets the embedder once the plugin has defined it
+func (c *SemanticCache) bind(embedder ai.Embedder) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.embedder = embedder
+}
+
+func (c *SemanticCache) enabledFor(model string) bool {
+	return len(c.opts.Models) == 0 || slices.Contains(c.opts.Models, model)
+}
+
+// lookup returns the most similar unexpired entry in scope above the threshold
+func (c *SemanticCache) lookup(scope string, vector []float32) (*semanticEntry, float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	c.entries = slices.DeleteFunc(c.entries, func(e *semanticEntry) bool {
+		return !e.expires.IsZero() && now.After(e.expires)
+	})
+
+	var best *semanticEntry
+	bestScore := c.opts.Threshold
+	for _, e := range c.entries {
+		if e.scope != scope {
+			continue
+		}
+		if score := dot(vector, e.vector); score >= bestScore {
+			best, bestScore = e, score
+		}
+	}
+	return best, bestScore
+}
+
+func (c *SemanticCache) add(e *semanticEntry) {
+	if c.opts.TTL > 0 {
+		e.expires = time.Now().Add(c.opts.TTL)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = append(c.entries, e)
+	if over := len(c.entries) - c.opts.MaxEntries; over > 0 {
+		c.entries = slices.Delete(c.entries, 0, over)
+	}
+}
+
+// embed returns the normalized embedding of text
+func (c *SemanticCache) embed(ctx context.Context, text string) ([]float32, error) {
+	c.mu.Lock()
+	embedder := c.embedder
+	c.mu.Unlock()
+	if embedder == nil {
+		return nil, errors.New("semantic cache embedder is not defined")
+	}
+	resp, err := embedder.Embed(ctx, &ai.EmbedRequest{Input: []*ai.Document{ai.DocumentFromText(text, nil)}})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Embeddings) == 0 {
+		return nil, errors.New("no embedding returned")
+	}
+	return normalize(resp.Embeddings[0].Embedding), nil
+}
+
+// middleware serves similar prompts from the cache and stores new responses
+func (c *SemanticCache) middleware() Middleware {
+	return Middleware{
+		Chat: func(next ChatHandler) ChatHandler {
+			return func(ctx context.Context, call *ChatCall) (*ai.ModelResponse, error) {
+				if cfg, ok := call.Request.Config.(*OpenAIConfig); (ok && cfg.NoCache) || !c.enabledFor(call.Model) {
+					return next(ctx, call)
+				}
+				prompt := finalUserTurn(call.Request.Messages)
+				if prompt == "" {
+					return next(ctx, call)
+				}
+				vector, err := c.embed(ctx, prompt)
+				if err != nil {
+					slog.WarnContext(ctx, "azopenai: embedding prompt for semantic cache", "err", err)
+					return next(ctx, call)
+				}
+
+				scope, err := semanticScope(call)
+				if err != nil {
+					return next(ctx, call)
+				}
+				if e, score := c.lookup(scope, vector); e != nil {
+					var resp ai.ModelResponse
+					if err := json.Unmarshal(e.response, &resp); err == nil && resp.Message != nil {
+						responseMetadata(&resp).SemanticCache = &SemanticCacheHit{Prompt: e.prompt, Similarity: score}
+						return replayCached(ctx, &resp, call.Callback)
+					}
+				}
+
+				resp, err := next(ctx, call)
+				if err != nil {
+					return nil, err
+				}
+				if data, err := json.Marshal(resp); err == nil {
+					c.add(&semanticEntry{scope: scope, model: call.Model, prompt: prompt, vector: vector, response: data})
+				}
+				return resp, nil
+			}
+		},
+	}
+}
+
+// semanticScope limits matches to requests for the same model and deployment
+// whose messages other than the final user turn, tools and settings are identical
+func semanticScope(call *ChatCall) (string, error) {
+	msgs := call.Request.Messages
+	if i := lastUserMessage(msgs); i >= 0 {
+		msgs = slices.Delete(slices.Clone(msgs), i, i+1)
+	}
+	// The backend request carries the settings; its messages are covered by msgs
+	var settings any
+	switch {
+	case call.Options != nil:
+		options := *call.Options
+		options.Messages = nil
+		settings = options
+	case call.Responses != nil:
+		req := *call.Responses
+		req.Input = nil
+		settings = req
+	case call.Completions != nil:
+		options := *call.Completions
+		options.Prompt = nil
+		settings = options
+	}
+	b, err := json.Marshal([]any{msgs, call.Request.Tools, settings})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s\x00%s\x00%x", call.Model, call.Deployment(), sha256.Sum256(b)), nil
+}
+
+// finalUserTurn returns the text of the last user message
+func finalUserTurn(msgs []*ai.Message) string {
+	if i := lastUserMessage(msgs); i >= 0 {
+		return strings.TrimSpace(extractTextContent(msgs[i].Content))
+	}
+	return ""
+}
+
+// lastUserMessage returns the index of the last user message, or -1 if there is none
+func lastUserMessage(msgs []*ai.Message) int {
+	for i := len(msgs) - 1; i >= 0; i-- {
+		if msgs[i].Role == ai.RoleUser {
+			return i
+		}
+	}
+	return -1
+}
+
+func normalize(v []float32) []float32 {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	norm := math.Sqrt(sum)
+	out := make([]float32, len(v))
+	if norm == 0 {
+		return out
+	}
+	for i, x := range v {
+		out[i] = float32(float64(x) / norm)
+	}
+	return out
+}
+
+// dot returns the dot product, which is the cosine similarity of normalized vectors
+func dot(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var sum float64
+	for i := range a {
+		sum += float64(a[i]) * float64(b[i])
+	}
+	return sum
+}
@@ -0,0 +1,202 @@
+// Copyright 2025 herosizy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package azopenai
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/HeroSizy/genkit-go-plugins/azopenai/azopenaitest"
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+)
+
+func TestSemanticCache(t *testing.T) {
+	ctx := context.Background()
+	cache := NewSemanticCache(SemanticCacheOptions{Threshold: 0.9, Models: []string{Gpt4o}})
+	g, srv := initPlugin(t, func(p *AzureOpenAI) { p.SemanticCache = cache })
+	srv.OnChat(func(azopenaitest.Request) azopenaitest.ChatReply {
+		return azopenaitest.ChatReply{Content: "Paris"}
+	})
+	vectors := map[string][]float32{
+		"What is the capital of France?":   {1, 0, 0},
+		"Which city is France's capital?":  {0.98, 0.2, 0},
+		"How tall is the Eiffel Tower?":    {0, 1, 0},
+		"Summarize the history of France.": {0.7, 0, 0.7},
+	}
+	srv.OnEmbed(func(input string) []float32 { return vectors[input] })
+
+	chatRequests := func() int {
+		n := 0
+		for _, r := range srv.Requests() {
+			if r.Endpoint == azopenaitest.EndpointChat {
+				n++
+			}
+		}
+		return n
+	}
+	ask := func(model, prompt string, cb ai.ModelStreamCallback) *ai.ModelResponse {
+		t.Helper()
+		resp, err := Model(g, model).Generate(ctx, &ai.ModelRequest{
+			Messages: []*ai.Message{ai.NewSystemTextMessage("Be brief."), ai.NewUserTextMessage(prompt)},
+		}, cb)
+		if err != nil {
+			t.Fatalf("Generate() error: %v", err)
+		}
+		return resp
+	}
+
+	if md := ResponseMetadataFrom(ask(Gpt4o, "What is the capital of France?", nil)); md.SemanticCache != nil {
+		t.Error("First request should miss the cache")
+	}
+
+	var chunks []string
+	hit := ask(Gpt4o, "Which city is France's capital?", func(ctx context.Context, c *ai.ModelResponseChunk) error {
+		chunks = append(chunks, c.Text())
+		return nil
+	})
+	md := ResponseMetadataFrom(hit)
+	if md.SemanticCache == nil || md.SemanticCache.Prompt != "What is the capital of France?" || !md.Cached {
+		t.Fatalf("Expected a semantic cache hit, got %+v", md)
+	}
+	if md.SemanticCache.Similarity < 0.9 || md.SemanticCache.Similarity > 1 {
+		t.Errorf("Similarity = %v", md.SemanticCache.Similarity)
+	}
+	if len(chunks) != 1 || chunks[0] != "Paris" {
+		t.Errorf("Cached response should be streamed, got %q", chunks)
+	}
+	if n := chatRequests(); n != 1 {
+		t.Errorf("Expected 1 chat request, got %d", n)
+	}
+
+	// Dissimilar prompts and other models go to the service
+	ask(Gpt4o, "How tall is the Eiffel Tower?", nil)
+	ask(Gpt4o, "Summarize the history of France.", nil)
+	ask(Gpt4oMini, "What is the capital of France?", nil)
+	if n := chatRequests(); n != 4 {
+		t.Errorf("Expected 4 chat requests, got %d", n)
+	}
+
+	if n := cache.InvalidatePrompt("What is the capital of France?"); n != 1 {
+		t.Errorf("InvalidatePrompt() removed %d entries, want 1", n)
+	}
+	ask(Gpt4o, "Which city is France's capital?", nil)
+	if n := chatRequests(); n != 5 {
+		t.Errorf("Invalidated prompts should miss, got %d chat requests", n)
+	}
+
+	if n := cache.InvalidateModel(Gpt4o); n != 3 {
+		t.Errorf("InvalidateModel() removed %d entries, want 3", n)
+	}
+	cache.Clear()
+	if cache.Len() != 0 {
+		t.Errorf("Len() = %d after Clear()", cache.Len())
+	}
+}
+
+func TestSemanticCache_Scope(t *testing.T) {
+	cache := NewSemanticCache(SemanticCacheOptions{Threshold: 0.9})
+	g, srv := initPlugin(t, func(p *AzureOpenAI) { p.SemanticCache = cache })
+	srv.OnChat(func(azopenaitest.Request) azopenaitest.ChatReply {
+		return azopenaitest.ChatReply{Content: "Paris"}
+	})
+	srv.OnEmbed(func(string) []float32 { return []float32{1, 0} })
+
+	ask := func(system string, temperature float32) bool {
+		t.Helper()
+		resp, err := Model(g, Gpt4o).Generate(context.Background(), &ai.ModelRequest{
+			Messages: []*ai.Message{ai.NewSystemTextMessage(system), ai.NewUserTextMessage("What is the capital?")},
+			Config:   &OpenAIConfig{Temperature: to.Ptr(temperature)},
+		}, nil)
+		if err != nil {
+			t.Fatalf("Generate() error: %v", err)
+		}
+		return ResponseMetadataFrom(resp).SemanticCache != nil
+	}
+
+	tests := []struct {
+		name        string
+		system      string
+		temperature float32
+		hit         bool
+	}{
+		{name: "first request", system: "You know France.", temperature: 0.5},
+		{name: "same context", system: "You know France.", temperature: 0.5, hit: true},
+		{name: "other system prompt", system: "You know Italy.", temperature: 0.5},
+		{name: "other settings", system: "You know France.", temperature: 1},
+	}
+	for _, tt := range tests {
+		if hit := ask(tt.system, tt.temperature); hit != tt.hit {
+			t.Errorf("%s: hit = %v, want %v", tt.name, hit, tt.hit)
+		}
+	}
+}
+
+func TestSemanticCache_MaxEntries(t *testing.T) {
+	c := NewSemanticCache(SemanticCacheOptions{MaxEntries: 2})
+	for _, p := range []string{"a", "b", "c"} {
+		c.add(&semanticEntry{scope: "s", prompt: p, vector: []float32{1}})
+	}
+	if c.Len() != 2 {
+		t.Fatalf("Len() = %d, want 2", c.Len())
+	}
+	if n := c.InvalidatePrompt("a"); n != 0 {
+		t.Error("The oldest entry should have been evicted")
+	}
+}
+
+func TestFinalUserTurn(t *testing.T) {
+	msgs := []*ai.Message{
+		ai.NewUserTextMessage("first"),
+		ai.NewModelTextMessage("reply"),
+		ai.NewUserTextMessage("  second  "),
+		ai.NewModelTextMessage("reply"),
+	}
+	if got := finalUserTurn(msgs); got != "second" {
+		t.Errorf("finalUserTurn() = %q, want %q", got, "second")
+	}
+	if got := finalUserTurn(nil); got != "" {
+		t.Errorf("finalUserTurn(nil) = %q", got)
+	}
+}
+
+func TestSemanticCache_UnknownEmbedder(t *testing.T) {
+	ctx := context.Background()
+	g, err := genkit.Init(ctx)
+	if err != nil {
+		t.Fatalf("Failed to initialize Genkit: %v", err)
+	}
+	plugin := &AzureOpenAI{
+		Client:        failingClient{},
+		SemanticCache: NewSemanticCache(SemanticCacheOptions{Embedder: "unknown-embedder"}),
+	}
+	if err := plugin.Init(ctx, g); err == nil || !strings.Contains(err.Error(), `"unknown-embedder" is not defined`) {
+		t.Fatalf("Expected an unknown embedder error, got %v", err)
+	}
+	if plugin.initted {
+		t.Error("A failed Init should leave the plugin uninitialized")
+	}
+	if genkit.LookupModel(g, azureOpenAIProvider, Gpt4o) != nil {
+		t.Error("A failed Init should not register models")
+	}
+}
@@ -0,0 +1,316 @@
+// Copyright 2025 herosizy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package azopenai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/firebase/genkit/go/ai"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/HeroSizy/genkit-go-plugins/azopenai"
+
+// GenAI semantic convention attribute keys and values.
+const (
+	attrSystem              = "gen_ai.system"
+	attrOperationName       = "gen_ai.operation.name"
+	attrRequestModel        = "gen_ai.request.model"
+	attrRequestDeployment   = "gen_ai.azure.deployment"
+	attrRequestMaxTokens    = "gen_ai.request.max_tokens"
+	attrRequestTemperature  = "gen_ai.request.temperature"
+	attrRequestTopP         = "gen_ai.request.top_p"
+	attrResponseID          = "gen_ai.response.id"
+	attrResponseModel       = "gen_ai.response.model"
+	attrResponseFinish      = "gen_ai.response.finish_reasons"
+	attrUsageInputTokens    = "gen_ai.usage.input_tokens"
+	attrUsageOutputTokens   = "gen_ai.usage.output_tokens"
+	attrUsageCachedTokens   = "gen_ai.usage.cache_read.input_tokens"
+	attrTokenType           = "gen_ai.token.type"
+	attrHedgeWinner         = "az.ai.openai.hedge.winner"
+	attrHedgeLoser          = "az.ai.openai.hedge.loser"
+	attrPriority            = "az.ai.openai.priority"
+	attrErrorType           = "error.type"
+	attrPrompt              = "gen_ai.prompt"
+	attrCompletion          = "gen_ai.completion"
+	eventPrompt             = "gen_ai.content.prompt"
+	eventCompletion         = "gen_ai.content.completion"
+	systemAzureOpenAI       = "az.ai.openai"
+	operationChat           = "chat"
+	operationEmbeddings     = "embeddings"
+	metricOperationDuration = "gen_ai.client.operation.duration"
+	metricTokenUsage        = "gen_ai.client.token.usage"
+	metricTimeToFirstChunk  = "gen_ai.client.operation.time_to_first_chunk"
+	metricQueueDepth        = "az.ai.openai.client.queue.depth"
+	metricQueueWait         = "az.ai.openai.client.queue.wait_time"
+	metricActiveRequests    = "az.ai.openai.client.active_requests"
+)
+
+// TelemetryOptions configures the OpenTelemetry spans and metrics emitted by the plugin.
+// Spans and metrics are always recorded through the configured (or global) providers;
+// prompt and completion content is only recorded when CaptureContent is set.
+type TelemetryOptions struct {
+	TracerProvider trace.TracerProvider // Tracer provider. Defaults to the global provider.
+	MeterProvider  metric.MeterProvider // Meter provider. Defaults to the global provider.
+	CaptureContent bool                 // Record prompts and completions as span events
+}
+
+// telemetry records spans and metrics for model and embedder calls.
+type telemetry struct {
+	tracer         trace.Tracer
+	captureContent bool
+	duration       metric.Float64Histogram
+	tokenUsage     metric.Int64Histogram
+	firstChunk     metric.Float64Histogram
+	queueDepth     metric.Int64UpDownCounter
+	queueWait      metric.Float64Histogram
+	activeRequests metric.Int64UpDownCounter
+}
+
+// newTelemetry creates the instruments described by opts. A nil opts uses the global providers.
+func newTelemetry(opts *TelemetryOptions) *telemetry {
+	if opts == nil {
+		opts = &TelemetryOptions{}
+	}
+	tp := opts.TracerProvider
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	mp := opts.MeterProvider
+	if mp == nil {
+		mp = otel.GetMeterProvider()
+	}
+	meter := mp.Meter(instrumentationName)
+
+	t := &telemetry{
+		tracer:         tp.Tracer(instrumentationName),
+		captureContent: opts.CaptureContent,
+	}
+	// Instrument creation only fails for invalid names, so errors are ignored
+	// and the no-op instruments returned alongside them are used instead.
+	t.duration, _ = meter.Float64Histogram(metricOperationDuration,
+		metric.WithDescription("Duration of GenAI client operations"),
+		metric.WithUnit("s"))
+	t.tokenUsage, _ = meter.Int64Histogram(metricTokenUsage,
+		metric.WithDescription("Number of input and output tokens used"),
+		metric.WithUnit("{token}"))
+	t.firstChunk, _ = meter.Float64Histogram(metricTimeToFirstChunk,
+		metric.WithDescription("Time to receive the first chunk of a streaming response"),
+		metric.WithUnit("s"))
+	t.queueDepth, _ = meter.Int64UpDownCounter(metricQueueDepth,
+		metric.WithDescription("Number of requests waiting for a deployment's concurrency slot"),
+		metric.WithUnit("{request}"))
+	t.queueWait, _ = meter.Float64Histogram(metricQueueWait,
+		metric.WithDescription("Time queued requests waited for a deployment's concurrency slot"),
+		metric.WithUnit("s"))
+	t.activeRequests, _ = meter.Int64UpDownCounter(metricActiveRequests,
+		metric.WithDescription("Number of requests holding a deployment's concurrency slot"),
+		metric.WithUnit("{request}"))
+	return t
+}
+
+// operation is an in-flight instrumented call.
+type operation struct {
+	t          *telemetry
+	span       trace.Span
+	start      time.Time
+	firstChunk time.Time
+	attrs      []attribute.KeyValue // Attributes shared by spans and metrics
+}
+
+// startChat starts a span for a chat completion request.
+func (t *telemetry) startChat(ctx context.Context, model string, cfg OpenAIConfig, mr *ai.ModelRequest) (context.Context, *operation) {
+	op := t.start(ctx, operationChat, model, cfg.DeploymentName)
+	ctx = trace.ContextWithSpan(ctx, op.span)
+
+	var attrs []attribute.KeyValue
+	if cfg.MaxTokens != nil {
+		attrs = append(attrs, attribute.Int(attrRequestMaxTokens, int(*cfg.MaxTokens)))
+	}
+	if cfg.Temperature != nil {
+		attrs = append(attrs, attribute.Float64(attrRequestTemperature, float64(*cfg.Temperature)))
+	}
+	if cfg.TopP != nil {
+		attrs = append(attrs, attribute.Float64(attrRequestTopP, float64(*cfg.TopP)))
+	}
+	op.span.SetAttributes(attrs...)
+
+	if t.captureContent {
+		if b, err := json.Marshal(mr.Messages); err == nil {
+			op.span.AddEvent(eventPrompt, trace.WithAttributes(attribute.String(attrPrompt, string(b))))
+		}
+	}
+	return ctx, op
+}
+
+// startEmbeddings starts a span for an embeddings request.
+func (t *telemetry) startEmbeddings(ctx context.Context, model, deployment string) (context.Context, *operation) {
+	op := t.start(ctx, operationEmbeddings, model, deployment)
+	return trace.ContextWithSpan(ctx, op.span), op
+}
+
+func (t *telemetry) start(ctx context.Context, operationName, model, deployment string) *operation {
+	attrs := []attribute.KeyValue{
+		attribute.String(attrSystem, systemAzureOpenAI),
+		attribute.String(attrOperationName, operationName),
+		attribute.String(attrRequestModel, model),
+		attribute.String(attrRequestDeployment, deployment),
+	}
+	_, span := t.tracer.Start(ctx, operationName+" "+model,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...))
+	return &operation{t: t, span: span, start: time.Now(), attrs: attrs}
+}
+
+// wrapCallback records the time to first chunk of a streaming response.
+func (op *operation) wrapCallback(cb ai.ModelStreamCallback) ai.ModelStreamCallback {
+	if cb == nil {
+		return nil
+	}
+	return func(ctx context.Context, chunk *ai.ModelResponseChunk) error {
+		if op.firstChunk.IsZero() {
+			op.firstChunk = time.Now()
+			op.t.firstChunk.Record(ctx, op.firstChunk.Sub(op.start).Seconds(), metric.WithAttributes(op.attrs...))
+		}
+		return cb(ctx, chunk)
+	}
+}
+
+// endChat ends a chat span, recording the response or error.
+func (op *operation) endChat(ctx context.Context, resp *ai.ModelResponse, err error) {
+	if err != nil {
+		op.end(ctx, err)
+		return
+	}
+
+	if md := ResponseMetadataFrom(resp); md != nil {
+		if md.ID != "" {
+			op.span.SetAttributes(attribute.String(attrResponseID, md.ID))
+		}
+		if md.Model != "" {
+			op.span.SetAttributes(attribute.String(attrResponseModel, md.Model))
+		}
+	}
+	if resp.FinishReason != "" {
+		op.span.SetAttributes(attribute.StringSlice(attrResponseFinish, []string{string(resp.FinishReason)}))
+	}
+	if resp.Usage != nil {
+		op.recordUsage(ctx, resp.Usage.InputTokens, resp.Usage.OutputTokens)
+		if resp.Usage.CachedContentTokens > 0 {
+			op.span.SetAttributes(attribute.Int(attrUsageCachedTokens, resp.Usage.CachedContentTokens))
+		}
+	}
+	if op.t.captureContent && resp.Message != nil {
+		if b, err := json.Marshal(resp.Message); err == nil {
+			op.span.AddEvent(eventCompletion, trace.WithAttributes(attribute.String(attrCompletion, string(b))))
+		}
+	}
+	op.end(ctx, nil)
+}
+
+// recordHedge records which request of a hedged call answered, and counts the
+// tokens of the cancelled one in the token usage metric.
+func (op *operation) recordHedge(ctx context.Context, winner string, loser *ai.GenerationUsage) {
+	op.span.SetAttributes(attribute.String(attrHedgeWinner, winner))
+	if loser == nil {
+		return
+	}
+	attrs := append(op.attrs, attribute.Bool(attrHedgeLoser, true))
+	op.t.tokenUsage.Record(ctx, int64(loser.InputTokens),
+		metric.WithAttributes(append(attrs, attribute.String(attrTokenType, "input"))...))
+	if loser.OutputTokens > 0 {
+		op.t.tokenUsage.Record(ctx, int64(loser.OutputTokens),
+			metric.WithAttributes(append(attrs, attribute.String(attrTokenType, "output"))...))
+	}
+}
+
+// endEmbeddings ends an embeddings span, recording the input token usage or error.
+func (op *operation) endEmbeddings(ctx context.Context, inputTokens int, err error) {
+	if err == nil {
+		op.recordUsage(ctx, inputTokens, 0)
+	}
+	op.end(ctx, err)
+}
+
+func (op *operation) recordUsage(ctx context.Context, inputTokens, outputTokens int) {
+	op.span.SetAttributes(
+		attribute.Int(attrUsageInputTokens, inputTokens),
+		attribute.Int(attrUsageOutputTokens, outputTokens),
+	)
+	op.t.tokenUsage.Record(ctx, int64(inputTokens),
+		metric.WithAttributes(append(op.attrs, attribute.String(attrTokenType, "input"))...))
+	if outputTokens > 0 {
+		op.t.tokenUsage.Record(ctx, int64(outputTokens),
+			metric.WithAttributes(append(op.attrs, attribute.String(attrTokenType, "output"))...))
+	}
+}
+
+func (op *operation) end(ctx context.Context, err error) {
+	attrs := op.attrs
+	if err != nil {
+		errType := errorType(err)
+		attrs = append(attrs, attribute.String(attrErrorType, errType))
+		op.span.SetAttributes(attribute.String(attrErrorType, errType))
+		op.span.RecordError(err)
+		op.span.SetStatus(codes.Error, err.Error())
+	}
+	op.t.duration.Record(ctx, time.Since(op.start).Seconds(), metric.WithAttributes(attrs...))
+	op.span.End()
+}
+
+// errorType returns a low-cardinality description of err for the error.type attribute.
+func errorType(err error) string {
+	var (
+		rateLimit     *RateLimitError
+		contentFilter *ContentFilterError
+		notFound      *DeploymentNotFoundError
+		contextLength *ContextLengthError
+		auth          *AuthError
+		queueFull     *QueueFullError
+	)
+	switch {
+	case errors.As(err, &rateLimit):
+		return "rate_limit"
+	case errors.As(err, &contentFilter):
+		return "content_filter"
+	case errors.As(err, &notFound):
+		return "deployment_not_found"
+	case errors.As(err, &contextLength):
+		return "context_length_exceeded"
+	case errors.As(err, &auth):
+		return "auth"
+	case errors.As(err, &queueFull):
+		return "queue_full"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	default:
+		return "_OTHER"
+	}
+}
@@ -0,0 +1,242 @@
+// Copyright 2025 herosizy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package azopenai
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+const simpleChatCompletion = `{
+	"id": "chatcmpl-3",
+	"object": "chat.completion",
+	"created": 1700000000,
+	"model": "gpt-4o-2024-08-06",
+	"choices": [{"index": 0, "finish_reason": "stop", "message": {"role": "assistant", "content": "Hi there"}}],
+	"usage": {"prompt_tokens": 12, "completion_tokens": 3, "total_tokens": 15}
+}`
+
+// newTestTelemetry returns telemetry recording into an in-memory span recorder and metric reader
+func newTestTelemetry(captureContent bool) (*telemetry, *tracetest.SpanRecorder, *sdkmetric.ManualReader) {
+	spans := tracetest.NewSpanRecorder()
+	reader := sdkmetric.NewManualReader()
+	tel := newTelemetry(&TelemetryOptions{
+		TracerProvider: sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)),
+		MeterProvider:  sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)),
+		CaptureContent: captureContent,
+	})
+	return tel, spans, reader
+}
+
+func spanAttributes(attrs []attribute.KeyValue) map[string]attribute.Value {
+	m := make(map[string]attribute.Value, len(attrs))
+	for _, kv := range attrs {
+		m[string(kv.Key)] = kv.Value
+	}
+	return m
+}
+
+func collectMetricNames(t *testing.T, reader *sdkmetric.ManualReader) map[string]bool {
+	t.Helper()
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("Failed to collect metrics: %v", err)
+	}
+	names := map[string]bool{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			names[m.Name] = true
+		}
+	}
+	return names
+}
+
+func TestTelemetry_Chat(t *testing.T) {
+	ctx := context.Background()
+	g, err := genkit.Init(ctx)
+	if err != nil {
+		t.Fatalf("Failed to initialize Genkit: %v", err)
+	}
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, simpleChatCompletion)
+	})
+	tel, spans, reader := newTestTelemetry(true)
+	model := defineModel(g, handlerConfig{client: client, telemetry: tel}, Gpt4o, ai.ModelInfo{Supports: &MultimodalModel})
+
+	resp, err := model.Generate(ctx, &ai.ModelRequest{
+		Messages: []*ai.Message{ai.NewUserTextMessage("Hello")},
+		Config:   &OpenAIConfig{DeploymentName: "my-gpt4o", Temperature: to.Ptr(float32(0.5))},
+	}, nil)
+	if err != nil {
+		t.Fatalf("Generate() error: %v", err)
+	}
+	if resp.Usage == nil || resp.Usage.InputTokens != 12 || resp.Usage.OutputTokens != 3 {
+		t.Errorf("Unexpected usage %+v", resp.Usage)
+	}
+
+	ended := spans.Ended()
+	if len(ended) != 1 {
+		t.Fatalf("Expected 1 span, got %d", len(ended))
+	}
+	span := ended[0]
+	if span.Name() != "chat gpt-4o" {
+		t.Errorf("Span name = %q, want %q", span.Name(), "chat gpt-4o")
+	}
+	attrs := spanAttributes(span.Attributes())
+	expected := map[string]any{
+		attrSystem:            systemAzureOpenAI,
+		attrOperationName:     operationChat,
+		attrRequestModel:      Gpt4o,
+		attrRequestDeployment: "my-gpt4o",
+		attrResponseID:        "chatcmpl-3",
+		attrResponseModel:     "gpt-4o-2024-08-06",
+		attrUsageInputTokens:  int64(12),
+		attrUsageOutputTokens: int64(3),
+	}
+	for k, want := range expected {
+		if got := attrs[k].AsInterface(); got != want {
+			t.Errorf("Attribute %s = %v, want %v", k, got, want)
+		}
+	}
+	if got := attrs[attrResponseFinish].AsStringSlice(); len(got) != 1 || got[0] != "stop" {
+		t.Errorf("Finish reasons = %v, want [stop]", got)
+	}
+
+	var events []string
+	for _, e := range span.Events() {
+		events = append(events, e.Name)
+	}
+	if strings.Join(events, ",") != eventPrompt+","+eventCompletion {
+		t.Errorf("Expected prompt and completion events, got %v", events)
+	}
+
+	names := collectMetricNames(t, reader)
+	for _, name := range []string{metricOperationDuration, metricTokenUsage} {
+		if !names[name] {
+			t.Errorf("Expected metric %s to be recorded", name)
+		}
+	}
+}
+
+func TestTelemetry_StreamingTimeToFirstChunk(t *testing.T) {
+	ctx := context.Background()
+	g, err := genkit.Init(ctx)
+	if err != nil {
+		t.Fatalf("Failed to initialize Genkit: %v", err)
+	}
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, `data: {"id":"chatcmpl-4","model":"gpt-4o","created":0,"choices":[{"index":0,"delta":{"content":"Hi"}}]}`+"\n\n")
+		fmt.Fprint(w, `data: {"id":"chatcmpl-4","model":"gpt-4o","created":0,"choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`+"\n\n")
+		fmt.Fprint(w, `data: {"id":"chatcmpl-4","model":"gpt-4o","created":0,"choices":[],"usage":{"prompt_tokens":5,"completion_tokens":1,"total_tokens":6}}`+"\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	})
+	tel, spans, reader := newTestTelemetry(false)
+	model := defineModel(g, handlerConfig{client: client, telemetry: tel}, Gpt4o, ai.ModelInfo{Supports: &MultimodalModel})
+
+	resp, err := model.Generate(ctx, &ai.ModelRequest{
+		Messages: []*ai.Message{ai.NewUserTextMessage("Hello")},
+	}, func(ctx context.Context, chunk *ai.ModelResponseChunk) error { return nil })
+	if err != nil {
+		t.Fatalf("Generate() error: %v", err)
+	}
+	if resp.Usage == nil || resp.Usage.TotalTokens != 6 {
+		t.Errorf("Expected usage from the final stream chunk, got %+v", resp.Usage)
+	}
+
+	span := spans.Ended()[0]
+	if len(span.Events()) != 0 {
+		t.Error("Content should not be captured unless enabled")
+	}
+	if !collectMetricNames(t, reader)[metricTimeToFirstChunk] {
+		t.Errorf("Expected metric %s to be recorded", metricTimeToFirstChunk)
+	}
+}
+
+func TestTelemetry_Error(t *testing.T) {
+	ctx := context.Background()
+	g, err := genkit.Init(ctx)
+	if err != nil {
+		t.Fatalf("Failed to initialize Genkit: %v", err)
+	}
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprint(w, `{"error":{"code":"429","message":"Rate limit reached"}}`)
+	})
+	tel, spans, _ := newTestTelemetry(false)
+	model := defineModel(g, handlerConfig{client: client, telemetry: tel}, Gpt4o, ai.ModelInfo{Supports: &MultimodalModel})
+
+	_, err = model.Generate(ctx, &ai.ModelRequest{
+		Messages: []*ai.Message{ai.NewUserTextMessage("Hello")},
+	}, nil)
+	if err == nil {
+		t.Fatal("Expected error")
+	}
+
+	span := spans.Ended()[0]
+	if span.Status().Code != codes.Error {
+		t.Errorf("Span status = %v, want error", span.Status().Code)
+	}
+	if got := spanAttributes(span.Attributes())[attrErrorType].AsString(); got != "rate_limit" {
+		t.Errorf("error.type = %q, want rate_limit", got)
+	}
+}
+
+func TestTelemetry_Embeddings(t *testing.T) {
+	ctx := context.Background()
+	g, err := genkit.Init(ctx)
+	if err != nil {
+		t.Fatalf("Failed to initialize Genkit: %v", err)
+	}
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"object":"list","model":"text-embedding-3-small","data":[{"object":"embedding","index":0,"embedding":[0.1,0.2]}],"usage":{"prompt_tokens":4,"total_tokens":4}}`)
+	})
+	tel, spans, _ := newTestTelemetry(false)
+	embedder := defineEmbedder(g, handlerConfig{client: client, telemetry: tel}, TextEmbedding3Small)
+
+	if _, err := embedder.Embed(ctx, &ai.EmbedRequest{Input: []*ai.Document{ai.DocumentFromText("hello", nil)}}); err != nil {
+		t.Fatalf("Embed() error: %v", err)
+	}
+
+	span := spans.Ended()[0]
+	if span.Name() != "embeddings text-embedding-3-small" {
+		t.Errorf("Span name = %q", span.Name())
+	}
+	if got := spanAttributes(span.Attributes())[attrUsageInputTokens].AsInt64(); got != 4 {
+		t.Errorf("Input tokens = %d, want 4", got)
+	}
+}
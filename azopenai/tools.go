@@ -0,0 +1,206 @@
+// Copyright 2025 herosizy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package azopenai
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/ai/azopenai"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/firebase/genkit/go/ai"
+)
+
+// resolveToolChoice returns the tool choice for a request: the configured
+// value, else the Genkit request's. Choices other than "auto", "none" and
+// "required" must name one of the request's tools.
+func resolveToolChoice(mr *ai.ModelRequest, cfg OpenAIConfig) (string, error) {
+	choice := cfg.ToolChoice
+	if choice == "" {
+		choice = string(mr.ToolChoice)
+	}
+	switch choice {
+	case "", string(ai.ToolChoiceAuto), string(ai.ToolChoiceNone):
+		return choice, nil
+	}
+	if len(mr.Tools) == 0 {
+		return "", fmt.Errorf("tool choice %q requires tools", choice)
+	}
+	if choice != string(ai.ToolChoiceRequired) && !slices.ContainsFunc(mr.Tools, func(t *ai.ToolDefinition) bool { return t.Name == choice }) {
+		return "", fmt.Errorf("tool choice %q does not match any tool", choice)
+	}
+	return choice, nil
+}
+
+// convertToolChoice converts a resolved tool choice to Azure OpenAI format
+func convertToolChoice(choice string) *azopenai.ChatCompletionsToolChoice {
+	switch choice {
+	case "":
+		return nil
+	case string(ai.ToolChoiceAuto):
+		return azopenai.ChatCompletionsToolChoiceAuto
+	case string(ai.ToolChoiceNone):
+		return azopenai.ChatCompletionsToolChoiceNone
+	case string(ai.ToolChoiceRequired):
+		// The SDK has no constructor for "required", but decodes it
+		var required azopenai.ChatCompletionsToolChoice
+		_ = required.UnmarshalJSON([]byte(`"required"`))
+		return &required
+	default:
+		return azopenai.NewChatCompletionsToolChoice(azopenai.ChatCompletionsToolChoiceFunction{Name: choice})
+	}
+}
+
+// toolParameters returns the normalized JSON input schema of a tool
+func toolParameters(tool *ai.ToolDefinition, strict bool) ([]byte, error) {
+	b, err := json.Marshal(tool.InputSchema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal tool parameters: %w", err)
+	}
+	params, err := normalizeToolSchema(b, strict)
+	if err != nil {
+		return nil, fmt.Errorf("tool %q has an unsupported input schema: %w", tool.Name, err)
+	}
+	return params, nil
+}
+
+// convertToolRequests converts the tool requests of a model message to tool calls
+func convertToolRequests(msg *ai.Message) ([]azopenai.ChatCompletionsToolCallClassification, error) {
+	var calls []azopenai.ChatCompletionsToolCallClassification
+	for _, part := range msg.Content {
+		if !part.IsToolRequest() {
+			continue
+		}
+		args, err := json.Marshal(part.ToolRequest.Input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal tool request: %w", err)
+		}
+		calls = append(calls, &azopenai.ChatCompletionsFunctionToolCall{
+			ID:   to.Ptr(toolCallID(part.ToolRequest.Ref, part.ToolRequest.Name)),
+			Type: to.Ptr("function"),
+			Function: &azopenai.FunctionCall{
+				Name:      to.Ptr(part.ToolRequest.Name),
+				Arguments: to.Ptr(string(args)),
+			},
+		})
+	}
+	return calls, nil
+}
+
+// convertToolResponse converts a tool response part to a tool message
+func convertToolResponse(r *ai.ToolResponse) (*azopenai.ChatRequestToolMessage, error) {
+	output, ok := r.Output.(string)
+	if !ok {
+		b, err := json.Marshal(r.Output)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal tool response: %w", err)
+		}
+		output = string(b)
+	}
+	return &azopenai.ChatRequestToolMessage{
+		Content:    azopenai.NewChatRequestToolMessageContent(output),
+		ToolCallID: to.Ptr(toolCallID(r.Ref, r.Name)),
+	}, nil
+}
+
+// convertToolCalls converts tool calls in a response to tool request parts
+func convertToolCalls(calls []azopenai.ChatCompletionsToolCallClassification) []*ai.Part {
+	var parts []*ai.Part
+	for _, call := range calls {
+		fc, ok := call.(*azopenai.ChatCompletionsFunctionToolCall)
+		if !ok || fc.Function == nil {
+			continue
+		}
+		parts = append(parts, ai.NewToolRequestPart(&ai.ToolRequest{
+			Name:  deref(fc.Function.Name),
+			Ref:   deref(fc.ID),
+			Input: toolArguments(deref(fc.Function.Arguments)),
+		}))
+	}
+	return parts
+}
+
+// toolCallAccumulator assembles tool calls from streamed deltas. The SDK drops
+// the delta index, so a delta with an ID starts a new call and later deltas
+// extend the most recent one.
+type toolCallAccumulator struct {
+	calls []*streamedToolCall
+}
+
+type streamedToolCall struct {
+	id, name string
+	args     strings.Builder
+}
+
+func (a *toolCallAccumulator) add(calls []azopenai.ChatCompletionsToolCallClassification) {
+	for _, call := range calls {
+		fc, ok := call.(*azopenai.ChatCompletionsFunctionToolCall)
+		if !ok || fc.Function == nil {
+			continue
+		}
+		if id := deref(fc.ID); id != "" || len(a.calls) == 0 {
+			a.calls = append(a.calls, &streamedToolCall{id: id})
+		}
+		last := a.calls[len(a.calls)-1]
+		if name := deref(fc.Function.Name); name != "" {
+			last.name = name
+		}
+		last.args.WriteString(deref(fc.Function.Arguments))
+	}
+}
+
+// parts returns the accumulated tool calls as tool request parts
+func (a *toolCallAccumulator) parts() []*ai.Part {
+	parts := make([]*ai.Part, len(a.calls))
+	for i, c := range a.calls {
+		parts[i] = ai.NewToolRequestPart(&ai.ToolRequest{Name: c.name, Ref: c.id, Input: toolArguments(c.args.String())})
+	}
+	return parts
+}
+
+// toolCallID returns the call ID linking a tool request to its response,
+// falling back to the tool name when the reference is missing
+func toolCallID(ref, name string) string {
+	if ref != "" {
+		return ref
+	}
+	return name
+}
+
+// toolArguments decodes JSON function arguments, keeping them as a string if they are not valid JSON
+func toolArguments(args string) any {
+	var input any
+	if err := json.Unmarshal([]byte(args), &input); err != nil {
+		return args
+	}
+	return input
+}
+
+// messageContent returns the parts of a model message: the text, followed by
+// any tool requests. The text part is dropped when it is empty and tools were called.
+func messageContent(text string, toolParts []*ai.Part) []*ai.Part {
+	if text == "" && len(toolParts) > 0 {
+		return toolParts
+	}
+	return append([]*ai.Part{ai.NewTextPart(text)}, toolParts...)
+}
@@ -0,0 +1,195 @@
+// Copyright 2025 herosizy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package azopenai
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/HeroSizy/genkit-go-plugins/azopenai/azopenaitest"
+	"github.com/firebase/genkit/go/ai"
+)
+
+func weatherTool() *ai.ToolDefinition {
+	return &ai.ToolDefinition{Name: "weather", Description: "Current weather", InputSchema: map[string]any{"type": "object"}}
+}
+
+func TestToolChoice(t *testing.T) {
+	tools := []*ai.ToolDefinition{weatherTool()}
+	tests := []struct {
+		name        string
+		tools       []*ai.ToolDefinition
+		request     ai.ToolChoice
+		config      string
+		want        string
+		expectError bool
+	}{
+		{name: "unset", tools: tools, want: ""},
+		{name: "from request", tools: tools, request: ai.ToolChoiceRequired, want: `"required"`},
+		{name: "config overrides request", tools: tools, request: ai.ToolChoiceRequired, config: "none", want: `"none"`},
+		{name: "auto", tools: tools, config: "auto", want: `"auto"`},
+		{name: "named tool", tools: tools, config: "weather", want: `{"type":"function","function":{"name":"weather"}}`},
+		{name: "unknown tool", tools: tools, config: "stocks", expectError: true},
+		{name: "required without tools", request: ai.ToolChoiceRequired, expectError: true},
+		{name: "auto without tools", request: ai.ToolChoiceAuto, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mr := &ai.ModelRequest{
+				Messages:   []*ai.Message{ai.NewUserTextMessage("Hi")},
+				Tools:      tt.tools,
+				ToolChoice: tt.request,
+			}
+			options, err := convertToAzureOpenAIRequest(context.Background(), "", mr, OpenAIConfig{DeploymentName: "chat", ToolChoice: tt.config})
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			got := ""
+			if options.ToolChoice != nil {
+				b, err := json.Marshal(options.ToolChoice)
+				if err != nil {
+					t.Fatalf("Failed to marshal tool choice: %v", err)
+				}
+				got = string(b)
+			}
+			if got != tt.want {
+				t.Errorf("ToolChoice = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFakeServer_ToolCalls(t *testing.T) {
+	g, srv := initWithFakeServer(t)
+	srv.QueueChat(
+		azopenaitest.ChatReply{ToolCalls: []azopenaitest.ToolCall{{ID: "call_1", Name: "weather", Arguments: `{"city":"Oslo"}`}}},
+		azopenaitest.ChatReply{Content: "It is sunny."},
+	)
+
+	req := &ai.ModelRequest{
+		Messages: []*ai.Message{ai.NewUserTextMessage("Weather in Oslo?")},
+		Tools:    []*ai.ToolDefinition{weatherTool()},
+		Config:   &OpenAIConfig{DeploymentName: "chat", ToolChoice: "weather", ParallelToolCalls: to.Ptr(false)},
+	}
+	resp, err := Model(g, Gpt4o).Generate(context.Background(), req, nil)
+	if err != nil {
+		t.Fatalf("Generate() error: %v", err)
+	}
+	parts := resp.Message.Content
+	if len(parts) != 1 || !parts[0].IsToolRequest() {
+		t.Fatalf("Expected a tool request, got %+v", parts)
+	}
+	if tr := parts[0].ToolRequest; tr.Name != "weather" || tr.Ref != "call_1" || tr.Input.(map[string]any)["city"] != "Oslo" {
+		t.Errorf("Unexpected tool request %+v", tr)
+	}
+	body := srv.Requests()[0].JSON()
+	if choice := body["tool_choice"].(map[string]any); choice["function"].(map[string]any)["name"] != "weather" {
+		t.Errorf("Unexpected tool_choice %v", body["tool_choice"])
+	}
+	if body["parallel_tool_calls"] != false {
+		t.Errorf("parallel_tool_calls = %v, want false", body["parallel_tool_calls"])
+	}
+
+	req.Messages = append(req.Messages, resp.Message, ai.NewMessage(ai.RoleTool, nil, ai.NewToolResponsePart(&ai.ToolResponse{
+		Name: "weather", Ref: "call_1", Output: map[string]any{"sky": "clear"},
+	})))
+	req.Config = &OpenAIConfig{DeploymentName: "chat"}
+	if _, err := Model(g, Gpt4o).Generate(context.Background(), req, nil); err != nil {
+		t.Fatalf("Generate() error: %v", err)
+	}
+	messages := srv.Requests()[1].JSON()["messages"].([]any)
+	if len(messages) != 3 {
+		t.Fatalf("Expected 3 messages, got %v", messages)
+	}
+	assistant, tool := messages[1].(map[string]any), messages[2].(map[string]any)
+	call := assistant["tool_calls"].([]any)[0].(map[string]any)
+	if call["id"] != "call_1" || call["function"].(map[string]any)["arguments"] != `{"city":"Oslo"}` {
+		t.Errorf("Unexpected assistant tool call %v", call)
+	}
+	if tool["role"] != "tool" || tool["tool_call_id"] != "call_1" || tool["content"] != `{"sky":"clear"}` {
+		t.Errorf("Unexpected tool message %v", tool)
+	}
+}
+
+func TestFakeServer_StreamingToolCalls(t *testing.T) {
+	g, srv := initWithFakeServer(t)
+	srv.QueueChat(azopenaitest.ChatReply{ToolCalls: []azopenaitest.ToolCall{
+		{ID: "call_1", Name: "weather", Arguments: `{"city":"Oslo"}`},
+		{ID: "call_2", Name: "weather", Arguments: `{"city":"Bergen"}`},
+	}})
+
+	req := &ai.ModelRequest{
+		Messages:   []*ai.Message{ai.NewUserTextMessage("Weather in Oslo and Bergen?")},
+		Tools:      []*ai.ToolDefinition{weatherTool()},
+		ToolChoice: ai.ToolChoiceRequired,
+		Config:     &OpenAIConfig{DeploymentName: "chat"},
+	}
+	var streamed []*ai.Part
+	resp, err := Model(g, Gpt4o).Generate(context.Background(), req, func(ctx context.Context, c *ai.ModelResponseChunk) error {
+		streamed = append(streamed, c.Content...)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Generate() error: %v", err)
+	}
+	if len(streamed) != 2 || len(resp.Message.Content) != 2 {
+		t.Fatalf("Expected 2 tool requests, streamed %+v, got %+v", streamed, resp.Message.Content)
+	}
+	for i, city := range []string{"Oslo", "Bergen"} {
+		tr := resp.Message.Content[i].ToolRequest
+		if tr == nil || tr.Input.(map[string]any)["city"] != city {
+			t.Errorf("Tool request %d = %+v, want city %s", i, tr, city)
+		}
+	}
+	if body := srv.Requests()[0].JSON(); body["tool_choice"] != "required" {
+		t.Errorf("tool_choice = %v, want required", body["tool_choice"])
+	}
+}
+
+func TestResponses_ToolChoice(t *testing.T) {
+	g, srv := initPlugin(t, useResponses)
+	srv.QueueResponse(azopenaitest.ChatReply{ToolCalls: []azopenaitest.ToolCall{{ID: "call_1", Name: "weather", Arguments: `{}`}}})
+
+	req := &ai.ModelRequest{
+		Messages: []*ai.Message{ai.NewUserTextMessage("Weather?")},
+		Tools:    []*ai.ToolDefinition{weatherTool()},
+		Config:   &OpenAIConfig{ToolChoice: "weather", ParallelToolCalls: to.Ptr(true)},
+	}
+	if _, err := Model(g, Gpt4o).Generate(context.Background(), req, nil); err != nil {
+		t.Fatalf("Generate() error: %v", err)
+	}
+	body := srv.Requests()[0].JSON()
+	if choice := body["tool_choice"].(map[string]any); choice["type"] != "function" || choice["name"] != "weather" {
+		t.Errorf("Unexpected tool_choice %v", body["tool_choice"])
+	}
+	if body["parallel_tool_calls"] != true {
+		t.Errorf("parallel_tool_calls = %v, want true", body["parallel_tool_calls"])
+	}
+}
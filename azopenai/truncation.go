@@ -0,0 +1,230 @@
+// Copyright 2025 herosizy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package azopenai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/firebase/genkit/go/ai"
+)
+
+// TruncationStrategy selects how conversation history is shortened to fit the context window.
+type TruncationStrategy string
+
+const (
+	// TruncationDropOldest drops the oldest turns until the prompt fits the token budget.
+	TruncationDropOldest TruncationStrategy = "drop_oldest"
+	// TruncationKeepLastN keeps system messages and the last KeepLastN messages.
+	TruncationKeepLastN TruncationStrategy = "keep_last_n"
+	// TruncationSummarize replaces the turns dropped by TruncationDropOldest with a summary.
+	TruncationSummarize TruncationStrategy = "summarize"
+)
+
+// mediaTokenEstimate is the number of tokens assumed for a single media part.
+const mediaTokenEstimate = 765
+
+// Summarizer condenses the given conversation turns into a short piece of text.
+type Summarizer func(ctx context.Context, messages []*ai.Message) (string, error)
+
+// TruncationConfig configures automatic history truncation.
+// System messages are never dropped, and a model message that requests tools is
+// always kept or dropped together with the tool messages that answer it.
+type TruncationConfig struct {
+	Strategy       TruncationStrategy `json:"strategy,omitempty"`       // Truncation strategy to apply
+	KeepLastN      int                `json:"keepLastN,omitempty"`      // Number of trailing messages kept by TruncationKeepLastN
+	MaxInputTokens int                `json:"maxInputTokens,omitempty"` // Prompt token budget. Defaults to the model's context window minus the output reservation
+	Summarizer     Summarizer         `json:"-"`                        // Summarizer used by TruncationSummarize
+}
+
+// messageGroup is a run of messages that must be kept or dropped together.
+type messageGroup struct {
+	messages []*ai.Message
+	pinned   bool // System messages are pinned and never dropped
+	tokens   int
+}
+
+// truncateMessages applies the truncation strategy in cfg to msgs sent to model.
+// The input slice is never modified.
+func truncateMessages(ctx context.Context, model string, msgs []*ai.Message, cfg OpenAIConfig) ([]*ai.Message, error) {
+	tc := cfg.Truncation
+	groups := groupMessages(msgs)
+
+	switch tc.Strategy {
+	case TruncationKeepLastN:
+		if tc.KeepLastN <= 0 {
+			return nil, errors.New("truncation: keepLastN must be positive")
+		}
+		return flattenGroups(keepLastN(groups, tc.KeepLastN)), nil
+	case TruncationDropOldest, TruncationSummarize:
+		budget, err := truncationBudget(model, cfg)
+		if err != nil {
+			return nil, err
+		}
+		kept, dropped := dropOldest(groups, budget)
+		if tc.Strategy == TruncationDropOldest || len(dropped) == 0 {
+			return flattenGroups(kept), nil
+		}
+		if tc.Summarizer == nil {
+			return nil, errors.New("truncation: summarize strategy requires a Summarizer")
+		}
+		summary, err := tc.Summarizer(ctx, dropped)
+		if err != nil {
+			return nil, fmt.Errorf("truncation: failed to summarize history: %w", err)
+		}
+		return insertSummary(flattenGroups(kept), summary), nil
+	default:
+		return nil, fmt.Errorf("truncation: unsupported strategy %q", tc.Strategy)
+	}
+}
+
+// truncationBudget returns the prompt token budget for a request to model.
+// Limits are looked up by deployment name first, so a deployment named after a
+// catalog model overrides the model's limits, and then by model name.
+func truncationBudget(model string, cfg OpenAIConfig) (int, error) {
+	if cfg.Truncation.MaxInputTokens > 0 {
+		return cfg.Truncation.MaxInputTokens, nil
+	}
+	limits, ok := LookupModelLimits(cfg.DeploymentName)
+	if !ok {
+		limits, ok = LookupModelLimits(model)
+	}
+	if !ok {
+		return 0, fmt.Errorf("truncation: unknown context window for model %q, set maxInputTokens", model)
+	}
+	reserve := limits.MaxOutputTokens
+	if cfg.MaxTokens != nil {
+		reserve = int(*cfg.MaxTokens)
+	}
+	budget := limits.ContextWindow - reserve
+	if budget <= 0 {
+		return 0, fmt.Errorf("truncation: context window of %d tokens leaves no room for the prompt after reserving %d output tokens, lower maxTokens or set maxInputTokens", limits.ContextWindow, reserve)
+	}
+	return budget, nil
+}
+
+// groupMessages splits msgs into groups that are kept or dropped as a unit.
+func groupMessages(msgs []*ai.Message) []*messageGroup {
+	var groups []*messageGroup
+	for _, msg := range msgs {
+		if msg.Role == ai.RoleTool && len(groups) > 0 && !groups[len(groups)-1].pinned {
+			last := groups[len(groups)-1]
+			last.messages = append(last.messages, msg)
+			last.tokens += estimateTokens(msg)
+			continue
+		}
+		groups = append(groups, &messageGroup{
+			messages: []*ai.Message{msg},
+			pinned:   msg.Role == ai.RoleSystem,
+			tokens:   estimateTokens(msg),
+		})
+	}
+	return groups
+}
+
+// keepLastN keeps pinned groups and enough trailing groups to cover n messages.
+func keepLastN(groups []*messageGroup, n int) []*messageGroup {
+	keep := make([]bool, len(groups))
+	count := 0
+	for i := len(groups) - 1; i >= 0; i-- {
+		if groups[i].pinned {
+			keep[i] = true
+			continue
+		}
+		if count < n {
+			keep[i] = true
+			count += len(groups[i].messages)
+		}
+	}
+	kept := make([]*messageGroup, 0, len(groups))
+	for i, group := range groups {
+		if keep[i] {
+			kept = append(kept, group)
+		}
+	}
+	return kept
+}
+
+// dropOldest drops the oldest unpinned groups until the total fits budget.
+// The most recent unpinned group is always kept.
+func dropOldest(groups []*messageGroup, budget int) (kept []*messageGroup, dropped []*ai.Message) {
+	total := 0
+	lastUnpinned := -1
+	for i, group := range groups {
+		total += group.tokens
+		if !group.pinned {
+			lastUnpinned = i
+		}
+	}
+	for i, group := range groups {
+		if total > budget && !group.pinned && i != lastUnpinned {
+			total -= group.tokens
+			dropped = append(dropped, group.messages...)
+			continue
+		}
+		kept = append(kept, group)
+	}
+	return kept, dropped
+}
+
+// insertSummary places a system message carrying summary after the leading system messages.
+func insertSummary(msgs []*ai.Message, summary string) []*ai.Message {
+	i := 0
+	for i < len(msgs) && msgs[i].Role == ai.RoleSystem {
+		i++
+	}
+	out := make([]*ai.Message, 0, len(msgs)+1)
+	out = append(out, msgs[:i]...)
+	out = append(out, ai.NewSystemTextMessage("Summary of the earlier conversation:\n"+summary))
+	return append(out, msgs[i:]...)
+}
+
+// flattenGroups returns the messages of groups in order.
+func flattenGroups(groups []*messageGroup) []*ai.Message {
+	var msgs []*ai.Message
+	for _, group := range groups {
+		msgs = append(msgs, group.messages...)
+	}
+	return msgs
+}
+
+// estimateTokens approximates the prompt tokens used by msg.
+// It assumes roughly four characters per token plus a fixed per-message overhead.
+func estimateTokens(msg *ai.Message) int {
+	tokens := 4
+	for _, part := range msg.Content {
+		switch {
+		case part.IsMedia():
+			tokens += mediaTokenEstimate
+		case part.IsToolRequest():
+			b, _ := json.Marshal(part.ToolRequest)
+			tokens += len(b) / 4
+		case part.IsToolResponse():
+			b, _ := json.Marshal(part.ToolResponse)
+			tokens += len(b) / 4
+		default:
+			tokens += len(part.Text) / 4
+		}
+	}
+	return tokens
+}
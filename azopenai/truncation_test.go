@@ -0,0 +1,319 @@
+// Copyright 2025 herosizy
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package azopenai
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/firebase/genkit/go/ai"
+)
+
+// longText returns text estimated at roughly n tokens
+func longText(n int) string {
+	return strings.Repeat("abcd", n)
+}
+
+func toolConversation() []*ai.Message {
+	return []*ai.Message{
+		ai.NewSystemTextMessage("You are a helpful assistant"),
+		ai.NewUserTextMessage(longText(100)),
+		ai.NewModelMessage(ai.NewToolRequestPart(&ai.ToolRequest{Name: "lookup", Ref: "call_1"})),
+		ai.NewMessage(ai.RoleTool, nil, ai.NewToolResponsePart(&ai.ToolResponse{Name: "lookup", Ref: "call_1", Output: longText(100)})),
+		ai.NewModelTextMessage(longText(100)),
+		ai.NewUserTextMessage("latest question"),
+	}
+}
+
+func TestTruncateMessages_DropOldest(t *testing.T) {
+	msgs := toolConversation()
+	cfg := OpenAIConfig{
+		DeploymentName: "custom-deployment",
+		Truncation: &TruncationConfig{
+			Strategy:       TruncationDropOldest,
+			MaxInputTokens: 150,
+		},
+	}
+
+	got, err := truncateMessages(context.Background(), "", msgs, cfg)
+	if err != nil {
+		t.Fatalf("truncateMessages() error: %v", err)
+	}
+
+	if got[0].Role != ai.RoleSystem {
+		t.Errorf("System message should be kept first, got role %s", got[0].Role)
+	}
+	if got[len(got)-1] != msgs[len(msgs)-1] {
+		t.Error("Latest message should always be kept")
+	}
+	for _, msg := range got {
+		if msg.Role == ai.RoleTool {
+			t.Error("Tool response should have been dropped together with its request")
+		}
+	}
+	if len(msgs) != 6 {
+		t.Error("truncateMessages() should not modify the input slice")
+	}
+}
+
+func TestTruncateMessages_KeepsToolPairs(t *testing.T) {
+	msgs := toolConversation()[:4]
+	cfg := OpenAIConfig{
+		Truncation: &TruncationConfig{
+			Strategy:  TruncationKeepLastN,
+			KeepLastN: 1,
+		},
+	}
+
+	got, err := truncateMessages(context.Background(), "", msgs, cfg)
+	if err != nil {
+		t.Fatalf("truncateMessages() error: %v", err)
+	}
+
+	// System + tool request + tool response
+	if len(got) != 3 {
+		t.Fatalf("Expected 3 messages, got %d", len(got))
+	}
+	if got[1].Role != ai.RoleModel || got[2].Role != ai.RoleTool {
+		t.Errorf("Tool request/response pair should be kept intact, got roles %s, %s", got[1].Role, got[2].Role)
+	}
+}
+
+func TestTruncateMessages_KeepLastN(t *testing.T) {
+	msgs := toolConversation()
+	cfg := OpenAIConfig{
+		Truncation: &TruncationConfig{
+			Strategy:  TruncationKeepLastN,
+			KeepLastN: 2,
+		},
+	}
+
+	got, err := truncateMessages(context.Background(), "", msgs, cfg)
+	if err != nil {
+		t.Fatalf("truncateMessages() error: %v", err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("Expected system + 2 messages, got %d", len(got))
+	}
+	if got[0].Role != ai.RoleSystem {
+		t.Error("System message should be kept")
+	}
+
+	cfg.Truncation.KeepLastN = 0
+	if _, err := truncateMessages(context.Background(), "", msgs, cfg); err == nil {
+		t.Error("Expected error for non-positive keepLastN")
+	}
+}
+
+func TestTruncateMessages_Summarize(t *testing.T) {
+	msgs := toolConversation()
+	var summarized []*ai.Message
+	cfg := OpenAIConfig{
+		Truncation: &TruncationConfig{
+			Strategy:       TruncationSummarize,
+			MaxInputTokens: 150,
+			Summarizer: func(_ context.Context, dropped []*ai.Message) (string, error) {
+				summarized = dropped
+				return "user asked about a lookup", nil
+			},
+		},
+	}
+
+	got, err := truncateMessages(context.Background(), "", msgs, cfg)
+	if err != nil {
+		t.Fatalf("truncateMessages() error: %v", err)
+	}
+	if len(summarized) == 0 {
+		t.Fatal("Summarizer should receive the dropped messages")
+	}
+	if got[1].Role != ai.RoleSystem || !strings.Contains(got[1].Content[0].Text, "user asked about a lookup") {
+		t.Error("Summary should be inserted after the leading system messages")
+	}
+
+	cfg.Truncation.Summarizer = func(context.Context, []*ai.Message) (string, error) {
+		return "", errors.New("boom")
+	}
+	if _, err := truncateMessages(context.Background(), "", msgs, cfg); err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("Expected summarizer error, got %v", err)
+	}
+
+	cfg.Truncation.Summarizer = nil
+	if _, err := truncateMessages(context.Background(), "", msgs, cfg); err == nil {
+		t.Error("Expected error when Summarizer is missing")
+	}
+}
+
+func TestTruncationBudget(t *testing.T) {
+	tests := []struct {
+		name     string
+		model    string
+		cfg      OpenAIConfig
+		expected int
+		wantErr  string
+	}{
+		{
+			name:  "explicit budget",
+			model: Gpt4o,
+			cfg: OpenAIConfig{
+				DeploymentName: Gpt4o,
+				Truncation:     &TruncationConfig{MaxInputTokens: 1000},
+			},
+			expected: 1000,
+		},
+		{
+			name:  "catalog model reserves max output",
+			model: Gpt4,
+			cfg: OpenAIConfig{
+				DeploymentName: Gpt4,
+				Truncation:     &TruncationConfig{},
+			},
+			expected: 8192 - 4096,
+		},
+		{
+			name:  "catalog model reserves max tokens",
+			model: Gpt4,
+			cfg: OpenAIConfig{
+				DeploymentName: Gpt4,
+				MaxTokens:      to.Ptr(int32(192)),
+				Truncation:     &TruncationConfig{},
+			},
+			expected: 8000,
+		},
+		{
+			name:  "custom deployment uses the model limits",
+			model: Gpt4,
+			cfg: OpenAIConfig{
+				DeploymentName: "custom-deployment",
+				Truncation:     &TruncationConfig{},
+			},
+			expected: 8192 - 4096,
+		},
+		{
+			name:  "catalog deployment overrides the model limits",
+			model: Gpt4,
+			cfg: OpenAIConfig{
+				DeploymentName: Gpt4o,
+				MaxTokens:      to.Ptr(int32(8000)),
+				Truncation:     &TruncationConfig{},
+			},
+			expected: 128000 - 8000,
+		},
+		{
+			name:  "unknown model",
+			model: "custom-model",
+			cfg: OpenAIConfig{
+				DeploymentName: "custom-deployment",
+				Truncation:     &TruncationConfig{},
+			},
+			wantErr: "unknown context window",
+		},
+		{
+			name:  "completions model reserves max output",
+			model: Gpt35TurboInstruct,
+			cfg: OpenAIConfig{
+				DeploymentName: "instruct",
+				Truncation:     &TruncationConfig{},
+			},
+			expected: 4097 - 1024,
+		},
+		{
+			name:  "output reservation fills the context window",
+			model: Gpt4,
+			cfg: OpenAIConfig{
+				DeploymentName: "custom-deployment",
+				MaxTokens:      to.Ptr(int32(8192)),
+				Truncation:     &TruncationConfig{},
+			},
+			wantErr: "leaves no room",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := truncationBudget(tt.model, tt.cfg)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("truncationBudget() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("truncationBudget() error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("truncationBudget() = %d, want %d", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestConvertToAzureOpenAIRequest_Truncation(t *testing.T) {
+	request := &ai.ModelRequest{Messages: toolConversation()}
+
+	cfg := OpenAIConfig{
+		DeploymentName: "custom-deployment",
+		Truncation:     &TruncationConfig{Strategy: TruncationDropOldest},
+	}
+	if _, err := convertToAzureOpenAIRequest(context.Background(), "", request, cfg); err == nil {
+		t.Error("Expected error for unknown context window")
+	}
+
+	cfg.Truncation = &TruncationConfig{Strategy: TruncationKeepLastN, KeepLastN: 1}
+	result, err := convertToAzureOpenAIRequest(context.Background(), "", request, cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(result.Messages) != 2 {
+		t.Errorf("Expected 2 messages after truncation, got %d", len(result.Messages))
+	}
+}
+
+func TestConvertToCompletionsRequest_Truncation(t *testing.T) {
+	request := &ai.ModelRequest{
+		Messages: []*ai.Message{
+			ai.NewSystemTextMessage("You are a helpful assistant"),
+			ai.NewUserTextMessage("first question " + longText(2000)),
+			ai.NewModelTextMessage("first answer " + longText(2000)),
+			ai.NewUserTextMessage("latest question"),
+		},
+	}
+
+	cfg := OpenAIConfig{
+		DeploymentName: "instruct",
+		Truncation:     &TruncationConfig{Strategy: TruncationDropOldest},
+	}
+	result, err := convertToCompletionsRequest(context.Background(), Gpt35TurboInstruct, request, cfg, "instruct")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	prompt := result.Prompt[0]
+	if strings.Contains(prompt, "first question") {
+		t.Error("Expected the oldest turn to be dropped")
+	}
+	for _, want := range []string{"You are a helpful assistant", "first answer", "latest question"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("Expected prompt to keep %q", want)
+		}
+	}
+}